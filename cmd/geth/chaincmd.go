@@ -34,6 +34,7 @@ import (
 	"github.com/akroma-project/akroma/eth/downloader"
 	"github.com/akroma-project/akroma/ethdb"
 	"github.com/akroma-project/akroma/event"
+	"github.com/akroma-project/akroma/light"
 	"github.com/akroma-project/akroma/log"
 	"github.com/akroma-project/akroma/trie"
 	"github.com/syndtr/goleveldb/leveldb/util"
@@ -169,6 +170,21 @@ Remove blockchain and state databases`,
 The arguments are interpreted as block numbers or hashes.
 Use "ethereum dump 0" to dump the genesis block.`,
 	}
+	inspectHelperTriesCommand = cli.Command{
+		Action:    utils.MigrateFlags(inspectHelperTries),
+		Name:      "inspect-helpertries",
+		Usage:     "Report the storage used by the light client helper tries",
+		ArgsUsage: " ",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.CacheFlag,
+			utils.LightModeFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The inspect-helpertries command sums up the sizes of the CHT and BloomTrie nodes
+stored in the chain database.`,
+	}
 )
 
 // initGenesis will initialise the given JSON format genesis file and writes it as
@@ -466,6 +482,25 @@ func dump(ctx *cli.Context) error {
 	return nil
 }
 
+func inspectHelperTries(ctx *cli.Context) error {
+	stack := makeFullNode(ctx)
+	chainDb := utils.MakeChainDatabase(ctx, stack)
+	defer chainDb.Close()
+
+	var inspector light.DatabaseInspector
+	chtSize, err := inspector.InspectChtTableSize(chainDb)
+	if err != nil {
+		utils.Fatalf("Failed to inspect CHT table: %v", err)
+	}
+	bloomTrieSize, err := inspector.InspectBloomTrieTableSize(chainDb)
+	if err != nil {
+		utils.Fatalf("Failed to inspect BloomTrie table: %v", err)
+	}
+	fmt.Printf("CHT:       %v\n", common.StorageSize(chtSize))
+	fmt.Printf("BloomTrie: %v\n", common.StorageSize(bloomTrieSize))
+	return nil
+}
+
 // hashish returns true for strings that look like hashes.
 func hashish(x string) bool {
 	_, err := strconv.Atoi(x)
@@ -164,6 +164,7 @@ func init() {
 		copydbCommand,
 		removedbCommand,
 		dumpCommand,
+		inspectHelperTriesCommand,
 		// See monitorcmd.go:
 		monitorCommand,
 		// See accountcmd.go:
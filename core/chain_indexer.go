@@ -47,6 +47,21 @@ type ChainIndexerBackend interface {
 	Commit() error
 }
 
+// ChainIndexerBackendNamer is an optional interface of chain indexer backends
+// identifying the kind of index they generate.
+type ChainIndexerBackendNamer interface {
+	// Name returns a short identifier of the index type, used in logs.
+	Name() string
+}
+
+// ChainIndexerErrorReporter is an optional interface of backends which skip
+// headers they fail to process instead of aborting the section.
+type ChainIndexerErrorReporter interface {
+	// LastError returns the last error encountered by Process since the last
+	// Reset, or nil if all headers were processed successfully.
+	LastError() error
+}
+
 // ChainIndexerChain interface is used for connecting the indexer to a blockchain
 type ChainIndexerChain interface {
 	// CurrentHeader retrieves the latest locally known header.
@@ -56,6 +71,13 @@ type ChainIndexerChain interface {
 	SubscribeChainEvent(ch chan<- ChainEvent) event.Subscription
 }
 
+// ChainIndexerError is posted by a ChainIndexer if processing or committing a
+// section failed.
+type ChainIndexerError struct {
+	Section uint64 // Index of the failed section
+	Err     error  // Failure reported by the backend or the header continuity check
+}
+
 // ChainIndexer does a post-processing job for equally sized sections of the
 // canonical chain (like BlooomBits and CHT structures). A ChainIndexer is
 // connected to the blockchain through the event system by starting a
@@ -83,7 +105,11 @@ type ChainIndexer struct {
 	cascadedHead   uint64 // Block number of the last completed section cascaded to subindexers
 
 	throttling time.Duration // Disk throttling to prevent a heavy upgrade from hogging resources
+	lastCommit time.Time     // Time the last section was successfully indexed
+
+	errFeed event.Feed // Feed of section processing failures
 
+	kind string // Index type used if the backend doesn't name itself
 	log  log.Logger
 	lock sync.RWMutex
 }
@@ -101,8 +127,10 @@ func NewChainIndexer(chainDb, indexDb ethdb.Database, backend ChainIndexerBacken
 		sectionSize: section,
 		confirmsReq: confirm,
 		throttling:  throttling,
-		log:         log.New("type", kind),
+		kind:        kind,
 	}
+	c.log = log.New("type", c.BackendType())
+
 	// Initialize database dependent fields and start the updater
 	c.loadValidSections()
 	go c.updateLoop()
@@ -110,6 +138,21 @@ func NewChainIndexer(chainDb, indexDb ethdb.Database, backend ChainIndexerBacken
 	return c
 }
 
+// BackendType returns the type of the index generated by the backend, as reported
+// by its Name method, or the kind the indexer was created with otherwise.
+func (c *ChainIndexer) BackendType() string {
+	if namer, ok := c.backend.(ChainIndexerBackendNamer); ok {
+		return namer.Name()
+	}
+	return c.kind
+}
+
+// SubscribeErrors subscribes to failures of processing or committing a section.
+// Processing is blocked until the failure is delivered to all subscribers.
+func (c *ChainIndexer) SubscribeErrors(ch chan<- ChainIndexerError) event.Subscription {
+	return c.errFeed.Subscribe(ch)
+}
+
 // AddKnownSectionHead marks a new section head as known/processed if it is newer
 // than the already known best section head
 func (c *ChainIndexer) AddKnownSectionHead(section uint64, shead common.Hash) {
@@ -298,6 +341,7 @@ func (c *ChainIndexer) updateLoop() {
 				newHead, err := c.processSection(section, oldHead)
 				if err != nil {
 					c.log.Error("Section processing failed", "error", err)
+					c.errFeed.Send(ChainIndexerError{Section: section, Err: err})
 				}
 				c.lock.Lock()
 
@@ -305,6 +349,7 @@ func (c *ChainIndexer) updateLoop() {
 				if err == nil && oldHead == c.SectionHead(section-1) {
 					c.setSectionHead(section, newHead)
 					c.setValidSections(section + 1)
+					c.lastCommit = time.Now()
 					if c.storedSections == c.knownSections && updating {
 						updating = false
 						c.log.Info("Finished upgrading chain index")
@@ -363,6 +408,11 @@ func (c *ChainIndexer) processSection(section uint64, lastHead common.Hash) (com
 		c.backend.Process(header)
 		lastHead = header.Hash()
 	}
+	if reporter, ok := c.backend.(ChainIndexerErrorReporter); ok {
+		if err := reporter.LastError(); err != nil {
+			c.log.Warn("Section processed with errors", "section", section, "err", err)
+		}
+	}
 	if err := c.backend.Commit(); err != nil {
 		c.log.Error("Section commit failed", "error", err)
 		return common.Hash{}, err
@@ -380,6 +430,29 @@ func (c *ChainIndexer) Sections() (uint64, uint64, common.Hash) {
 	return c.storedSections, c.storedSections*c.sectionSize - 1, c.SectionHead(c.storedSections - 1)
 }
 
+// ChainIndexerStatus is a snapshot of the progress of a chain indexer.
+type ChainIndexerStatus struct {
+	SectionsIndexed       uint64    `json:"sectionsIndexed"`       // Number of sections successfully indexed into the database
+	SectionsConfirmed     uint64    `json:"sectionsConfirmed"`     // Number of sections known to be complete and confirmed
+	SectionSize           uint64    `json:"sectionSize"`           // Number of blocks in a single section
+	ConfirmationsRequired uint64    `json:"confirmationsRequired"` // Number of confirmations before a section is processed
+	LastCommit            time.Time `json:"lastCommit"`            // Time the last section was indexed (zero if none since startup)
+}
+
+// Status returns a snapshot of the progress of the indexer.
+func (c *ChainIndexer) Status() ChainIndexerStatus {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return ChainIndexerStatus{
+		SectionsIndexed:       c.storedSections,
+		SectionsConfirmed:     c.knownSections,
+		SectionSize:           c.sectionSize,
+		ConfirmationsRequired: c.confirmsReq,
+		LastCommit:            c.lastCommit,
+	}
+}
+
 // AddChildIndexer adds a child ChainIndexer that can use the output of this one
 func (c *ChainIndexer) AddChildIndexer(indexer *ChainIndexer) {
 	c.lock.Lock()
@@ -44,6 +44,67 @@ func TestChainIndexerWithChildren(t *testing.T) {
 	}
 }
 
+// namedTestChainIndexBackend is a testChainIndexBackend naming its index type.
+type namedTestChainIndexBackend struct {
+	testChainIndexBackend
+}
+
+func (b *namedTestChainIndexBackend) Name() string { return "named" }
+
+// Tests that the backend type is taken from the backend if it names itself and
+// falls back to the kind given on construction otherwise.
+func TestChainIndexerBackendType(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	plain := NewChainIndexer(db, ethdb.NewTable(db, "a"), &testChainIndexBackend{t: t}, 10, 0, 0, "plain")
+	defer plain.Close()
+	if kind := plain.BackendType(); kind != "plain" {
+		t.Errorf("unnamed backend type mismatch: have %q, want %q", kind, "plain")
+	}
+	named := NewChainIndexer(db, ethdb.NewTable(db, "b"), &namedTestChainIndexBackend{testChainIndexBackend{t: t}}, 10, 0, 0, "plain")
+	defer named.Close()
+	if kind := named.BackendType(); kind != "named" {
+		t.Errorf("named backend type mismatch: have %q, want %q", kind, "named")
+	}
+}
+
+// Tests that the status reflects the sections processed by the indexer.
+func TestChainIndexerStatus(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	defer db.Close()
+
+	backend := &testChainIndexBackend{t: t, processCh: make(chan uint64)}
+	backend.indexer = NewChainIndexer(db, ethdb.NewTable(db, "s"), backend, 10, 2, 0, "status")
+	defer backend.indexer.Close()
+
+	if status := backend.indexer.Status(); status != (ChainIndexerStatus{SectionSize: 10, ConfirmationsRequired: 2}) {
+		t.Fatalf("initial status mismatch: %+v", status)
+	}
+	var lastHash common.Hash
+	for i := uint64(0); i <= 24; i++ {
+		header := &types.Header{Number: new(big.Int).SetUint64(i), ParentHash: lastHash}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), i)
+		lastHash = header.Hash()
+	}
+	start := time.Now()
+	backend.indexer.newHead(24, false)
+	backend.assertBlocks(24, 24)
+	backend.assertSections()
+
+	status := backend.indexer.Status()
+	if status.SectionsIndexed != 2 || status.SectionsConfirmed != 2 {
+		t.Errorf("section counts mismatch: have %d indexed, %d confirmed, want 2, 2", status.SectionsIndexed, status.SectionsConfirmed)
+	}
+	if status.SectionSize != 10 || status.ConfirmationsRequired != 2 {
+		t.Errorf("config mismatch: have size %d, confirmations %d", status.SectionSize, status.ConfirmationsRequired)
+	}
+	if status.LastCommit.Before(start) {
+		t.Errorf("last commit time %v before processing start %v", status.LastCommit, start)
+	}
+}
+
 // testChainIndexer runs a test with either a single chain indexer or a chain of
 // multiple backends. The section size and required confirmation count parameters
 // are randomized.
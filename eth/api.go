@@ -352,6 +352,13 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// GetIndexerStatus returns the progress of the chain indexers of the node, keyed
+// by the type of index they generate.
+func (api *PrivateDebugAPI) GetIndexerStatus() map[string]core.ChainIndexerStatus {
+	indexer := api.eth.bloomIndexer
+	return map[string]core.ChainIndexerStatus{indexer.BackendType(): indexer.Status()}
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
@@ -113,6 +113,11 @@ func NewBloomIndexer(db ethdb.Database, size uint64) *core.ChainIndexer {
 	return core.NewChainIndexer(db, table, backend, size, bloomConfirms, bloomThrottling, "bloombits")
 }
 
+// Name implements core.ChainIndexerBackendNamer
+func (b *BloomIndexer) Name() string {
+	return "bloombits"
+}
+
 // Reset implements core.ChainIndexerBackend, starting a new bloombits index
 // section.
 func (b *BloomIndexer) Reset(section uint64, lastSectionHead common.Hash) error {
@@ -36,6 +36,7 @@ import (
 	"github.com/akroma-project/akroma/core/types"
 	"github.com/akroma-project/akroma/core/vm"
 	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/light"
 	"github.com/akroma-project/akroma/log"
 	"github.com/akroma-project/akroma/p2p"
 	"github.com/akroma-project/akroma/params"
@@ -1456,6 +1457,21 @@ func (api *PrivateDebugAPI) ChaindbCompact() error {
 	return nil
 }
 
+// CompactLightData compacts the CHT and BloomTrie tables of the chain database.
+func (api *PrivateDebugAPI) CompactLightData() error {
+	var compactor light.DatabaseCompactor
+	if err := compactor.CompactChtTable(api.b.ChainDb()); err != nil {
+		return err
+	}
+	return compactor.CompactBloomTrieTable(api.b.ChainDb())
+}
+
+// DumpBloomTrieSection returns the compressed and decompressed bloom bit vectors
+// of every bit index of the BloomTrie section stored with the given section head.
+func (api *PrivateDebugAPI) DumpBloomTrieSection(section hexutil.Uint64, sectionHead common.Hash) ([]light.BloomBitsDump, error) {
+	return light.DumpBloomTrieSection(api.b.ChainDb(), uint64(section), sectionHead)
+}
+
 // SetHead rewinds the head of the blockchain to a previous block.
 func (api *PrivateDebugAPI) SetHead(number hexutil.Uint64) {
 	api.b.SetHead(uint64(number))
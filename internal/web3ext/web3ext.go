@@ -216,6 +216,19 @@ web3._extend({
 			name: 'chaindbCompact',
 			call: 'debug_chaindbCompact',
 		}),
+		new web3._extend.Method({
+			name: 'compactLightData',
+			call: 'debug_compactLightData',
+		}),
+		new web3._extend.Method({
+			name: 'dumpBloomTrieSection',
+			call: 'debug_dumpBloomTrieSection',
+			params: 2
+		}),
+		new web3._extend.Method({
+			name: 'getIndexerStatus',
+			call: 'debug_getIndexerStatus',
+		}),
 		new web3._extend.Method({
 			name: 'metrics',
 			call: 'debug_metrics',
@@ -368,6 +381,21 @@ web3._extend({
 			call: 'debug_getBadBlocks',
 			params: 0,
 		}),
+		new web3._extend.Method({
+			name: 'listTrustedCheckpoints',
+			call: 'debug_listTrustedCheckpoints',
+			params: 0,
+		}),
+		new web3._extend.Method({
+			name: 'exportCheckpoint',
+			call: 'debug_exportCheckpoint',
+			params: 0,
+		}),
+		new web3._extend.Method({
+			name: 'registerCheckpoint',
+			call: 'debug_registerCheckpoint',
+			params: 1,
+		}),
 		new web3._extend.Method({
 			name: 'storageRangeAt',
 			call: 'debug_storageRangeAt',
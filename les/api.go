@@ -0,0 +1,71 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/light"
+)
+
+// PrivateLightDebugAPI provides debugging methods specific to the light client.
+type PrivateLightDebugAPI struct {
+	db          ethdb.Database
+	genesisHash common.Hash
+	checkpoints *light.CheckpointRegistry
+	indexers    []*core.ChainIndexer
+}
+
+// NewPrivateLightDebugAPI creates a new light client debug API managing the
+// checkpoints of the chain with the given genesis hash stored in db, and
+// reporting on the given chain indexers.
+func NewPrivateLightDebugAPI(db ethdb.Database, genesisHash common.Hash, indexers []*core.ChainIndexer) *PrivateLightDebugAPI {
+	return &PrivateLightDebugAPI{
+		db:          db,
+		genesisHash: genesisHash,
+		checkpoints: light.NewCheckpointRegistry(db),
+		indexers:    indexers,
+	}
+}
+
+// ListTrustedCheckpoints returns the trusted checkpoints configured in the node.
+func (api *PrivateLightDebugAPI) ListTrustedCheckpoints() []*light.CheckpointInfo {
+	return light.TrustedCheckpointInfos(api.db)
+}
+
+// ExportCheckpoint returns a checkpoint of the latest section of the local chain
+// with committed CHT and BloomTrie roots, to be registered on other nodes.
+func (api *PrivateLightDebugAPI) ExportCheckpoint() (light.TrustedCheckpoint, error) {
+	return api.checkpoints.ExportLatest(api.genesisHash)
+}
+
+// RegisterCheckpoint persists a trusted checkpoint of the local chain, used from
+// the next start of the node on.
+func (api *PrivateLightDebugAPI) RegisterCheckpoint(cp light.TrustedCheckpoint) error {
+	return api.checkpoints.Register(api.genesisHash, cp)
+}
+
+// GetIndexerStatus returns the progress of the chain indexers of the light client,
+// keyed by the type of index they generate.
+func (api *PrivateLightDebugAPI) GetIndexerStatus() map[string]core.ChainIndexerStatus {
+	status := make(map[string]core.ChainIndexerStatus, len(api.indexers))
+	for _, indexer := range api.indexers {
+		status[indexer.BackendType()] = indexer.Status()
+	}
+	return status
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/light"
+	"github.com/akroma-project/akroma/params"
+)
+
+func TestListTrustedCheckpoints(t *testing.T) {
+	for _, cp := range NewPrivateLightDebugAPI(ethdb.NewMemDatabase(), params.MainnetGenesisHash, nil).ListTrustedCheckpoints() {
+		if cp.GenesisHash == params.MainnetGenesisHash {
+			if cp.Name != "mainnet" || cp.SectionIdx == 0 || cp.ChtRoot == (common.Hash{}) || cp.BloomTrieRoot == (common.Hash{}) {
+				t.Errorf("mainnet checkpoint mismatch: have %+v", cp)
+			}
+			return
+		}
+	}
+	t.Fatalf("mainnet checkpoint not listed")
+}
+
+func TestExportRegisterCheckpoint(t *testing.T) {
+	server := NewPrivateLightDebugAPI(ethdb.NewMemDatabase(), params.MainnetGenesisHash, nil)
+	if _, err := server.ExportCheckpoint(); err != light.ErrNoCommittedCheckpoint {
+		t.Fatalf("export without sections: have %v, want %v", err, light.ErrNoCommittedCheckpoint)
+	}
+	// Register a checkpoint newer than the built-in one on a client
+	client := NewPrivateLightDebugAPI(ethdb.NewMemDatabase(), params.MainnetGenesisHash, nil)
+	var cp light.TrustedCheckpoint
+	data := `{"name":"mainnet","sectionIdx":1000,"sectionHead":"0x0000000000000000000000000000000000000000000000000000000000000001","chtRoot":"0x0000000000000000000000000000000000000000000000000000000000000002","bloomTrieRoot":"0x0000000000000000000000000000000000000000000000000000000000000003"}`
+	if err := cp.UnmarshalJSON([]byte(data)); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	if err := client.RegisterCheckpoint(cp); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	for _, info := range client.ListTrustedCheckpoints() {
+		if info.GenesisHash == params.MainnetGenesisHash && info.SectionIdx == 1000 {
+			return
+		}
+	}
+	t.Fatalf("registered checkpoint not listed")
+}
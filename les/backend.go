@@ -66,6 +66,7 @@ type LightEthereum struct {
 	chainDb ethdb.Database // Block chain database
 
 	bloomRequests                              chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
+	bloomCache                                 *light.BloomTrieReadCache      // Cache of decompressed bloom bit vectors served to filters
 	bloomIndexer, chtIndexer, bloomTrieIndexer *core.ChainIndexer
 
 	ApiBackend *LesApiBackend
@@ -106,8 +107,9 @@ func New(ctx *node.ServiceContext, config *eth.Config) (*LightEthereum, error) {
 		shutdownChan:     make(chan bool),
 		networkId:        config.NetworkId,
 		bloomRequests:    make(chan chan *bloombits.Retrieval),
+		bloomCache:       light.NewBloomTrieReadCache(bloomCacheSize),
 		bloomIndexer:     eth.NewBloomIndexer(chainDb, light.BloomTrieFrequency),
-		chtIndexer:       light.NewChtIndexer(chainDb, true),
+		chtIndexer:       light.NewChtIndexer(chainDb, nil),
 		bloomTrieIndexer: light.NewBloomTrieIndexer(chainDb, true),
 	}
 
@@ -198,6 +200,10 @@ func (s *LightEthereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   s.netRPCService,
 			Public:    true,
+		}, {
+			Namespace: "debug",
+			Version:   "1.0",
+			Service:   NewPrivateLightDebugAPI(s.chainDb, s.blockchain.Genesis().Hash(), []*core.ChainIndexer{s.chtIndexer, s.bloomTrieIndexer, s.bloomIndexer}),
 		},
 	}...)
 }
@@ -19,7 +19,6 @@ package les
 import (
 	"time"
 
-	"github.com/akroma-project/akroma/common/bitutil"
 	"github.com/akroma-project/akroma/light"
 )
 
@@ -39,6 +38,10 @@ const (
 	// bloomRetrievalWait is the maximum time to wait for enough bloom bit requests
 	// to accumulate request an entire batch (avoiding hysteresis).
 	bloomRetrievalWait = time.Microsecond * 100
+
+	// bloomCacheSize is the number of decompressed bloom bit vectors (4KB each)
+	// cached for repeated filter runs over the same sections.
+	bloomCacheSize = 1024
 )
 
 // startBloomHandlers starts a batch of goroutines to accept bloom bit database
@@ -54,15 +57,8 @@ func (eth *LightEthereum) startBloomHandlers() {
 				case request := <-eth.bloomRequests:
 					task := <-request
 					task.Bitsets = make([][]byte, len(task.Sections))
-					compVectors, err := light.GetBloomBits(task.Context, eth.odr, task.Bit, task.Sections)
-					if err == nil {
-						for i := range task.Sections {
-							if blob, err := bitutil.DecompressBytes(compVectors[i], int(light.BloomTrieFrequency/8)); err == nil {
-								task.Bitsets[i] = blob
-							} else {
-								task.Error = err
-							}
-						}
+					if bitsets, err := light.GetDecompressedBloomBits(task.Context, eth.odr, eth.bloomCache, task.Bit, task.Sections); err == nil {
+						task.Bitsets = bitsets
 					} else {
 						task.Error = err
 					}
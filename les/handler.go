@@ -117,6 +117,11 @@ type ProtocolManager struct {
 
 	eventMux *event.TypeMux
 
+	// helper trie sections advertised in the server handshake, kept up to date
+	// by trackHelperTries
+	helperTries     light.HelperTrieCapabilities
+	helperTriesLock sync.RWMutex
+
 	// channels for fetcher, syncer, txsyncLoop
 	newPeerCh   chan *peer
 	quitSync    chan struct{}
@@ -255,6 +260,45 @@ func (pm *ProtocolManager) Stop() {
 	log.Info("Light Ethereum protocol stopped")
 }
 
+// trackHelperTries builds the advertised helper trie capabilities from the
+// database and keeps them updated from the commit events of the CHT and
+// BloomTrie indexers posted on the given bus until the protocol manager stops.
+func (pm *ProtocolManager) trackHelperTries(bus *light.IndexerEventBus) {
+	// Subscribe before building so no section committed in between is missed.
+	events := bus.Subscribe()
+	caps := light.BuildHelperTrieCapabilities(pm.chainDb)
+
+	pm.helperTriesLock.Lock()
+	pm.helperTries = caps
+	pm.helperTriesLock.Unlock()
+
+	pm.wg.Add(1)
+	go func() {
+		defer pm.wg.Done()
+		defer bus.Unsubscribe(events)
+
+		for {
+			select {
+			case ev := <-events:
+				pm.helperTriesLock.Lock()
+				pm.helperTries.Update(ev)
+				pm.helperTriesLock.Unlock()
+			case <-pm.quitSync:
+				return
+			}
+		}
+	}()
+}
+
+// helperTrieCapabilities returns a copy of the helper trie capabilities
+// advertised in the server handshake.
+func (pm *ProtocolManager) helperTrieCapabilities() light.HelperTrieCapabilities {
+	pm.helperTriesLock.RLock()
+	defer pm.helperTriesLock.RUnlock()
+
+	return pm.helperTries.Copy()
+}
+
 func (pm *ProtocolManager) newPeer(pv int, nv uint64, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
 	return newPeer(pv, nv, p, newMeteredMsgWriter(rw))
 }
@@ -888,8 +932,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 					if err != nil {
 						continue
 					}
-					var encNumber [8]byte
-					binary.BigEndian.PutUint64(encNumber[:], req.BlockNum)
+					encNumber := light.ComputeChtKey(req.BlockNum)
 
 					var proof light.NodeList
 					trie.Prove(encNumber[:], 0, &proof)
@@ -1137,7 +1180,7 @@ func (pm *ProtocolManager) getAccount(statedb *state.StateDB, root, hash common.
 func (pm *ProtocolManager) getHelperTrie(id uint, idx uint64) (common.Hash, string) {
 	switch id {
 	case htCanonical:
-		sectionHead := rawdb.ReadCanonicalHash(pm.chainDb, (idx+1)*light.CHTFrequencyClient-1)
+		sectionHead := rawdb.ReadCanonicalHash(pm.chainDb, light.ChtSectionHeadBlock(idx, light.CHTFrequencyClient))
 		return light.GetChtV2Root(pm.chainDb, idx, sectionHead), light.ChtTablePrefix
 	case htBloomBits:
 		sectionHead := rawdb.ReadCanonicalHash(pm.chainDb, (idx+1)*light.BloomTrieFrequency-1)
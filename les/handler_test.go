@@ -462,21 +462,18 @@ func TestGetBloombitsProofs(t *testing.T) {
 	// Request and verify each bit of the bloom bits proofs
 	for bit := 0; bit < 2048; bit++ {
 		// Assemble therequest and proofs for the bloombits
-		key := make([]byte, 10)
-
-		binary.BigEndian.PutUint16(key[:2], uint16(bit))
-		binary.BigEndian.PutUint64(key[2:], uint64(light.BloomTrieFrequency))
+		key := light.ComputeHelperTrieKey(uint(bit), uint64(light.BloomTrieFrequency))
 
 		requests := []HelperTrieReq{{
 			Type:    htBloomBits,
 			TrieIdx: 0,
-			Key:     key,
+			Key:     key[:],
 		}}
 		var proofs HelperTrieResps
 
 		root := light.GetBloomTrieRoot(db, 0, bc.GetHeaderByNumber(light.BloomTrieFrequency-1).Hash())
 		trie, _ := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, light.BloomTrieTablePrefix)))
-		trie.Prove(key, 0, &proofs.Proofs)
+		trie.Prove(key[:], 0, &proofs.Proofs)
 
 		// Send the proof request and verify the response
 		cost := peer.GetRequestCost(GetHelperTrieProofsMsg, len(requests))
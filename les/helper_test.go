@@ -21,9 +21,11 @@ package les
 
 import (
 	"crypto/rand"
+	"fmt"
 	"math/big"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/akroma-project/akroma/common"
 	"github.com/akroma-project/akroma/consensus/ethash"
@@ -151,15 +153,18 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 		peers = newPeerSet()
 	}
 
+	events := light.NewIndexerEventBus()
 	if lightSync {
 		chain, _ = light.NewLightChain(odr, gspec.Config, engine)
 	} else {
 		blockchain, _ := core.NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
 
-		chtIndexer := light.NewChtIndexer(db, false)
+		chtConfig := light.DefaultServerChtIndexerConfig
+		chtConfig.Events = events
+		chtIndexer := light.NewChtIndexer(db, &chtConfig)
 		chtIndexer.Start(blockchain)
 
-		bbtIndexer := light.NewBloomTrieIndexer(db, false)
+		bbtIndexer := light.NewBloomTrieIndexer(db, false, light.WithBloomTrieEvents(events))
 
 		bloomIndexer := eth.NewBloomIndexer(db, params.BloomBitsBlocks)
 		bloomIndexer.AddChildIndexer(bbtIndexer)
@@ -185,6 +190,10 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 	if !lightSync {
 		srv := &LesServer{protocolManager: pm}
 		pm.server = srv
+		pm.trackHelperTries(events)
+		if err := waitHelperTries(pm, uint64(blocks)); err != nil {
+			return nil, err
+		}
 
 		srv.defParams = &flowcontrol.ServerParams{
 			BufLimit:    testBufLimit,
@@ -198,6 +207,30 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 	return pm, nil
 }
 
+// waitHelperTries waits until the server protocol manager advertises all the CHT
+// and BloomTrie sections the indexers generate for a chain with the given head,
+// so the handshakes of the test peers do not race with the indexing.
+func waitHelperTries(pm *ProtocolManager, head uint64) error {
+	var chtSections, bloomTrieSections int
+	if head >= light.HelperTrieProcessConfirmations {
+		chtSections = int((head + 1 - light.HelperTrieProcessConfirmations) / light.CHTFrequencyServer)
+		bloomBitsSections := (head + 1 - light.HelperTrieProcessConfirmations) / params.BloomBitsBlocks
+		bloomTrieSections = int(bloomBitsSections * params.BloomBitsBlocks / light.BloomTrieFrequency)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		caps := pm.helperTrieCapabilities()
+		if len(caps.AvailableChtSections.Sections()) == chtSections && len(caps.AvailableBloomTrieSections.Sections()) == bloomTrieSections {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("helper tries not indexed: have %d CHT and %d BloomTrie sections, want %d and %d",
+				len(caps.AvailableChtSections.Sections()), len(caps.AvailableBloomTrieSections.Sections()), chtSections, bloomTrieSections)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // newTestProtocolManagerMust creates a new protocol manager for testing purposes,
 // with the given number of blocks already known, and potential notification
 // channels for different events. In case of an error, the constructor force-
@@ -250,7 +283,7 @@ func newTestPeer(t *testing.T, name string, version int, pm *ProtocolManager, sh
 			head    = pm.blockchain.CurrentHeader()
 			td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
 		)
-		tp.handshake(t, td, head.Hash(), head.Number.Uint64(), genesis.Hash())
+		tp.handshake(t, td, head.Hash(), head.Number.Uint64(), genesis.Hash(), pm.helperTrieCapabilities())
 	}
 	return tp, errc
 }
@@ -290,7 +323,7 @@ func newTestPeerPair(name string, version int, pm, pm2 *ProtocolManager) (*peer,
 
 // handshake simulates a trivial handshake that expects the same state from the
 // remote side as we are simulating locally.
-func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNum uint64, genesis common.Hash) {
+func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNum uint64, genesis common.Hash, helperTries light.HelperTrieCapabilities) {
 	var expList keyValueList
 	expList = expList.add("protocolVersion", uint64(p.version))
 	expList = expList.add("networkId", uint64(NetworkId))
@@ -307,6 +340,7 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNu
 	expList = expList.add("flowControl/BL", testBufLimit)
 	expList = expList.add("flowControl/MRR", uint64(1))
 	expList = expList.add("flowControl/MRC", testRCL())
+	expList = expList.add("helperTries", helperTries)
 
 	if err := p2p.ExpectMsg(p.app, StatusMsg, expList); err != nil {
 		t.Fatalf("status recv: %v", err)
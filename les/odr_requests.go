@@ -19,7 +19,6 @@
 package les
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 
@@ -42,8 +41,6 @@ var (
 	errUncleHashMismatch   = errors.New("uncle hash mismatch")
 	errReceiptHashMismatch = errors.New("receipt hash mismatch")
 	errDataHashMismatch    = errors.New("data hash mismatch")
-	errCHTHashMismatch     = errors.New("cht hash mismatch")
-	errCHTNumberMismatch   = errors.New("cht number mismatch")
 	errUselessNodes        = errors.New("useless nodes in merkle proof nodeset")
 )
 
@@ -371,8 +368,7 @@ func (r *ChtRequest) CanSend(peer *peer) bool {
 // Request sends an ODR request to the LES network (implementation of LesOdrRequest)
 func (r *ChtRequest) Request(reqID uint64, peer *peer) error {
 	peer.Log().Debug("Requesting CHT", "cht", r.ChtNum, "block", r.BlockNum)
-	var encNum [8]byte
-	binary.BigEndian.PutUint64(encNum[:], r.BlockNum)
+	encNum := light.ComputeChtKey(r.BlockNum)
 	req := HelperTrieReq{
 		Type:    htCanonical,
 		TrieIdx: r.ChtNum,
@@ -382,6 +378,19 @@ func (r *ChtRequest) Request(reqID uint64, peer *peer) error {
 	return peer.RequestHelperTrieProofs(reqID, r.GetCost(peer), []HelperTrieReq{req})
 }
 
+// verifyProof checks the CHT proof of a reply with the verifier configured for the
+// request, if any. The entry itself is read from the Merkle proof afterwards.
+func (r *ChtRequest) verifyProof(proof light.NodeList) error {
+	if r.Verifier == nil {
+		return nil
+	}
+	enc, err := rlp.EncodeToBytes(proof)
+	if err != nil {
+		return err
+	}
+	return r.Verifier.Verify(r.ChtRoot, r.BlockNum, enc)
+}
+
 // Valid processes an ODR request reply message from the LES network
 // returns true and stores results in memory if the message was a valid reply
 // to the request (implementation of LesOdrRequest)
@@ -397,24 +406,18 @@ func (r *ChtRequest) Validate(db ethdb.Database, msg *Msg) error {
 		proof := proofs[0]
 
 		// Verify the CHT
-		var encNumber [8]byte
-		binary.BigEndian.PutUint64(encNumber[:], r.BlockNum)
-
-		value, _, err := trie.VerifyProof(r.ChtRoot, encNumber[:], light.NodeList(proof.Proof).NodeSet())
-		if err != nil {
+		if err := r.verifyProof(light.NodeList(proof.Proof)); err != nil {
 			return err
 		}
-		var node light.ChtNode
-		if err := rlp.DecodeBytes(value, &node); err != nil {
+		nodeSet := light.NodeList(proof.Proof).NodeSet()
+		cht := &light.ChtResponse{BlockNum: r.BlockNum, Header: proof.Header, Proof: nodeSet}
+		if err := (light.ChtResponseValidator{}).Validate(cht, r.ChtRoot); err != nil {
 			return err
 		}
-		if node.Hash != proof.Header.Hash() {
-			return errCHTHashMismatch
-		}
 		// Verifications passed, store and return
 		r.Header = proof.Header
-		r.Proof = light.NodeList(proof.Proof).NodeSet()
-		r.Td = node.Td
+		r.Proof = nodeSet
+		r.Td = cht.Td
 	case MsgHelperTrieProofs:
 		resp := msg.Obj.(HelperTrieResps)
 		if len(resp.AuxData) != 1 {
@@ -431,32 +434,21 @@ func (r *ChtRequest) Validate(db ethdb.Database, msg *Msg) error {
 		}
 
 		// Verify the CHT
-		var encNumber [8]byte
-		binary.BigEndian.PutUint64(encNumber[:], r.BlockNum)
-
+		if err := r.verifyProof(resp.Proofs); err != nil {
+			return err
+		}
 		reads := &readTraceDB{db: nodeSet}
-		value, _, err := trie.VerifyProof(r.ChtRoot, encNumber[:], reads)
-		if err != nil {
-			return fmt.Errorf("merkle proof verification failed: %v", err)
+		cht := &light.ChtResponse{BlockNum: r.BlockNum, Header: header, Proof: reads}
+		if err := (light.ChtResponseValidator{}).Validate(cht, r.ChtRoot); err != nil {
+			return err
 		}
 		if len(reads.reads) != nodeSet.KeyCount() {
 			return errUselessNodes
 		}
-
-		var node light.ChtNode
-		if err := rlp.DecodeBytes(value, &node); err != nil {
-			return err
-		}
-		if node.Hash != header.Hash() {
-			return errCHTHashMismatch
-		}
-		if r.BlockNum != header.Number.Uint64() {
-			return errCHTNumberMismatch
-		}
 		// Verifications passed, store and return
 		r.Header = header
 		r.Proof = nodeSet
-		r.Td = node.Td
+		r.Td = cht.Td
 	default:
 		return errInvalidMessageType
 	}
@@ -492,11 +484,8 @@ func (r *BloomRequest) Request(reqID uint64, peer *peer) error {
 	peer.Log().Debug("Requesting BloomBits", "bloomTrie", r.BloomTrieNum, "bitIdx", r.BitIdx, "sections", r.SectionIdxList)
 	reqs := make([]HelperTrieReq, len(r.SectionIdxList))
 
-	var encNumber [10]byte
-	binary.BigEndian.PutUint16(encNumber[:2], uint16(r.BitIdx))
-
 	for i, sectionIdx := range r.SectionIdxList {
-		binary.BigEndian.PutUint64(encNumber[2:], sectionIdx)
+		encNumber := light.ComputeHelperTrieKey(r.BitIdx, sectionIdx)
 		reqs[i] = HelperTrieReq{
 			Type:    htBloomBits,
 			TrieIdx: r.BloomTrieNum,
@@ -521,24 +510,15 @@ func (r *BloomRequest) Validate(db ethdb.Database, msg *Msg) error {
 	nodeSet := proofs.NodeSet()
 	reads := &readTraceDB{db: nodeSet}
 
-	r.BloomBits = make([][]byte, len(r.SectionIdxList))
-
 	// Verify the proofs
-	var encNumber [10]byte
-	binary.BigEndian.PutUint16(encNumber[:2], uint16(r.BitIdx))
-
-	for i, idx := range r.SectionIdxList {
-		binary.BigEndian.PutUint64(encNumber[2:], idx)
-		value, _, err := trie.VerifyProof(r.BloomTrieRoot, encNumber[:], reads)
-		if err != nil {
-			return err
-		}
-		r.BloomBits[i] = value
+	bloom := &light.BloomResponse{BitIdx: r.BitIdx, SectionIdxList: r.SectionIdxList, Proof: reads}
+	if err := (light.BloomTrieResponseValidator{}).Validate(bloom, r.BloomTrieRoot); err != nil {
+		return err
 	}
-
 	if len(reads.reads) != nodeSet.KeyCount() {
 		return errUselessNodes
 	}
+	r.BloomBits = bloom.BloomBits
 	r.Proofs = nodeSet
 	return nil
 }
@@ -167,7 +167,7 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	rm := newRetrieveManager(peers, dist, nil)
 	db := ethdb.NewMemDatabase()
 	ldb := ethdb.NewMemDatabase()
-	odr := NewLesOdr(ldb, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), eth.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	odr := NewLesOdr(ldb, light.NewChtIndexer(db, nil), light.NewBloomTrieIndexer(db, true), eth.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
 	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
 	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
 	_, err1, lpeer, err2 := newTestPeerPair("peer", protocol, pm, lpm)
@@ -178,6 +178,12 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	case err := <-err2:
 		t.Fatalf("peer 1 handshake error: %v", err)
 	}
+	lpeer.lock.RLock()
+	caps := lpeer.helperTries
+	lpeer.lock.RUnlock()
+	if caps == nil {
+		t.Fatalf("server helper trie capabilities not received")
+	}
 
 	lpm.synchronise(lpeer)
 
@@ -218,3 +224,16 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
 	test(5)
 }
+
+func TestChtRequestVerifier(t *testing.T) {
+	msg := &Msg{MsgType: MsgHeaderProofs, Obj: []ChtResp{{Header: &types.Header{Number: big.NewInt(1)}}}}
+
+	req := &ChtRequest{BlockNum: 1, Verifier: light.SNARKProofVerifier{}}
+	if err := req.Validate(ethdb.NewMemDatabase(), msg); err != light.ErrNotImplemented {
+		t.Fatalf("configured verifier bypassed: have %v, want %v", err, light.ErrNotImplemented)
+	}
+	req = &ChtRequest{BlockNum: 1}
+	if err := req.Validate(ethdb.NewMemDatabase(), msg); err == nil || err == light.ErrNotImplemented {
+		t.Fatalf("empty proof: have %v, want merkle verification failure", err)
+	}
+}
@@ -62,13 +62,19 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 		lesTopics[i] = lesTopic(eth.BlockChain().Genesis().Hash(), pv)
 	}
 
+	// The helper trie indexers report committed sections on a shared bus which
+	// keeps the capabilities advertised in the handshake up to date.
+	events := light.NewIndexerEventBus()
+	chtConfig := light.DefaultServerChtIndexerConfig
+	chtConfig.Events = events
+
 	srv := &LesServer{
 		config:           config,
 		protocolManager:  pm,
 		quitSync:         quitSync,
 		lesTopics:        lesTopics,
-		chtIndexer:       light.NewChtIndexer(eth.ChainDb(), false),
-		bloomTrieIndexer: light.NewBloomTrieIndexer(eth.ChainDb(), false),
+		chtIndexer:       light.NewChtIndexer(eth.ChainDb(), &chtConfig),
+		bloomTrieIndexer: light.NewBloomTrieIndexer(eth.ChainDb(), false, light.WithBloomTrieEvents(events)),
 	}
 	logger := log.New()
 
@@ -91,6 +97,7 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 		logger.Info("Loaded bloom trie", "section", bloomTrieLastSection, "head", bloomTrieSectionHead, "root", bloomTrieRoot)
 	}
 
+	pm.trackHelperTries(events)
 	srv.chtIndexer.Start(eth.BlockChain())
 	pm.server = srv
 
@@ -0,0 +1,101 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"io"
+
+	"github.com/akroma-project/akroma/rlp"
+)
+
+var errNonCanonicalBitmap = errors.New("section bitmap has trailing zero bytes")
+
+// sectionBitmap is a set of section indexes stored as a bitset. Section i is bit
+// i%8 of byte i/8, and the bitset carries no trailing zero bytes.
+type sectionBitmap struct {
+	bits []byte
+}
+
+// Set marks the given section as available.
+func (b *sectionBitmap) Set(section uint64) {
+	idx := section / 8
+	if idx >= uint64(len(b.bits)) {
+		bits := make([]byte, idx+1)
+		copy(bits, b.bits)
+		b.bits = bits
+	}
+	b.bits[idx] |= 1 << (section % 8)
+}
+
+// IsSet reports whether the given section is marked as available.
+func (b *sectionBitmap) IsSet(section uint64) bool {
+	idx := section / 8
+	return idx < uint64(len(b.bits)) && b.bits[idx]&(1<<(section%8)) != 0
+}
+
+// Sections returns the available sections in ascending order.
+func (b *sectionBitmap) Sections() []uint64 {
+	var sections []uint64
+	for idx, bits := range b.bits {
+		for bit := uint64(0); bit < 8; bit++ {
+			if bits&(1<<bit) != 0 {
+				sections = append(sections, uint64(idx)*8+bit)
+			}
+		}
+	}
+	return sections
+}
+
+// Encode returns the bitset of the available sections.
+func (b *sectionBitmap) Encode() []byte {
+	return append([]byte(nil), b.bits...)
+}
+
+// Decode replaces the available sections with the ones in the given bitset, as
+// returned by Encode.
+func (b *sectionBitmap) Decode(data []byte) error {
+	if len(data) > 0 && data[len(data)-1] == 0 {
+		return errNonCanonicalBitmap
+	}
+	b.bits = append([]byte(nil), data...)
+	return nil
+}
+
+// EncodeRLP implements rlp.Encoder, encoding the bitset as a byte string.
+func (b sectionBitmap) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, b.bits)
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (b *sectionBitmap) DecodeRLP(s *rlp.Stream) error {
+	data, err := s.Bytes()
+	if err != nil {
+		return err
+	}
+	return b.Decode(data)
+}
+
+// ChtSectionBitmap is the set of CHT sections available on a node.
+type ChtSectionBitmap struct {
+	sectionBitmap
+}
+
+// BloomTrieSectionBitmap is the set of BloomTrie sections available on a node.
+type BloomTrieSectionBitmap struct {
+	sectionBitmap
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/akroma-project/akroma/rlp"
+)
+
+func TestChtSectionBitmapEncoding(t *testing.T) {
+	var bitmap ChtSectionBitmap
+	sections := []uint64{0, 3, 8, 9, 63, 1000}
+	for _, section := range sections {
+		bitmap.Set(section)
+	}
+	for _, section := range []uint64{1, 7, 10, 64, 999, 1001, 1 << 40} {
+		if bitmap.IsSet(section) {
+			t.Errorf("section %d unexpectedly set", section)
+		}
+	}
+	if have := bitmap.Sections(); !reflect.DeepEqual(have, sections) {
+		t.Fatalf("sections mismatch: have %v, want %v", have, sections)
+	}
+	enc := bitmap.Encode()
+	if len(enc) != 126 {
+		t.Errorf("encoded size mismatch: have %d, want %d", len(enc), 126)
+	}
+	var decoded ChtSectionBitmap
+	if err := decoded.Decode(enc); err != nil {
+		t.Fatalf("failed to decode bitmap: %v", err)
+	}
+	if have := decoded.Sections(); !reflect.DeepEqual(have, sections) {
+		t.Fatalf("decoded sections mismatch: have %v, want %v", have, sections)
+	}
+	// The bitmap has to round-trip through RLP as part of the LES handshake
+	blob, err := rlp.EncodeToBytes(HelperTrieCapabilities{AvailableChtSections: bitmap})
+	if err != nil {
+		t.Fatalf("failed to RLP encode bitmap: %v", err)
+	}
+	var caps HelperTrieCapabilities
+	if err := rlp.DecodeBytes(blob, &caps); err != nil {
+		t.Fatalf("failed to RLP decode bitmap: %v", err)
+	}
+	if have := caps.AvailableChtSections.Encode(); !bytes.Equal(have, enc) {
+		t.Fatalf("RLP round-trip mismatch: have %x, want %x", have, enc)
+	}
+	if err := decoded.Decode([]byte{0x01, 0x00}); err != errNonCanonicalBitmap {
+		t.Fatalf("trailing zero byte: have %v, want %v", err, errNonCanonicalBitmap)
+	}
+}
+
+func TestBloomTrieSectionBitmapEncoding(t *testing.T) {
+	var bitmap BloomTrieSectionBitmap
+	sections := []uint64{1, 2, 15, 16, 200}
+	for _, section := range sections {
+		bitmap.Set(section)
+	}
+	for _, section := range []uint64{0, 3, 14, 17, 201} {
+		if bitmap.IsSet(section) {
+			t.Errorf("section %d unexpectedly set", section)
+		}
+	}
+	var decoded BloomTrieSectionBitmap
+	if err := decoded.Decode(bitmap.Encode()); err != nil {
+		t.Fatalf("failed to decode bitmap: %v", err)
+	}
+	if have := decoded.Sections(); !reflect.DeepEqual(have, sections) {
+		t.Fatalf("decoded sections mismatch: have %v, want %v", have, sections)
+	}
+	blob, err := rlp.EncodeToBytes(HelperTrieCapabilities{AvailableBloomTrieSections: bitmap})
+	if err != nil {
+		t.Fatalf("failed to RLP encode bitmap: %v", err)
+	}
+	var caps HelperTrieCapabilities
+	if err := rlp.DecodeBytes(blob, &caps); err != nil {
+		t.Fatalf("failed to RLP decode bitmap: %v", err)
+	}
+	if have := caps.AvailableBloomTrieSections.Sections(); !reflect.DeepEqual(have, sections) {
+		t.Fatalf("RLP round-trip mismatch: have %v, want %v", have, sections)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/hashicorp/golang-lru"
+)
+
+// bloomCacheKey identifies a bloom bit vector of a single bloom bits section.
+type bloomCacheKey struct {
+	bit     uint
+	section uint64
+}
+
+// bloomCacheEntry is a cached decompressed bit vector along with the section head
+// it belongs to, so entries of reorged sections are not served.
+type bloomCacheEntry struct {
+	head common.Hash
+	data []byte
+}
+
+// BloomTrieReadCache is an LRU cache of decompressed bloom bit vectors, keyed by
+// bit index and bloom bits section. A nil cache is valid and caches nothing.
+type BloomTrieReadCache struct {
+	cache *lru.Cache
+}
+
+// NewBloomTrieReadCache creates a cache holding at most size bit vectors.
+func NewBloomTrieReadCache(size int) *BloomTrieReadCache {
+	cache, _ := lru.New(size)
+	return &BloomTrieReadCache{cache: cache}
+}
+
+// Get retrieves the decompressed bit vector of the given bit and section if it
+// is cached for the given section head.
+func (c *BloomTrieReadCache) Get(bit uint, section uint64, head common.Hash) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if entry, ok := c.cache.Get(bloomCacheKey{bit, section}); ok && entry.(bloomCacheEntry).head == head {
+		return entry.(bloomCacheEntry).data, true
+	}
+	return nil, false
+}
+
+// Add inserts a decompressed bit vector into the cache.
+func (c *BloomTrieReadCache) Add(bit uint, section uint64, head common.Hash, data []byte) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(bloomCacheKey{bit, section}, bloomCacheEntry{head, data})
+}
+
+// Len returns the number of cached bit vectors.
+func (c *BloomTrieReadCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return c.cache.Len()
+}
+
+// GetDecompressedBloomBits retrieves the bloom bit vectors of the given bit index
+// in the given BloomTrie sections like GetBloomBits, but returns them decompressed.
+// Vectors of sections with a known canonical head are served from and added to
+// the cache, so repeated log filtering over the same range does not decompress
+// them again. The cache may be nil.
+func GetDecompressedBloomBits(ctx context.Context, odr OdrBackend, cache *BloomTrieReadCache, bitIdx uint, sectionIdxList []uint64) ([][]byte, error) {
+	var (
+		db      = odr.Database()
+		result  = make([][]byte, len(sectionIdxList))
+		heads   = make([]common.Hash, len(sectionIdxList))
+		reqList []uint64
+		reqIdx  []int
+	)
+	for i, sectionIdx := range sectionIdxList {
+		heads[i] = rawdb.ReadCanonicalHash(db, (sectionIdx+1)*BloomTrieFrequency-1)
+		if data, ok := cache.Get(bitIdx, sectionIdx, heads[i]); ok {
+			result[i] = data
+			continue
+		}
+		reqList = append(reqList, sectionIdx)
+		reqIdx = append(reqIdx, i)
+	}
+	if reqList == nil {
+		return result, nil
+	}
+	compVectors, err := GetBloomBits(ctx, odr, bitIdx, reqList)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range reqIdx {
+		data, err := bitutil.DecompressBytes(compVectors[j], int(BloomTrieFrequency/8))
+		if err != nil {
+			return nil, err
+		}
+		result[i] = data
+		// Vectors retrieved without a known section head can't be told apart after a reorg
+		if heads[i] != (common.Hash{}) {
+			cache.Add(bitIdx, sectionIdxList[i], heads[i], data)
+		}
+	}
+	return result, nil
+}
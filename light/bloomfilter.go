@@ -0,0 +1,132 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"sort"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+// HistoricalBloomFilter answers whether logs of an address and topics may have
+// been emitted anywhere in the history covered by the stored BloomTrie sections,
+// without filtering the sections block by block.
+type HistoricalBloomFilter struct {
+	odr OdrBackend // Backend retrieving the bloom bits not available locally (nil = local only)
+}
+
+// NewHistoricalBloomFilter creates a historical bloom filter. If odr is not nil,
+// bloom bits missing from the local BloomTries are retrieved through it.
+func NewHistoricalBloomFilter(odr OdrBackend) *HistoricalBloomFilter {
+	return &HistoricalBloomFilter{odr: odr}
+}
+
+// MatchesAnySection returns the stored BloomTrie sections, in ascending order, in
+// which at least one block bloom contains the address along with all the topics.
+// Like any bloom filter match, a matching section may be a false positive. For
+// sections with a known canonical head, only the canonical BloomTrie is checked.
+func (f *HistoricalBloomFilter) MatchesAnySection(ctx context.Context, address common.Address, topics []common.Hash, db ethdb.Database) ([]uint64, error) {
+	// Collect the bloom bit indexes all matching blooms have to contain
+	keys := [][]byte{address.Bytes()}
+	for _, topic := range topics {
+		keys = append(keys, topic.Bytes())
+	}
+	var bits []uint
+	seen := make(map[uint]bool)
+	for _, key := range keys {
+		for _, bit := range bloomIndexes(key) {
+			if !seen[bit] {
+				seen[bit] = true
+				bits = append(bits, bit)
+			}
+		}
+	}
+	// Match the bit vectors of each stored section
+	type sectionRef struct {
+		section uint64
+		head    common.Hash
+	}
+	var refs []sectionRef
+	err := iterateWithPrefix(db, bloomTriePrefix, func(key, value []byte) error {
+		section, head, err := bloomTrieKeyEncoder.Decode(key)
+		if err != nil {
+			return err
+		}
+		if canonical := rawdb.ReadCanonicalHash(db, (section+1)*BloomTrieFrequency-1); canonical != (common.Hash{}) && canonical != head {
+			return nil
+		}
+		refs = append(refs, sectionRef{section, head})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var matches []uint64
+	for _, ref := range refs {
+		match, err := f.matchSection(ctx, db, bits, ref.section, ref.head)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			matches = append(matches, ref.section)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i] < matches[j] })
+	return matches, nil
+}
+
+// matchSection reports whether any block of a BloomTrie section has all the given
+// bloom bits set.
+func (f *HistoricalBloomFilter) matchSection(ctx context.Context, db ethdb.Database, bits []uint, section uint64, head common.Hash) (bool, error) {
+	var vector []byte
+	for _, bit := range bits {
+		comp, err := BloomBitsLookup(ctx, db, bit, section, head, f.odr)
+		if err != nil {
+			return false, err
+		}
+		bitset, err := bitutil.DecompressBytes(comp, BloomTrieFrequency/8)
+		if err != nil {
+			return false, err
+		}
+		if vector == nil {
+			vector = bitset
+		} else {
+			bitutil.ANDBytes(vector, vector, bitset)
+		}
+		if !bitutil.TestBytes(vector) {
+			return false, nil
+		}
+	}
+	return vector != nil, nil
+}
+
+// bloomIndexes returns the bloom filter bit indexes belonging to the given key,
+// like the bloombits matcher does.
+func bloomIndexes(key []byte) [3]uint {
+	hash := crypto.Keccak256(key)
+
+	var idxs [3]uint
+	for i := 0; i < len(idxs); i++ {
+		idxs[i] = (uint(hash[2*i])<<8)&2047 + uint(hash[2*i+1])
+	}
+	return idxs
+}
@@ -0,0 +1,205 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var errBuilderNoSection = errors.New("no section being built")
+
+// BloomTrieBuilder builds BloomTrie sections from the bloom bits stored in a
+// database without running a chain indexer, e.g. for offline tools. Headers of
+// a single section are fed through Process, after which Commit stores the section
+// the same way the BloomTrie indexer does.
+type BloomTrieBuilder struct {
+	backend *BloomTrieIndexerBackend
+	open    bool  // Whether a section is being built
+	err     error // First error encountered while building the current section
+
+	committed   bool        // Whether a section has been committed yet
+	lastSection uint64      // Index of the last committed section
+	lastHead    common.Hash // Head of the last committed section
+}
+
+// NewBloomTrieBuilder creates a builder reading bloom bits from and storing the
+// BloomTrie sections into db. The client mode selects the size of the bloom bits
+// sections the entries are assembled from, like in NewBloomTrieIndexer.
+func NewBloomTrieBuilder(db ethdb.Database, clientMode bool) *BloomTrieBuilder {
+	return &BloomTrieBuilder{backend: newBloomTrieIndexerBackend(db, clientMode)}
+}
+
+// Process adds a header to the section being built, starting a new section with
+// the section of the header if none is open. Only the bloom bits section heads
+// are needed, other headers are ignored. Errors are reported by Commit.
+func (b *BloomTrieBuilder) Process(header *types.Header) {
+	if b.err != nil {
+		return
+	}
+	section := BloomTrieSectionFromBlock(header.Number.Uint64())
+	if !b.open {
+		var prevHead common.Hash
+		if section > 0 {
+			if b.committed && b.lastSection == section-1 {
+				prevHead = b.lastHead
+			} else {
+				prevHead = rawdb.ReadCanonicalHash(b.backend.diskdb, section*BloomTrieFrequency-1)
+			}
+		}
+		if b.err = b.backend.Reset(section, prevHead); b.err != nil {
+			return
+		}
+		b.open = true
+	} else if section != b.backend.section {
+		b.err = fmt.Errorf("header #%d outside of bloom trie section %d", header.Number, b.backend.section)
+		return
+	}
+	b.backend.Process(header)
+}
+
+// Commit stores the BloomTrie of the section being built and returns its root.
+// The builder is ready to build another section afterwards, even if the commit
+// failed.
+func (b *BloomTrieBuilder) Commit() (common.Hash, error) {
+	if !b.open {
+		return common.Hash{}, errBuilderNoSection
+	}
+	err := b.err
+	b.open, b.err = false, nil
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for i, head := range b.backend.sectionHeads {
+		if head == (common.Hash{}) {
+			return common.Hash{}, fmt.Errorf("missing head of bloom bits section %d", b.backend.section*b.backend.bloomTrieRatio+uint64(i))
+		}
+	}
+	if err := b.backend.Commit(); err != nil {
+		return common.Hash{}, err
+	}
+	b.committed = true
+	b.lastSection = b.backend.section
+	b.lastHead = b.backend.sectionHeads[b.backend.bloomTrieRatio-1]
+	return b.backend.Stats().Root, nil
+}
+
+// chtBuilderEntry is a CHT entry buffered by ChtBuilder until the section is committed.
+type chtBuilderEntry struct {
+	key  [8]byte
+	node []byte
+}
+
+// ChtBuilder builds CHT sections from headers and total difficulties supplied by
+// the caller, without running a chain indexer, e.g. for offline tools. The stored
+// sections are identical to the ones built by the CHT indexer with the same
+// section size.
+type ChtBuilder struct {
+	sectionSize uint64
+	section     uint64            // Index of the section being built
+	prevHead    common.Hash       // Head of the section preceding the one being built
+	lastHash    common.Hash       // Hash of the last processed header
+	entries     []chtBuilderEntry // Entries of the section being built
+	err         error             // First error encountered while building the current section
+}
+
+// NewChtBuilder creates a CHT builder for sections of the given size.
+func NewChtBuilder(sectionSize uint64) *ChtBuilder {
+	return &ChtBuilder{sectionSize: sectionSize}
+}
+
+// Process adds the entry of a header with the given total difficulty to the
+// section being built. Headers have to be processed in order starting from the
+// first block of a section. Errors are reported by Commit.
+func (b *ChtBuilder) Process(header *types.Header, td *big.Int) {
+	if b.err != nil {
+		return
+	}
+	num := header.Number.Uint64()
+	if len(b.entries) == 0 {
+		if num%b.sectionSize != 0 {
+			b.err = fmt.Errorf("header #%d not at the start of a CHT section", num)
+			return
+		}
+		b.section, b.prevHead = num/b.sectionSize, header.ParentHash
+	} else if want := ChtSectionStartBlock(b.section, b.sectionSize) + uint64(len(b.entries)); num != want {
+		b.err = fmt.Errorf("non-contiguous header #%d, want #%d", num, want)
+		return
+	}
+	if uint64(len(b.entries)) == b.sectionSize {
+		b.err = fmt.Errorf("header #%d outside of CHT section %d", num, b.section)
+		return
+	}
+	b.lastHash = header.Hash()
+	data, err := rlp.EncodeToBytes(ChtNode{b.lastHash, td})
+	if err != nil {
+		b.err = err
+		return
+	}
+	b.entries = append(b.entries, chtBuilderEntry{ComputeChtKey(num), data})
+}
+
+// Commit stores the CHT of the section being built along with its trie nodes into
+// db and returns its root. The CHT of the previous section has to be available in
+// db already, so all sections of a chain have to be committed into the same
+// database. The builder is ready to build another section afterwards, even if the
+// commit failed.
+func (b *ChtBuilder) Commit(db ethdb.Database) (common.Hash, error) {
+	entries, err := b.entries, b.err
+	b.entries, b.err = nil, nil
+
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if len(entries) == 0 {
+		return common.Hash{}, errBuilderNoSection
+	}
+	if uint64(len(entries)) != b.sectionSize {
+		return common.Hash{}, fmt.Errorf("incomplete CHT section %d: processed %d of %d blocks", b.section, len(entries), b.sectionSize)
+	}
+	var prevRoot common.Hash
+	if b.section > 0 {
+		if prevRoot = GetChtRoot(db, b.section-1, b.prevHead); prevRoot == (common.Hash{}) {
+			return common.Hash{}, fmt.Errorf("no CHT root stored for previous section %d", b.section-1)
+		}
+	}
+	triedb := trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix))
+	t, err := trie.New(prevRoot, triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for _, entry := range entries {
+		t.Update(entry.key[:], entry.node)
+	}
+	root, err := t.Commit(nil)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := triedb.Commit(root, false); err != nil {
+		return common.Hash{}, err
+	}
+	StoreChtRoot(db, b.section, b.lastHash, root)
+	return root, nil
+}
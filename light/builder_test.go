@@ -0,0 +1,148 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+	"testing/quick"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+// Tests that the standalone bloom trie builder produces the same sections as the
+// BloomTrie indexer backend.
+func TestBloomTrieBuilder(t *testing.T) {
+	var (
+		builderDb = ethdb.NewMemDatabase()
+		backendDb = ethdb.NewMemDatabase()
+		builder   = NewBloomTrieBuilder(builderDb, false)
+		backend   = newTestBloomTrieBackend(backendDb, ethBloomBitsSection)
+		lastHead  common.Hash
+	)
+	if _, err := builder.Commit(); err != errBuilderNoSection {
+		t.Fatalf("empty commit: have %v, want %v", err, errBuilderNoSection)
+	}
+	for section := uint64(0); section < 2; section++ {
+		heads := makeTestBloomSection(builderDb, section, ethBloomBitsSection)
+		makeTestBloomSection(backendDb, section, ethBloomBitsSection)
+
+		for _, head := range heads {
+			builder.Process(head)
+		}
+		root, err := builder.Commit()
+		if err != nil {
+			t.Fatalf("section %d: failed to commit: %v", section, err)
+		}
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+
+		if want := GetBloomTrieRoot(backendDb, section, lastHead); root != want {
+			t.Fatalf("section %d: root mismatch: have %x, want %x", section, root, want)
+		}
+		if stored := GetBloomTrieRoot(builderDb, section, lastHead); stored != root {
+			t.Fatalf("section %d: stored root mismatch: have %x, want %x", section, stored, root)
+		}
+	}
+	// Headers of different sections must not be mixed, nor sections left incomplete
+	heads := makeTestBloomSection(builderDb, 2, ethBloomBitsSection)
+	builder.Process(heads[0])
+	builder.Process(&types.Header{Number: big.NewInt(3*BloomTrieFrequency + ethBloomBitsSection - 1)})
+	if _, err := builder.Commit(); err == nil {
+		t.Fatalf("mixed sections committed")
+	}
+	builder.Process(heads[0])
+	if _, err := builder.Commit(); err == nil {
+		t.Fatalf("incomplete section committed")
+	}
+}
+
+// Tests that the standalone CHT builder produces the same roots as the CHT
+// indexer backend for random section sizes and chain lengths.
+func TestChtBuilderMatchesIndexer(t *testing.T) {
+	check := func(size, count uint8) bool {
+		sectionSize, sections := uint64(size%64)+1, uint64(count%4)+1
+
+		backendDb := ethdb.NewMemDatabase()
+		headers := makeTestHeaderChain(backendDb, sections*sectionSize)
+		backend := newTestChtBackend(backendDb, sectionSize)
+
+		builderDb := ethdb.NewMemDatabase()
+		builder := NewChtBuilder(sectionSize)
+
+		var lastHead common.Hash
+		for section := uint64(0); section < sections; section++ {
+			processChtSection(t, backend, headers, section, lastHead)
+			lastHead = headers[(section+1)*sectionSize-1].Hash()
+
+			for _, header := range headers[section*sectionSize : (section+1)*sectionSize] {
+				builder.Process(header, rawdb.ReadTd(backendDb, header.Hash(), header.Number.Uint64()))
+			}
+			root, err := builder.Commit(builderDb)
+			if err != nil {
+				t.Logf("section %d/%d: failed to commit: %v", section, sectionSize, err)
+				return false
+			}
+			if want := GetChtRoot(backendDb, section, lastHead); root != want {
+				t.Logf("section %d/%d: root mismatch: have %x, want %x", section, sectionSize, root, want)
+				return false
+			}
+			if stored := GetChtRoot(builderDb, section, lastHead); stored != root {
+				t.Logf("section %d/%d: stored root mismatch: have %x, want %x", section, sectionSize, stored, root)
+				return false
+			}
+		}
+		return true
+	}
+	if err := quick.Check(check, &quick.Config{MaxCount: 20}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChtBuilderInvalidInput(t *testing.T) {
+	headers := makeTestHeaderChain(ethdb.NewMemDatabase(), 8)
+	builder := NewChtBuilder(4)
+	td := big.NewInt(1)
+
+	if _, err := builder.Commit(ethdb.NewMemDatabase()); err != errBuilderNoSection {
+		t.Fatalf("empty commit: have %v, want %v", err, errBuilderNoSection)
+	}
+	// Sections have to start at a section boundary and be contiguous and complete
+	builder.Process(headers[1], td)
+	if _, err := builder.Commit(ethdb.NewMemDatabase()); err == nil {
+		t.Fatalf("unaligned section committed")
+	}
+	builder.Process(headers[0], td)
+	builder.Process(headers[2], td)
+	if _, err := builder.Commit(ethdb.NewMemDatabase()); err == nil {
+		t.Fatalf("non-contiguous section committed")
+	}
+	builder.Process(headers[0], td)
+	if _, err := builder.Commit(ethdb.NewMemDatabase()); err == nil {
+		t.Fatalf("incomplete section committed")
+	}
+	// Later sections need the previous one in the database
+	for _, header := range headers[4:] {
+		builder.Process(header, td)
+	}
+	if _, err := builder.Commit(ethdb.NewMemDatabase()); err == nil {
+		t.Fatalf("section committed without its predecessor")
+	}
+}
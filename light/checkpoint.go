@@ -0,0 +1,615 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/log"
+	"github.com/akroma-project/akroma/rlp"
+)
+
+// genesisCheckpointMagic prefixes a trusted checkpoint embedded in the extra data
+// of a genesis block.
+var genesisCheckpointMagic = []byte("akroma-checkpoint")
+
+var (
+	ErrCheckpointHeadUnknown  = errors.New("checkpoint section head not in local chain")
+	ErrCheckpointHeadMismatch = errors.New("checkpoint section head does not match local canonical chain")
+	ErrCheckpointNoLocalCht   = errors.New("no local CHT root for checkpoint section")
+	ErrCheckpointChtMismatch  = errors.New("checkpoint CHT root does not match local CHT root")
+	ErrNoGenesisCheckpoint    = errors.New("no checkpoint embedded in genesis")
+	ErrNoSignedCheckpoint     = errors.New("no signed checkpoint stored")
+	ErrCheckpointRollback     = errors.New("checkpoint section older than registered checkpoint")
+	ErrCheckpointConflict     = errors.New("different checkpoint registered for the same section")
+	ErrNoCommittedCheckpoint  = errors.New("no committed CHT and BloomTrie section to export")
+)
+
+// Checkpoints are usually verified against the chain of a light server, which
+// runs a full blockchain.
+var _ HeaderChainReader = (*core.BlockChain)(nil)
+
+// TrustedCheckpointSet holds the trusted checkpoints of a single chain, published
+// at different sections.
+type TrustedCheckpointSet struct {
+	checkpoints []TrustedCheckpoint // Checkpoints sorted by section index
+}
+
+// NewTrustedCheckpointSet creates a set of the given checkpoints.
+func NewTrustedCheckpointSet(cps ...TrustedCheckpoint) *TrustedCheckpointSet {
+	set := new(TrustedCheckpointSet)
+	for _, cp := range cps {
+		set.Add(cp)
+	}
+	return set
+}
+
+// Add inserts a checkpoint into the set.
+func (s *TrustedCheckpointSet) Add(cp TrustedCheckpoint) {
+	i := sort.Search(len(s.checkpoints), func(i int) bool { return s.checkpoints[i].sectionIdx > cp.sectionIdx })
+	s.checkpoints = append(s.checkpoints, TrustedCheckpoint{})
+	copy(s.checkpoints[i+1:], s.checkpoints[i:])
+	s.checkpoints[i] = cp
+}
+
+// Best returns the checkpoint of the highest section in the set. A nil set is
+// treated as an empty one.
+func (s *TrustedCheckpointSet) Best() (TrustedCheckpoint, bool) {
+	if s == nil || len(s.checkpoints) == 0 {
+		return TrustedCheckpoint{}, false
+	}
+	return s.checkpoints[len(s.checkpoints)-1], true
+}
+
+// find returns the checkpoint of the given section in the set, if any.
+func (s *TrustedCheckpointSet) find(sectionIdx uint64) (TrustedCheckpoint, bool) {
+	if s == nil {
+		return TrustedCheckpoint{}, false
+	}
+	for _, cp := range s.checkpoints {
+		if cp.sectionIdx == sectionIdx {
+			return cp, true
+		}
+	}
+	return TrustedCheckpoint{}, false
+}
+
+// Checkpoints returns the checkpoints of the set, sorted by section index. A nil
+// set is treated as an empty one.
+func (s *TrustedCheckpointSet) Checkpoints() []TrustedCheckpoint {
+	if s == nil {
+		return nil
+	}
+	return append([]TrustedCheckpoint(nil), s.checkpoints...)
+}
+
+// TrustedCheckpointVerifier validates checkpoints received from untrusted
+// sources against the locally available chain and CHT data.
+type TrustedCheckpointVerifier struct {
+	db ethdb.Database
+}
+
+// NewTrustedCheckpointVerifier creates a verifier checking checkpoints against the
+// CHT roots stored in db.
+func NewTrustedCheckpointVerifier(db ethdb.Database) *TrustedCheckpointVerifier {
+	return &TrustedCheckpointVerifier{db: db}
+}
+
+// Verify checks that the checkpoint is complete, that its section head is the
+// canonical header at the end of the checkpoint section and that its CHT root
+// matches the one built locally for the same section.
+func (v *TrustedCheckpointVerifier) Verify(cp TrustedCheckpoint, chain HeaderChainReader) error {
+	if err := cp.Validate(); err != nil {
+		return err
+	}
+	header := chain.GetHeaderByNumber(ChtSectionHeadBlock(cp.sectionIdx, CHTFrequencyClient))
+	if header == nil {
+		return ErrCheckpointHeadUnknown
+	}
+	if header.Hash() != cp.sectionHead {
+		return ErrCheckpointHeadMismatch
+	}
+	root := GetChtV2Root(v.db, cp.sectionIdx, cp.sectionHead)
+	if root == (common.Hash{}) {
+		return ErrCheckpointNoLocalCht
+	}
+	if root != cp.chtRoot {
+		return ErrCheckpointChtMismatch
+	}
+	return nil
+}
+
+// CheckpointAnnotation contains human-readable metadata of a checkpoint section
+// head for operators to cross-check. It is informational only, checkpoints are
+// verified and used without regard to it.
+type CheckpointAnnotation struct {
+	BlockTime   uint64 `json:"blockTime"`
+	GasLimit    uint64 `json:"gasLimit"`
+	Description string `json:"description"`
+}
+
+// AnnotateCheckpoint attaches the metadata of header, which should be the section
+// head of the checkpoint, along with a description to the checkpoint.
+func AnnotateCheckpoint(cp *TrustedCheckpoint, header *types.Header, desc string) {
+	cp.annotation = &CheckpointAnnotation{
+		BlockTime:   header.Time.Uint64(),
+		GasLimit:    header.GasLimit,
+		Description: desc,
+	}
+}
+
+// ImportCheckpointFromChain assembles a checkpoint of the given LES/2 section from
+// the CHT and BloomTrie roots built locally by a light server.
+func ImportCheckpointFromChain(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) (*TrustedCheckpoint, error) {
+	cp := &TrustedCheckpoint{
+		name:          "local",
+		sectionIdx:    sectionIdx,
+		sectionHead:   sectionHead,
+		chtRoot:       GetChtV2Root(db, sectionIdx, sectionHead),
+		bloomTrieRoot: GetBloomTrieRoot(db, sectionIdx, sectionHead),
+	}
+	if cp.chtRoot == (common.Hash{}) {
+		return nil, ErrNoTrustedCht
+	}
+	if cp.bloomTrieRoot == (common.Hash{}) {
+		return nil, ErrNoTrustedBloomTrie
+	}
+	if err := cp.Validate(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// GetChtRootOrCheckpoint reads the CHT root of the given section from the database,
+// falling back to the trusted checkpoints of the chain with the given genesis hash,
+// built-in or registered in db, if no root is stored locally. The returned flag reports whether the checkpoint
+// was used. Like the light chain, the checkpoint is matched against the section
+// index the way it is stored by addTrustedCheckpoint.
+func GetChtRootOrCheckpoint(db ethdb.Database, genesisHash common.Hash, sectionIdx uint64, sectionHead common.Hash) (common.Hash, bool, error) {
+	if root := GetChtRoot(db, sectionIdx, sectionHead); root != (common.Hash{}) {
+		return root, false, nil
+	}
+	for _, cp := range NewCheckpointRegistry(db).Checkpoints(genesisHash) {
+		if cp.sectionIdx == sectionIdx && cp.sectionHead == sectionHead {
+			return cp.chtRoot, true, nil
+		}
+	}
+	return common.Hash{}, false, ErrNoTrustedCht
+}
+
+// EstimateTimeToCheckpoint estimates the time needed to advance from the current
+// to the target section, given the rate of committed sections per second. It is
+// zero if the target is already reached, and the maximum duration if the rate is
+// not positive.
+func EstimateTimeToCheckpoint(current, target uint64, sectionCommitRate float64) time.Duration {
+	if current >= target {
+		return 0
+	}
+	if sectionCommitRate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	seconds := float64(target-current) / sectionCommitRate
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// CheckpointInfo describes a trusted checkpoint known to the node.
+type CheckpointInfo struct {
+	Name          string      `json:"name"`
+	GenesisHash   common.Hash `json:"genesisHash"`
+	SectionIdx    uint64      `json:"sectionIdx"`
+	SectionHead   common.Hash `json:"sectionHead"`
+	ChtRoot       common.Hash `json:"chtRoot"`
+	BloomTrieRoot common.Hash `json:"bloomTrieRoot"`
+
+	Annotation *CheckpointAnnotation `json:"annotation,omitempty"`
+}
+
+// TrustedCheckpointInfos returns all trusted checkpoints known to the node, the
+// built-in ones and the ones registered in db, sorted by name.
+func TrustedCheckpointInfos(db ethdb.Database) []*CheckpointInfo {
+	registry := NewCheckpointRegistry(db)
+	registry.lock.RLock()
+	defer registry.lock.RUnlock()
+
+	infos := make([]*CheckpointInfo, 0, len(registry.checkpoints))
+	for genesis, set := range registry.checkpoints {
+		for _, cp := range set.Checkpoints() {
+			infos = append(infos, &CheckpointInfo{
+				Name:          cp.name,
+				GenesisHash:   genesis,
+				SectionIdx:    cp.sectionIdx,
+				SectionHead:   cp.sectionHead,
+				ChtRoot:       cp.chtRoot,
+				BloomTrieRoot: cp.bloomTrieRoot,
+				Annotation:    cp.annotation,
+			})
+		}
+	}
+	sort.SliceStable(infos, func(i, j int) bool {
+		if infos[i].Name != infos[j].Name {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].SectionIdx < infos[j].SectionIdx
+	})
+	return infos
+}
+
+// checkpointJSON is the JSON encoding of a trusted checkpoint.
+type checkpointJSON struct {
+	Name          string                `json:"name"`
+	SectionIdx    uint64                `json:"sectionIdx"`
+	SectionHead   common.Hash           `json:"sectionHead"`
+	ChtRoot       common.Hash           `json:"chtRoot"`
+	BloomTrieRoot common.Hash           `json:"bloomTrieRoot"`
+	Annotation    *CheckpointAnnotation `json:"annotation,omitempty"`
+}
+
+// CheckpointToJSON encodes a checkpoint into JSON, e.g. to publish it or to copy
+// it into the configuration of another node.
+func CheckpointToJSON(cp TrustedCheckpoint) ([]byte, error) {
+	return json.Marshal(&checkpointJSON{cp.name, cp.sectionIdx, cp.sectionHead, cp.chtRoot, cp.bloomTrieRoot, cp.annotation})
+}
+
+// MarshalJSON implements json.Marshaler, encoding the checkpoint like
+// CheckpointToJSON.
+func (cp TrustedCheckpoint) MarshalJSON() ([]byte, error) {
+	return CheckpointToJSON(cp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding and validating the
+// checkpoint like ParseCheckpointFromJSON.
+func (cp *TrustedCheckpoint) UnmarshalJSON(data []byte) error {
+	dec, err := ParseCheckpointFromJSON(data)
+	if err != nil {
+		return err
+	}
+	*cp = *dec
+	return nil
+}
+
+// ParseCheckpointFromJSON decodes and validates a checkpoint encoded by
+// CheckpointToJSON.
+func ParseCheckpointFromJSON(data []byte) (*TrustedCheckpoint, error) {
+	var dec checkpointJSON
+	if err := json.Unmarshal(data, &dec); err != nil {
+		return nil, err
+	}
+	cp := &TrustedCheckpoint{
+		name:          dec.Name,
+		sectionIdx:    dec.SectionIdx,
+		sectionHead:   dec.SectionHead,
+		chtRoot:       dec.ChtRoot,
+		bloomTrieRoot: dec.BloomTrieRoot,
+		annotation:    dec.Annotation,
+	}
+	if err := cp.Validate(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// checkpointRLP is the RLP encoding of a trusted checkpoint.
+type checkpointRLP struct {
+	Name          string
+	SectionIdx    uint64
+	SectionHead   common.Hash
+	ChtRoot       common.Hash
+	BloomTrieRoot common.Hash
+}
+
+// EncodeRLP implements rlp.Encoder. The annotation is informational and not
+// encoded.
+func (cp TrustedCheckpoint) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, &checkpointRLP{cp.name, cp.sectionIdx, cp.sectionHead, cp.chtRoot, cp.bloomTrieRoot})
+}
+
+// DecodeRLP implements rlp.Decoder.
+func (cp *TrustedCheckpoint) DecodeRLP(s *rlp.Stream) error {
+	var dec checkpointRLP
+	if err := s.Decode(&dec); err != nil {
+		return err
+	}
+	*cp = TrustedCheckpoint{
+		name:          dec.Name,
+		sectionIdx:    dec.SectionIdx,
+		sectionHead:   dec.SectionHead,
+		chtRoot:       dec.ChtRoot,
+		bloomTrieRoot: dec.BloomTrieRoot,
+	}
+	return nil
+}
+
+// TrustedCheckpointHash returns a fingerprint of the section index, section head
+// and trie roots of a checkpoint, suitable for signing it. The descriptive name
+// and annotation are not part of the fingerprint.
+func TrustedCheckpointHash(cp TrustedCheckpoint) common.Hash {
+	enc, err := rlp.EncodeToBytes([]interface{}{cp.sectionIdx, cp.sectionHead, cp.chtRoot, cp.bloomTrieRoot})
+	if err != nil {
+		panic(err) // can't fail for fixed size fields
+	}
+	return crypto.Keccak256Hash(enc)
+}
+
+// NewGenesisWithCheckpoint returns a copy of the genesis specification with the
+// given checkpoint embedded in its extra data, replacing any previous content.
+// It must not be used with engines interpreting the genesis extra data (clique).
+func NewGenesisWithCheckpoint(g *core.Genesis, cp *TrustedCheckpoint) *core.Genesis {
+	enc, err := rlp.EncodeToBytes(&checkpointRLP{cp.name, cp.sectionIdx, cp.sectionHead, cp.chtRoot, cp.bloomTrieRoot})
+	if err != nil {
+		panic(err) // can't fail for fixed size fields and a string
+	}
+	genesis := *g
+	genesis.ExtraData = append(append([]byte{}, genesisCheckpointMagic...), enc...)
+	return &genesis
+}
+
+// ParseCheckpointFromGenesis extracts a checkpoint embedded into the genesis
+// specification by NewGenesisWithCheckpoint.
+func ParseCheckpointFromGenesis(g *core.Genesis) (*TrustedCheckpoint, error) {
+	if !bytes.HasPrefix(g.ExtraData, genesisCheckpointMagic) {
+		return nil, ErrNoGenesisCheckpoint
+	}
+	var dec checkpointRLP
+	if err := rlp.DecodeBytes(g.ExtraData[len(genesisCheckpointMagic):], &dec); err != nil {
+		return nil, err
+	}
+	cp := &TrustedCheckpoint{
+		name:          dec.Name,
+		sectionIdx:    dec.SectionIdx,
+		sectionHead:   dec.SectionHead,
+		chtRoot:       dec.ChtRoot,
+		bloomTrieRoot: dec.BloomTrieRoot,
+	}
+	if err := cp.Validate(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// SignedCheckpoint is a trusted checkpoint of a chain obtained from an external
+// source, along with the signature it was published with. The signature is kept
+// opaque so that it can be re-verified by its source after a restart.
+type SignedCheckpoint struct {
+	GenesisHash common.Hash
+	Checkpoint  TrustedCheckpoint
+	Signature   []byte
+}
+
+// signedCheckpointRLP is the RLP encoding of a signed checkpoint.
+type signedCheckpointRLP struct {
+	GenesisHash common.Hash
+	Checkpoint  checkpointRLP
+	Signature   []byte
+}
+
+// StoreCheckpointWithSignature persists a signed checkpoint, replacing any
+// checkpoint previously stored for the same chain.
+func StoreCheckpointWithSignature(db ethdb.Database, cp SignedCheckpoint) error {
+	if err := cp.Checkpoint.Validate(); err != nil {
+		return err
+	}
+	c := cp.Checkpoint
+	enc, err := rlp.EncodeToBytes(&signedCheckpointRLP{
+		GenesisHash: cp.GenesisHash,
+		Checkpoint:  checkpointRLP{c.name, c.sectionIdx, c.sectionHead, c.chtRoot, c.bloomTrieRoot},
+		Signature:   cp.Signature,
+	})
+	if err != nil {
+		return err
+	}
+	return db.Put(append(append([]byte{}, signedCheckpointPrefix...), cp.GenesisHash.Bytes()...), enc)
+}
+
+// LoadCheckpointWithSignature retrieves the signed checkpoint stored for the
+// chain with the given genesis hash. The signature is not verified.
+func LoadCheckpointWithSignature(db ethdb.Database, genesisHash common.Hash) (*SignedCheckpoint, error) {
+	data, _ := db.Get(append(append([]byte{}, signedCheckpointPrefix...), genesisHash.Bytes()...))
+	if len(data) == 0 {
+		return nil, ErrNoSignedCheckpoint
+	}
+	var dec signedCheckpointRLP
+	if err := rlp.DecodeBytes(data, &dec); err != nil {
+		return nil, err
+	}
+	cp := &SignedCheckpoint{
+		GenesisHash: dec.GenesisHash,
+		Checkpoint: TrustedCheckpoint{
+			name:          dec.Checkpoint.Name,
+			sectionIdx:    dec.Checkpoint.SectionIdx,
+			sectionHead:   dec.Checkpoint.SectionHead,
+			chtRoot:       dec.Checkpoint.ChtRoot,
+			bloomTrieRoot: dec.Checkpoint.BloomTrieRoot,
+		},
+		Signature: dec.Signature,
+	}
+	if err := cp.Checkpoint.Validate(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// CheckpointRegistry holds the trusted checkpoints of all known chains: the
+// built-in ones and the ones registered at runtime, which are persisted in the
+// database. It is safe for concurrent use.
+type CheckpointRegistry struct {
+	db          ethdb.Database
+	checkpoints map[common.Hash]*TrustedCheckpointSet // Checkpoints keyed by genesis hash
+	lock        sync.RWMutex
+}
+
+// NewCheckpointRegistry creates a registry of the built-in checkpoints merged with
+// the ones previously registered in db. Invalid stored entries are skipped.
+func NewCheckpointRegistry(db ethdb.Database) *CheckpointRegistry {
+	r := &CheckpointRegistry{
+		db:          db,
+		checkpoints: make(map[common.Hash]*TrustedCheckpointSet),
+	}
+	for genesis, set := range trustedCheckpoints {
+		r.checkpoints[genesis] = NewTrustedCheckpointSet(set.Checkpoints()...)
+	}
+	err := iterateWithPrefix(db, checkpointPrefix, func(key, value []byte) error {
+		genesis, cp, err := decodeRegisteredCheckpoint(key, value)
+		if err != nil {
+			log.Warn("Ignoring invalid registered checkpoint", "key", fmt.Sprintf("%x", key), "err", err)
+			return nil
+		}
+		// Built-in checkpoints take precedence over stored ones of the same section
+		if _, ok := r.checkpoints[genesis].find(cp.sectionIdx); !ok {
+			r.add(genesis, cp)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to load registered checkpoints", "err", err)
+	}
+	return r
+}
+
+// registeredCheckpointKey returns the database key of a registered checkpoint.
+func registeredCheckpointKey(genesisHash common.Hash, sectionIdx uint64) []byte {
+	key := make([]byte, len(checkpointPrefix)+common.HashLength+8)
+	copy(key, checkpointPrefix)
+	copy(key[len(checkpointPrefix):], genesisHash[:])
+	binary.BigEndian.PutUint64(key[len(checkpointPrefix)+common.HashLength:], sectionIdx)
+	return key
+}
+
+// decodeRegisteredCheckpoint decodes and validates a database entry written by
+// CheckpointRegistry.Register.
+func decodeRegisteredCheckpoint(key, value []byte) (common.Hash, TrustedCheckpoint, error) {
+	if len(key) != len(checkpointPrefix)+common.HashLength+8 {
+		return common.Hash{}, TrustedCheckpoint{}, errors.New("invalid key length")
+	}
+	genesis := common.BytesToHash(key[len(checkpointPrefix) : len(checkpointPrefix)+common.HashLength])
+
+	var cp TrustedCheckpoint
+	if err := rlp.DecodeBytes(value, &cp); err != nil {
+		return common.Hash{}, TrustedCheckpoint{}, err
+	}
+	if err := cp.Validate(); err != nil {
+		return common.Hash{}, TrustedCheckpoint{}, err
+	}
+	if section := binary.BigEndian.Uint64(key[len(key)-8:]); section != cp.sectionIdx {
+		return common.Hash{}, TrustedCheckpoint{}, fmt.Errorf("stored under section %d, not %d", section, cp.sectionIdx)
+	}
+	return genesis, cp, nil
+}
+
+// add inserts a checkpoint into the set of the given chain.
+func (r *CheckpointRegistry) add(genesisHash common.Hash, cp TrustedCheckpoint) {
+	set := r.checkpoints[genesisHash]
+	if set == nil {
+		set = NewTrustedCheckpointSet()
+		r.checkpoints[genesisHash] = set
+	}
+	set.Add(cp)
+}
+
+// Register validates and persists a checkpoint of the chain with the given
+// genesis hash. To prevent accidental rollbacks, a checkpoint older than the
+// latest one known for the chain is rejected, as is a different checkpoint of the
+// same section. Registering a known checkpoint again is a no-op.
+func (r *CheckpointRegistry) Register(genesisHash common.Hash, cp TrustedCheckpoint) error {
+	if err := cp.Validate(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	set := r.checkpoints[genesisHash]
+	if best, ok := set.Best(); ok && cp.sectionIdx < best.sectionIdx {
+		return ErrCheckpointRollback
+	}
+	if known, ok := set.find(cp.sectionIdx); ok {
+		if TrustedCheckpointHash(known) != TrustedCheckpointHash(cp) {
+			return ErrCheckpointConflict
+		}
+		return nil
+	}
+	enc, err := rlp.EncodeToBytes(cp)
+	if err != nil {
+		return err
+	}
+	if err := r.db.Put(registeredCheckpointKey(genesisHash, cp.sectionIdx), enc); err != nil {
+		return err
+	}
+	r.add(genesisHash, cp)
+	return nil
+}
+
+// Lookup returns the latest checkpoint known for the chain with the given genesis
+// hash.
+func (r *CheckpointRegistry) Lookup(genesisHash common.Hash) (TrustedCheckpoint, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.checkpoints[genesisHash].Best()
+}
+
+// Checkpoints returns all checkpoints known for the chain with the given genesis
+// hash, sorted by section index.
+func (r *CheckpointRegistry) Checkpoints(genesisHash common.Hash) []TrustedCheckpoint {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.checkpoints[genesisHash].Checkpoints()
+}
+
+// ExportLatest assembles a checkpoint of the chain with the given genesis hash from
+// the latest LES/2 section for which both a CHT and a BloomTrie root were committed
+// for the local canonical section head, like ImportCheckpointFromChain. The
+// checkpoint is named after the latest known one of the chain, if any. It returns
+// ErrNoCommittedCheckpoint if no such section exists.
+func (r *CheckpointRegistry) ExportLatest(genesisHash common.Hash) (TrustedCheckpoint, error) {
+	sections, err := listSections(r.db, bloomTriePrefix, bloomTrieKeyEncoder)
+	if err != nil {
+		return TrustedCheckpoint{}, err
+	}
+	for i := len(sections) - 1; i >= 0; i-- {
+		head := rawdb.ReadCanonicalHash(r.db, ChtSectionHeadBlock(sections[i], BloomTrieFrequency))
+		if head == (common.Hash{}) {
+			continue
+		}
+		cp, err := ImportCheckpointFromChain(r.db, sections[i], head)
+		if err != nil {
+			continue
+		}
+		if known, ok := r.Lookup(genesisHash); ok {
+			cp.name = known.name
+		}
+		return *cp, nil
+	}
+	return TrustedCheckpoint{}, ErrNoCommittedCheckpoint
+}
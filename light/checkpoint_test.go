@@ -0,0 +1,500 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/params"
+	"github.com/akroma-project/akroma/rlp"
+)
+
+// testHeaderReader is a HeaderChainReader serving headers from a map.
+type testHeaderReader map[uint64]*types.Header
+
+func (r testHeaderReader) GetHeaderByNumber(number uint64) *types.Header {
+	return r[number]
+}
+
+func TestTrustedCheckpointVerifier(t *testing.T) {
+	var (
+		db       = ethdb.NewMemDatabase()
+		headNum  = ChtSectionHeadBlock(3, CHTFrequencyClient)
+		head     = &types.Header{Number: new(big.Int).SetUint64(headNum), Difficulty: big.NewInt(1)}
+		chain    = testHeaderReader{headNum: head}
+		verifier = NewTrustedCheckpointVerifier(db)
+		cp       = TrustedCheckpoint{
+			name:          "test",
+			sectionIdx:    3,
+			sectionHead:   head.Hash(),
+			chtRoot:       common.HexToHash("0x01"),
+			bloomTrieRoot: common.HexToHash("0x02"),
+		}
+	)
+	if err := verifier.Verify(cp, testHeaderReader{}); err != ErrCheckpointHeadUnknown {
+		t.Errorf("unknown head: have %v, want %v", err, ErrCheckpointHeadUnknown)
+	}
+	bad := cp
+	bad.sectionHead = common.HexToHash("0x03")
+	if err := verifier.Verify(bad, chain); err != ErrCheckpointHeadMismatch {
+		t.Errorf("head mismatch: have %v, want %v", err, ErrCheckpointHeadMismatch)
+	}
+	if err := verifier.Verify(cp, chain); err != ErrCheckpointNoLocalCht {
+		t.Errorf("missing CHT: have %v, want %v", err, ErrCheckpointNoLocalCht)
+	}
+	StoreChtRoot(db, (cp.sectionIdx+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, cp.sectionHead, common.HexToHash("0x04"))
+	if err := verifier.Verify(cp, chain); err != ErrCheckpointChtMismatch {
+		t.Errorf("CHT mismatch: have %v, want %v", err, ErrCheckpointChtMismatch)
+	}
+	StoreChtRoot(db, (cp.sectionIdx+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, cp.sectionHead, cp.chtRoot)
+	if err := verifier.Verify(cp, chain); err != nil {
+		t.Errorf("valid checkpoint rejected: %v", err)
+	}
+}
+
+func TestGetChtRootOrCheckpoint(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	cp := mainnetCheckpoint
+
+	root, checkpoint, err := GetChtRootOrCheckpoint(db, params.MainnetGenesisHash, cp.sectionIdx, cp.sectionHead)
+	if err != nil || !checkpoint || root != cp.chtRoot {
+		t.Fatalf("checkpoint fallback mismatch: have %x/%v/%v, want %x/true/nil", root, checkpoint, err, cp.chtRoot)
+	}
+	if _, _, err := GetChtRootOrCheckpoint(db, params.MainnetGenesisHash, cp.sectionIdx+1, cp.sectionHead); err != ErrNoTrustedCht {
+		t.Fatalf("unknown section: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	local := common.HexToHash("0x01")
+	StoreChtRoot(db, cp.sectionIdx, cp.sectionHead, local)
+	root, checkpoint, err = GetChtRootOrCheckpoint(db, params.MainnetGenesisHash, cp.sectionIdx, cp.sectionHead)
+	if err != nil || checkpoint || root != local {
+		t.Fatalf("local root mismatch: have %x/%v/%v, want %x/false/nil", root, checkpoint, err, local)
+	}
+}
+
+func TestTrustedCheckpointValidate(t *testing.T) {
+	for genesis, set := range trustedCheckpoints {
+		for _, cp := range set.Checkpoints() {
+			if err := cp.Validate(); err != nil {
+				t.Errorf("built-in checkpoint %q for genesis %x invalid: %v", cp.name, genesis, err)
+			}
+		}
+	}
+	valid := mainnetCheckpoint
+	for i, mutate := range []func(*TrustedCheckpoint){
+		func(cp *TrustedCheckpoint) { cp.sectionIdx = 0 },
+		func(cp *TrustedCheckpoint) { cp.sectionHead = common.Hash{} },
+		func(cp *TrustedCheckpoint) { cp.chtRoot = common.Hash{} },
+		func(cp *TrustedCheckpoint) { cp.bloomTrieRoot = common.Hash{} },
+	} {
+		cp := valid
+		mutate(&cp)
+		if err := cp.Validate(); err == nil {
+			t.Errorf("test %d: incomplete checkpoint accepted", i)
+		}
+	}
+}
+
+func TestImportCheckpointFromChain(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		head    = common.HexToHash("0x01")
+		chtRoot = common.HexToHash("0x02")
+		btRoot  = common.HexToHash("0x03")
+	)
+	if _, err := ImportCheckpointFromChain(db, 5, head); err != ErrNoTrustedCht {
+		t.Fatalf("missing CHT: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	StoreChtRoot(db, (5+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, head, chtRoot)
+	if _, err := ImportCheckpointFromChain(db, 5, head); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("missing BloomTrie: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+	StoreBloomTrieRoot(db, 5, head, btRoot)
+	cp, err := ImportCheckpointFromChain(db, 5, head)
+	if err != nil {
+		t.Fatalf("failed to import checkpoint: %v", err)
+	}
+	if cp.sectionIdx != 5 || cp.sectionHead != head || cp.chtRoot != chtRoot || cp.bloomTrieRoot != btRoot {
+		t.Fatalf("checkpoint mismatch: have %+v", cp)
+	}
+}
+
+func TestGenesisCheckpoint(t *testing.T) {
+	cp := mainnetCheckpoint
+	genesis := core.DefaultGenesisBlock()
+	original := common.CopyBytes(genesis.ExtraData)
+
+	if _, err := ParseCheckpointFromGenesis(genesis); err != ErrNoGenesisCheckpoint {
+		t.Fatalf("plain genesis: have %v, want %v", err, ErrNoGenesisCheckpoint)
+	}
+	embedded := NewGenesisWithCheckpoint(genesis, &cp)
+	if !bytes.Equal(genesis.ExtraData, original) {
+		t.Fatalf("original genesis modified")
+	}
+	have, err := ParseCheckpointFromGenesis(embedded)
+	if err != nil {
+		t.Fatalf("failed to parse embedded checkpoint: %v", err)
+	}
+	if *have != cp {
+		t.Fatalf("checkpoint mismatch: have %+v, want %+v", *have, cp)
+	}
+}
+
+func TestAnnotateCheckpoint(t *testing.T) {
+	cp := mainnetCheckpoint
+	head := &types.Header{Number: big.NewInt(1), Time: big.NewInt(1530000000), GasLimit: 8000000}
+
+	AnnotateCheckpoint(&cp, head, "test checkpoint")
+	want := CheckpointAnnotation{BlockTime: 1530000000, GasLimit: 8000000, Description: "test checkpoint"}
+	if cp.annotation == nil || *cp.annotation != want {
+		t.Fatalf("annotation mismatch: have %+v, want %+v", cp.annotation, want)
+	}
+	// Annotations are informational and must not affect validation
+	if err := cp.Validate(); err != nil {
+		t.Fatalf("annotated checkpoint invalid: %v", err)
+	}
+	if best, _ := trustedCheckpoints[params.MainnetGenesisHash].Best(); best.annotation != nil {
+		t.Fatalf("built-in checkpoint annotated")
+	}
+}
+
+func TestEstimateTimeToCheckpoint(t *testing.T) {
+	tests := []struct {
+		current, target uint64
+		rate            float64
+		want            time.Duration
+	}{
+		{100, 174, 2, 37 * time.Second},
+		{0, 1, 0.5, 2 * time.Second},
+		{174, 174, 2, 0},
+		{200, 174, 2, 0},
+		{100, 174, 0, math.MaxInt64},
+		{100, 174, -1, math.MaxInt64},
+		{0, math.MaxUint64, 1e-9, math.MaxInt64},
+	}
+	for i, tt := range tests {
+		if have := EstimateTimeToCheckpoint(tt.current, tt.target, tt.rate); have != tt.want {
+			t.Errorf("test %d: estimate mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+func TestCheckpointJSON(t *testing.T) {
+	cp := TrustedCheckpoint{
+		name:          "test",
+		sectionIdx:    174,
+		sectionHead:   common.HexToHash("0x01"),
+		chtRoot:       common.HexToHash("0x02"),
+		bloomTrieRoot: common.HexToHash("0x03"),
+		annotation:    &CheckpointAnnotation{BlockTime: 1530000000, GasLimit: 8000000, Description: "test checkpoint"},
+	}
+	enc, err := CheckpointToJSON(cp)
+	if err != nil {
+		t.Fatalf("failed to encode checkpoint: %v", err)
+	}
+	for _, field := range []string{"name", "sectionIdx", "sectionHead", "chtRoot", "bloomTrieRoot", "annotation", "blockTime", "gasLimit", "description"} {
+		if !bytes.Contains(enc, []byte(`"`+field+`"`)) {
+			t.Errorf("field %q missing from %s", field, enc)
+		}
+	}
+	dec, err := ParseCheckpointFromJSON(enc)
+	if err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	if *dec.annotation != *cp.annotation {
+		t.Fatalf("annotation mismatch: have %+v, want %+v", dec.annotation, cp.annotation)
+	}
+	dec.annotation = cp.annotation
+	if *dec != cp {
+		t.Fatalf("checkpoint mismatch: have %+v, want %+v", *dec, cp)
+	}
+	// Incomplete checkpoints must be rejected
+	if _, err := ParseCheckpointFromJSON([]byte(`{"name":"test","sectionIdx":174}`)); err == nil {
+		t.Fatalf("incomplete checkpoint accepted")
+	}
+}
+
+func TestTrustedCheckpointSet(t *testing.T) {
+	if _, ok := (*TrustedCheckpointSet)(nil).Best(); ok {
+		t.Fatalf("checkpoint found in nil set")
+	}
+	set := NewTrustedCheckpointSet()
+	if _, ok := set.Best(); ok {
+		t.Fatalf("checkpoint found in empty set")
+	}
+	for _, idx := range []uint64{100, 300, 200} {
+		cp := mainnetCheckpoint
+		cp.sectionIdx = idx
+		set.Add(cp)
+	}
+	if best, ok := set.Best(); !ok || best.sectionIdx != 300 {
+		t.Fatalf("best checkpoint mismatch: have %d/%v, want 300/true", best.sectionIdx, ok)
+	}
+	for i, cp := range set.Checkpoints() {
+		if want := uint64(100 * (i + 1)); cp.sectionIdx != want {
+			t.Fatalf("checkpoint %d: section mismatch: have %d, want %d", i, cp.sectionIdx, want)
+		}
+	}
+	if best, ok := trustedCheckpoints[params.MainnetGenesisHash].Best(); !ok || best != mainnetCheckpoint {
+		t.Fatalf("built-in checkpoint mismatch: have %+v, want %+v", best, mainnetCheckpoint)
+	}
+}
+
+func TestSignedCheckpointStorage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if _, err := LoadCheckpointWithSignature(db, params.MainnetGenesisHash); err != ErrNoSignedCheckpoint {
+		t.Fatalf("empty database: have %v, want %v", err, ErrNoSignedCheckpoint)
+	}
+	cp := SignedCheckpoint{
+		GenesisHash: params.MainnetGenesisHash,
+		Checkpoint:  mainnetCheckpoint,
+		Signature:   []byte{0x01, 0x02, 0x03},
+	}
+	if err := StoreCheckpointWithSignature(db, cp); err != nil {
+		t.Fatalf("failed to store checkpoint: %v", err)
+	}
+	have, err := LoadCheckpointWithSignature(db, params.MainnetGenesisHash)
+	if err != nil {
+		t.Fatalf("failed to load checkpoint: %v", err)
+	}
+	if have.GenesisHash != cp.GenesisHash || have.Checkpoint != cp.Checkpoint || !bytes.Equal(have.Signature, cp.Signature) {
+		t.Fatalf("checkpoint mismatch: have %+v, want %+v", *have, cp)
+	}
+	if _, err := LoadCheckpointWithSignature(db, params.TestnetGenesisHash); err != ErrNoSignedCheckpoint {
+		t.Fatalf("other chain: have %v, want %v", err, ErrNoSignedCheckpoint)
+	}
+	cp.Checkpoint.chtRoot = common.Hash{}
+	if err := StoreCheckpointWithSignature(db, cp); err == nil {
+		t.Fatalf("invalid checkpoint stored")
+	}
+}
+
+func TestTrustedCheckpointHash(t *testing.T) {
+	cp := mainnetCheckpoint
+	hash := TrustedCheckpointHash(cp)
+	if TrustedCheckpointHash(mainnetCheckpoint) != hash {
+		t.Fatalf("identical checkpoints hashed differently")
+	}
+	renamed := cp
+	renamed.name = "renamed"
+	AnnotateCheckpoint(&renamed, &types.Header{Time: big.NewInt(1), GasLimit: 1}, "annotated")
+	if TrustedCheckpointHash(renamed) != hash {
+		t.Fatalf("name or annotation changed the fingerprint")
+	}
+	for i, modify := range []func(*TrustedCheckpoint){
+		func(cp *TrustedCheckpoint) { cp.sectionIdx++ },
+		func(cp *TrustedCheckpoint) { cp.sectionHead[0] ^= 1 },
+		func(cp *TrustedCheckpoint) { cp.chtRoot[0] ^= 1 },
+		func(cp *TrustedCheckpoint) { cp.bloomTrieRoot[0] ^= 1 },
+	} {
+		other := cp
+		modify(&other)
+		if TrustedCheckpointHash(other) == hash {
+			t.Errorf("modification %d: fingerprint unchanged", i)
+		}
+	}
+}
+
+func TestTrustedCheckpointRLP(t *testing.T) {
+	cp := mainnetCheckpoint
+	AnnotateCheckpoint(&cp, &types.Header{Time: big.NewInt(1), GasLimit: 1}, "annotated")
+
+	enc, err := rlp.EncodeToBytes(cp)
+	if err != nil {
+		t.Fatalf("failed to encode checkpoint: %v", err)
+	}
+	var dec TrustedCheckpoint
+	if err := rlp.DecodeBytes(enc, &dec); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	// The annotation is informational and not encoded
+	if dec != mainnetCheckpoint {
+		t.Fatalf("checkpoint mismatch: have %+v, want %+v", dec, mainnetCheckpoint)
+	}
+	if err := rlp.DecodeBytes(enc[:len(enc)-1], &dec); err == nil {
+		t.Fatalf("truncated checkpoint decoded")
+	}
+}
+
+func TestCheckpointRegistry(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		genesis = common.HexToHash("0xdeadbeef")
+		cp      = TrustedCheckpoint{
+			name:          "private",
+			sectionIdx:    10,
+			sectionHead:   common.HexToHash("0x01"),
+			chtRoot:       common.HexToHash("0x02"),
+			bloomTrieRoot: common.HexToHash("0x03"),
+		}
+	)
+	registry := NewCheckpointRegistry(db)
+	if best, ok := registry.Lookup(params.MainnetGenesisHash); !ok || best != mainnetCheckpoint {
+		t.Fatalf("built-in checkpoint mismatch: have %+v/%v, want %+v/true", best, ok, mainnetCheckpoint)
+	}
+	if _, ok := registry.Lookup(genesis); ok {
+		t.Fatalf("checkpoint found for unknown chain")
+	}
+	if err := registry.Register(genesis, cp); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	if err := registry.Register(genesis, cp); err != nil {
+		t.Fatalf("failed to register checkpoint again: %v", err)
+	}
+	// Older and conflicting checkpoints must be rejected
+	older := cp
+	older.sectionIdx--
+	if err := registry.Register(genesis, older); err != ErrCheckpointRollback {
+		t.Fatalf("older checkpoint: have %v, want %v", err, ErrCheckpointRollback)
+	}
+	conflict := cp
+	conflict.chtRoot = common.HexToHash("0x04")
+	if err := registry.Register(genesis, conflict); err != ErrCheckpointConflict {
+		t.Fatalf("conflicting checkpoint: have %v, want %v", err, ErrCheckpointConflict)
+	}
+	if err := registry.Register(params.MainnetGenesisHash, cp); err != ErrCheckpointRollback {
+		t.Fatalf("checkpoint older than built-in one: have %v, want %v", err, ErrCheckpointRollback)
+	}
+	invalid := cp
+	invalid.bloomTrieRoot = common.Hash{}
+	if err := registry.Register(genesis, invalid); err == nil {
+		t.Fatalf("invalid checkpoint registered")
+	}
+	newer := mainnetCheckpoint
+	newer.sectionIdx++
+	if err := registry.Register(params.MainnetGenesisHash, newer); err != nil {
+		t.Fatalf("failed to register newer checkpoint: %v", err)
+	}
+	// A new registry has to merge the stored checkpoints with the built-in ones
+	registry = NewCheckpointRegistry(db)
+	if best, ok := registry.Lookup(genesis); !ok || best != cp {
+		t.Fatalf("registered checkpoint mismatch: have %+v/%v, want %+v/true", best, ok, cp)
+	}
+	if best, ok := registry.Lookup(params.MainnetGenesisHash); !ok || best != newer {
+		t.Fatalf("newer checkpoint mismatch: have %+v/%v, want %+v/true", best, ok, newer)
+	}
+	if cps := registry.Checkpoints(params.MainnetGenesisHash); len(cps) != 2 || cps[0] != mainnetCheckpoint {
+		t.Fatalf("merged checkpoints mismatch: have %+v", cps)
+	}
+	if best, ok := registry.Lookup(params.TestnetGenesisHash); !ok || best != ropstenCheckpoint {
+		t.Fatalf("built-in checkpoint mismatch: have %+v/%v, want %+v/true", best, ok, ropstenCheckpoint)
+	}
+	// The built-in defaults must not be modified by registering
+	if best, _ := trustedCheckpoints[params.MainnetGenesisHash].Best(); best != mainnetCheckpoint {
+		t.Fatalf("built-in checkpoints modified: have %+v", best)
+	}
+	// Invalid stored entries are skipped
+	db.Put(registeredCheckpointKey(genesis, 20), []byte{0x01})
+	if best, _ := NewCheckpointRegistry(db).Lookup(genesis); best != cp {
+		t.Fatalf("invalid stored checkpoint loaded: have %+v", best)
+	}
+}
+
+func TestCheckpointRegistryExportLatest(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	registry := NewCheckpointRegistry(db)
+	if _, err := registry.ExportLatest(params.MainnetGenesisHash); err != ErrNoCommittedCheckpoint {
+		t.Fatalf("empty database: have %v, want %v", err, ErrNoCommittedCheckpoint)
+	}
+	// Store the roots of two sections, only the older one with a CHT root
+	for section := uint64(1); section <= 2; section++ {
+		head := common.BigToHash(new(big.Int).SetUint64(section))
+		rawdb.WriteCanonicalHash(db, head, ChtSectionHeadBlock(section, BloomTrieFrequency))
+		StoreBloomTrieRoot(db, section, head, common.HexToHash("0x02"))
+		if section == 1 {
+			StoreChtRoot(db, (section+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, head, common.HexToHash("0x01"))
+		}
+	}
+	cp, err := registry.ExportLatest(params.MainnetGenesisHash)
+	if err != nil {
+		t.Fatalf("failed to export checkpoint: %v", err)
+	}
+	want := TrustedCheckpoint{
+		name:          "mainnet",
+		sectionIdx:    1,
+		sectionHead:   common.BigToHash(big.NewInt(1)),
+		chtRoot:       common.HexToHash("0x01"),
+		bloomTrieRoot: common.HexToHash("0x02"),
+	}
+	if cp != want {
+		t.Fatalf("exported checkpoint mismatch: have %+v, want %+v", cp, want)
+	}
+	// The exported checkpoint can be registered on another node
+	other := common.HexToHash("0xdeadbeef")
+	if err := NewCheckpointRegistry(ethdb.NewMemDatabase()).Register(other, cp); err != nil {
+		t.Fatalf("failed to register exported checkpoint: %v", err)
+	}
+}
+
+func TestRegisteredCheckpointLookups(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		genesis = common.HexToHash("0xdeadbeef")
+		cp      = TrustedCheckpoint{
+			name:          "private",
+			sectionIdx:    10,
+			sectionHead:   common.HexToHash("0x01"),
+			chtRoot:       common.HexToHash("0x02"),
+			bloomTrieRoot: common.HexToHash("0x03"),
+		}
+	)
+	if err := NewCheckpointRegistry(db).Register(genesis, cp); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	root, checkpoint, err := GetChtRootOrCheckpoint(db, genesis, cp.sectionIdx, cp.sectionHead)
+	if err != nil || !checkpoint || root != cp.chtRoot {
+		t.Fatalf("checkpoint fallback mismatch: have %x/%v/%v, want %x/true/nil", root, checkpoint, err, cp.chtRoot)
+	}
+	var found bool
+	for _, info := range TrustedCheckpointInfos(db) {
+		if info.GenesisHash == genesis {
+			if info.Name != cp.name || info.SectionIdx != cp.sectionIdx || info.ChtRoot != cp.chtRoot {
+				t.Fatalf("checkpoint info mismatch: have %+v", info)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("registered checkpoint not listed")
+	}
+}
+
+func TestTrustedCheckpointJSON(t *testing.T) {
+	enc, err := json.Marshal(mainnetCheckpoint)
+	if err != nil {
+		t.Fatalf("failed to encode checkpoint: %v", err)
+	}
+	var dec TrustedCheckpoint
+	if err := json.Unmarshal(enc, &dec); err != nil {
+		t.Fatalf("failed to decode checkpoint: %v", err)
+	}
+	if dec != mainnetCheckpoint {
+		t.Fatalf("checkpoint mismatch: have %+v, want %+v", dec, mainnetCheckpoint)
+	}
+	if err := json.Unmarshal([]byte(`{"name":"test","sectionIdx":174}`), &dec); err == nil {
+		t.Fatalf("incomplete checkpoint decoded")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"github.com/akroma-project/akroma/common"
+	"github.com/hashicorp/golang-lru"
+)
+
+// chtCacheKey identifies the CHT entry of a block in a single CHT section.
+type chtCacheKey struct {
+	section  uint64
+	blockNum uint64
+}
+
+// chtCacheEntry is a cached decoded CHT entry along with the section head it
+// belongs to, so entries of reorged sections are not served.
+type chtCacheEntry struct {
+	head common.Hash
+	node ChtNode
+}
+
+// ChtNodeCache is an LRU cache of decoded CHT entries, keyed by CHT section and
+// block number. A nil cache is valid and caches nothing. Cached nodes are shared,
+// their total difficulty must not be modified.
+type ChtNodeCache struct {
+	cache *lru.Cache
+}
+
+// NewChtNodeCache creates a cache holding at most size CHT entries.
+func NewChtNodeCache(size int) *ChtNodeCache {
+	cache, _ := lru.New(size)
+	return &ChtNodeCache{cache: cache}
+}
+
+// Get retrieves the decoded CHT entry of the given block and section if it is
+// cached for the given section head.
+func (c *ChtNodeCache) Get(section, blockNum uint64, head common.Hash) (ChtNode, bool) {
+	if c == nil {
+		return ChtNode{}, false
+	}
+	if entry, ok := c.cache.Get(chtCacheKey{section, blockNum}); ok && entry.(chtCacheEntry).head == head {
+		return entry.(chtCacheEntry).node, true
+	}
+	return ChtNode{}, false
+}
+
+// Add inserts a decoded CHT entry into the cache.
+func (c *ChtNodeCache) Add(section, blockNum uint64, head common.Hash, node ChtNode) {
+	if c == nil {
+		return
+	}
+	c.cache.Add(chtCacheKey{section, blockNum}, chtCacheEntry{head, node})
+}
+
+// Len returns the number of cached CHT entries.
+func (c *ChtNodeCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	return c.cache.Len()
+}
@@ -0,0 +1,151 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"fmt"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// ChtContinuityError is returned by VerifyChtChain for the first section that
+// does not follow from the previous one. If the break is a hash mismatch, BlockNum
+// is the block whose CHT entry or header didn't match and the two hashes are
+// set; otherwise BlockNum is the section head block and the hashes are zero.
+type ChtContinuityError struct {
+	Section      uint64
+	BlockNum     uint64
+	ExpectedHash common.Hash
+	ActualHash   common.Hash
+	Reason       string
+}
+
+func (e *ChtContinuityError) Error() string {
+	return fmt.Sprintf("CHT chain broken at section %d, block %d: %s", e.Section, e.BlockNum, e.Reason)
+}
+
+// VerifyChtChain checks that the stored CHTs of the consecutive sections from
+// startSection to endSection, with the given section heads, form a single chain:
+// the CHT of each section has to map its last block to the section head and has
+// to contain the head of the previous section unchanged, as sections extend the
+// CHT of their predecessor. If the first header of a section is available
+// locally, its parent is checked to be the previous section head too.
+func VerifyChtChain(db ethdb.Database, startSection, endSection, sectionSize uint64, sectionHeads []common.Hash) error {
+	if endSection < startSection || uint64(len(sectionHeads)) != endSection-startSection+1 {
+		return fmt.Errorf("%d section heads for sections %d-%d", len(sectionHeads), startSection, endSection)
+	}
+	triedb := trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix))
+	for i, head := range sectionHeads {
+		section := startSection + uint64(i)
+		headNum := ChtSectionHeadBlock(section, sectionSize)
+
+		root, version := GetChtRootVersion(db, section, head)
+		if root == (common.Hash{}) {
+			return &ChtContinuityError{Section: section, BlockNum: headNum, Reason: "no CHT root stored"}
+		}
+		t, err := trie.New(root, triedb)
+		if err != nil {
+			return &ChtContinuityError{Section: section, BlockNum: headNum, Reason: err.Error()}
+		}
+		if node, err := readChtEntry(t, version, headNum); err != nil {
+			return &ChtContinuityError{Section: section, BlockNum: headNum, Reason: err.Error()}
+		} else if node.Hash != head {
+			return &ChtContinuityError{Section: section, BlockNum: headNum, ExpectedHash: head, ActualHash: node.Hash, Reason: "section head entry does not match head"}
+		}
+		if i == 0 {
+			continue
+		}
+		prev, prevNum := sectionHeads[i-1], ChtSectionHeadBlock(section-1, sectionSize)
+		if node, err := readChtEntry(t, version, prevNum); err != nil {
+			return &ChtContinuityError{Section: section, BlockNum: prevNum, Reason: err.Error()}
+		} else if node.Hash != prev {
+			return &ChtContinuityError{Section: section, BlockNum: prevNum, ExpectedHash: prev, ActualHash: node.Hash, Reason: "previous head entry does not match previous head"}
+		}
+		start := ChtSectionStartBlock(section, sectionSize)
+		node, err := readChtEntry(t, version, start)
+		if err != nil {
+			return &ChtContinuityError{Section: section, BlockNum: start, Reason: err.Error()}
+		}
+		if header := rawdb.ReadHeader(db, node.Hash, start); header != nil && header.ParentHash != prev {
+			return &ChtContinuityError{Section: section, BlockNum: start, ExpectedHash: prev, ActualHash: header.ParentHash, Reason: "first block parent does not match previous head"}
+		}
+	}
+	return nil
+}
+
+// ReplaySection rebuilds the CHT of a committed section of the given size from the
+// canonical headers of chain and the total difficulties stored in db, and returns
+// the stored root along with the rebuilt one. The rebuilt trie extends the stored
+// CHT of the previous section and is only kept in memory.
+func ReplaySection(db ethdb.Database, chain HeaderChainReader, sectionIdx, sectionSize uint64) (storedRoot, replayedRoot common.Hash, err error) {
+	head := chain.GetHeaderByNumber(ChtSectionHeadBlock(sectionIdx, sectionSize))
+	if head == nil {
+		return common.Hash{}, common.Hash{}, ErrNoHeader
+	}
+	if storedRoot = GetChtRoot(db, sectionIdx, head.Hash()); storedRoot == (common.Hash{}) {
+		return common.Hash{}, common.Hash{}, ErrNoTrustedCht
+	}
+	var prevRoot common.Hash
+	if sectionIdx > 0 {
+		prevHead := chain.GetHeaderByNumber(ChtSectionHeadBlock(sectionIdx-1, sectionSize))
+		if prevHead == nil {
+			return storedRoot, common.Hash{}, ErrNoHeader
+		}
+		if prevRoot = GetChtRoot(db, sectionIdx-1, prevHead.Hash()); prevRoot == (common.Hash{}) {
+			return storedRoot, common.Hash{}, fmt.Errorf("no CHT root stored for previous section %d", sectionIdx-1)
+		}
+	}
+	t, err := trie.New(prevRoot, trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)))
+	if err != nil {
+		return storedRoot, common.Hash{}, err
+	}
+	for num := ChtSectionStartBlock(sectionIdx, sectionSize); num <= head.Number.Uint64(); num++ {
+		header := chain.GetHeaderByNumber(num)
+		if header == nil {
+			return storedRoot, common.Hash{}, ErrNoHeader
+		}
+		hash := header.Hash()
+		td := rawdb.ReadTd(db, hash, num)
+		if td == nil {
+			return storedRoot, common.Hash{}, fmt.Errorf("missing total difficulty of block %d", num)
+		}
+		data, err := rlp.EncodeToBytes(ChtNode{hash, td})
+		if err != nil {
+			return storedRoot, common.Hash{}, err
+		}
+		encNumber := ComputeChtKey(num)
+		t.Update(encNumber[:], data)
+	}
+	return storedRoot, t.Hash(), nil
+}
+
+// readChtEntry reads and decodes the CHT entry of the given block.
+func readChtEntry(t *trie.Trie, version byte, number uint64) (ChtNode, error) {
+	encNumber := ComputeChtKey(number)
+	data, err := t.TryGet(encNumber[:])
+	if err != nil {
+		return ChtNode{}, err
+	}
+	if len(data) == 0 {
+		return ChtNode{}, fmt.Errorf("no CHT entry for block %d", number)
+	}
+	return DecodeChtNode(version, data)
+}
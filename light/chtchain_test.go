@@ -0,0 +1,123 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+func TestVerifyChtChain(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 3*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	var heads []common.Hash
+	for section := uint64(0); section < 3; section++ {
+		var last common.Hash
+		if section > 0 {
+			last = heads[section-1]
+		}
+		processChtSection(t, backend, headers, section, last)
+		heads = append(heads, headers[ChtSectionHeadBlock(section, CHTFrequencyServer)].Hash())
+	}
+	if err := VerifyChtChain(db, 0, 2, CHTFrequencyServer, heads); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	if err := VerifyChtChain(db, 1, 2, CHTFrequencyServer, heads[1:]); err != nil {
+		t.Fatalf("valid partial chain rejected: %v", err)
+	}
+	// Replace the middle section with one built on a different predecessor
+	fork := common.Hash{0xff}
+	StoreChtRoot(db, 1, fork, GetChtRoot(db, 0, heads[0]))
+	err := VerifyChtChain(db, 0, 2, CHTFrequencyServer, []common.Hash{heads[0], fork, heads[2]})
+	if cerr, ok := err.(*ChtContinuityError); !ok || cerr.Section != 1 {
+		t.Fatalf("broken chain: have %v, want continuity error at section 1", err)
+	}
+	// Register the last section under a wrong head, the mismatch must be reported
+	wrong := common.Hash{0xee}
+	StoreChtRoot(db, 2, wrong, GetChtRoot(db, 2, heads[2]))
+	err = VerifyChtChain(db, 2, 2, CHTFrequencyServer, []common.Hash{wrong})
+	want := &ChtContinuityError{2, ChtSectionHeadBlock(2, CHTFrequencyServer), wrong, heads[2], "section head entry does not match head"}
+	if cerr, ok := err.(*ChtContinuityError); !ok || *cerr != *want {
+		t.Fatalf("head mismatch: have %+v, want %+v", err, want)
+	}
+}
+
+func TestReplaySection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	processChtSection(t, backend, headers, 1, headers[ChtSectionHeadBlock(0, CHTFrequencyServer)].Hash())
+
+	for section := uint64(0); section < 2; section++ {
+		stored, replayed, err := ReplaySection(db, dbHeaderReader{db}, section, CHTFrequencyServer)
+		if err != nil {
+			t.Fatalf("section %d: replay failed: %v", section, err)
+		}
+		if stored != replayed {
+			t.Errorf("section %d: root mismatch: stored %x, replayed %x", section, stored, replayed)
+		}
+	}
+	if _, _, err := ReplaySection(db, dbHeaderReader{db}, 2, CHTFrequencyServer); err != ErrNoHeader {
+		t.Errorf("uncommitted section: error mismatch: have %v, want %v", err, ErrNoHeader)
+	}
+}
+
+func TestRebuildChtSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	processChtSection(t, backend, headers, 1, headers[CHTFrequencyServer-1].Hash())
+
+	// Lose the root node of the second section
+	head := headers[2*CHTFrequencyServer-1].Hash()
+	root := GetChtRoot(db, 1, head)
+	table := ethdb.NewTable(db, ChtTablePrefix)
+	table.Delete(root.Bytes())
+	if _, err := trie.New(root, trie.NewDatabase(table)); err == nil {
+		t.Fatalf("corrupt CHT opened")
+	}
+	// Rebuild it and check that the repaired section is announced and readable
+	bus := NewIndexerEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+
+	config := DefaultServerChtIndexerConfig
+	config.Events = bus
+	errc := make(chan error, 1)
+	go func() { errc <- RebuildChtSection(db, &config, 1) }()
+
+	if ev := <-events; ev.Section != 1 || ev.Head != head || ev.Root != root {
+		t.Fatalf("commit event mismatch: have %+v", ev)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to rebuild section: %v", err)
+	}
+	if stored, replayed, err := ReplaySection(db, dbHeaderReader{db}, 1, CHTFrequencyServer); err != nil || stored != replayed {
+		t.Fatalf("rebuilt section inconsistent: stored %x, replayed %x, err %v", stored, replayed, err)
+	}
+	if _, err := trie.New(root, trie.NewDatabase(table)); err != nil {
+		t.Fatalf("rebuilt CHT not readable: %v", err)
+	}
+}
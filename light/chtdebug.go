@@ -0,0 +1,47 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build chtdebug
+
+package light
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/akroma-project/akroma/trie"
+)
+
+// DumpTrie writes the entries of the in-memory CHT of the section being processed,
+// including the ones not committed yet, to w in ascending block number order, one
+// line per block. It is a debugging aid only built with the chtdebug tag.
+func (c *ChtIndexerBackend) DumpTrie(w io.Writer) error {
+	if c.trie == nil {
+		return errChtNoSection
+	}
+	it := trie.NewIterator(c.trie.NodeIterator(nil))
+	for it.Next() {
+		node, err := DecodeChtNode(ChtVersion, it.Value)
+		if err != nil {
+			return fmt.Errorf("invalid CHT entry %x: %v", it.Key, err)
+		}
+		if _, err := fmt.Fprintf(w, "block %d: hash %x td %v\n", binary.BigEndian.Uint64(it.Key), node.Hash, node.Td); err != nil {
+			return err
+		}
+	}
+	return it.Err
+}
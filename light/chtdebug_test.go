@@ -0,0 +1,60 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build chtdebug
+
+package light
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestChtDumpTrie(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 8)
+	backend := newTestChtBackend(db, 8)
+
+	var buf bytes.Buffer
+	if err := backend.DumpTrie(&buf); err != errChtNoSection {
+		t.Fatalf("dump without section: have %v, want %v", err, errChtNoSection)
+	}
+	// Uncommitted entries are dumped too
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:4] {
+		backend.Process(header)
+	}
+	if err := backend.DumpTrie(&buf); err != nil {
+		t.Fatalf("failed to dump trie: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("dumped line count mismatch: have %d, want %d", len(lines), 4)
+	}
+	for i, line := range lines {
+		hash := headers[i].Hash()
+		want := fmt.Sprintf("block %d: hash %x td %v", i, hash, rawdb.ReadTd(db, hash, uint64(i)))
+		if line != want {
+			t.Errorf("line %d mismatch: have %q, want %q", i, line, want)
+		}
+	}
+}
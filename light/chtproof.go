@@ -0,0 +1,97 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"fmt"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// MerkleProofSet aggregates CHT proofs of multiple block numbers belonging to
+// the same section. Trie nodes shared between the proofs are stored only once
+// and resolved only once during verification.
+type MerkleProofSet struct {
+	root   common.Hash
+	nodes  *NodeSet
+	blocks []uint64
+}
+
+// NewMerkleProofSet creates an empty proof set for the CHT with the given root.
+func NewMerkleProofSet(root common.Hash) *MerkleProofSet {
+	return &MerkleProofSet{
+		root:  root,
+		nodes: NewNodeSet(),
+	}
+}
+
+// Add inserts the proof of the given block number into the set.
+func (s *MerkleProofSet) Add(blockNum uint64, proof [][]byte) {
+	for _, node := range proof {
+		NodeList{node}.Store(s.nodes)
+	}
+	s.blocks = append(s.blocks, blockNum)
+}
+
+// NodeCount returns the number of distinct trie nodes in the set.
+func (s *MerkleProofSet) NodeCount() int {
+	return s.nodes.KeyCount()
+}
+
+// CompressedProofs returns the distinct trie nodes of all accumulated proofs, in
+// the order they were first added. The nodes form a single proof of all blocks in
+// the set, e.g. to be served or stored in place of the individual proofs.
+func (s *MerkleProofSet) CompressedProofs() [][]byte {
+	list := s.nodes.NodeList()
+	nodes := make([][]byte, len(list))
+	for i, node := range list {
+		nodes[i] = node
+	}
+	return nodes
+}
+
+// Verify checks all accumulated proofs against the CHT root in a single trie
+// and returns the proven CHT entries keyed by block number.
+func (s *MerkleProofSet) Verify() (map[uint64]ChtNode, error) {
+	db := ethdb.NewMemDatabase()
+	s.nodes.Store(db)
+
+	t, err := trie.New(s.root, trie.NewDatabase(db))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[uint64]ChtNode, len(s.blocks))
+	for _, blockNum := range s.blocks {
+		encNumber := ComputeChtKey(blockNum)
+
+		data, err := t.TryGet(encNumber[:])
+		if err != nil {
+			return nil, fmt.Errorf("proof for block %d incomplete: %v", blockNum, err)
+		}
+		if len(data) == 0 {
+			return nil, fmt.Errorf("block %d not present in CHT", blockNum)
+		}
+		node, err := DecodeChtNode(ChtVersion, data)
+		if err != nil {
+			return nil, err
+		}
+		result[blockNum] = node
+	}
+	return result, nil
+}
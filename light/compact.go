@@ -0,0 +1,51 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/log"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+var errCompactionUnsupported = errors.New("compaction is only supported for LevelDB databases")
+
+// DatabaseCompactor compacts the key ranges of the helper trie tables, which
+// suffer from high write amplification after importing many sections.
+type DatabaseCompactor struct{}
+
+// CompactChtTable compacts the CHT trie nodes stored in db.
+func (DatabaseCompactor) CompactChtTable(db ethdb.Database) error {
+	return compactTable(db, ChtTablePrefix)
+}
+
+// CompactBloomTrieTable compacts the BloomTrie trie nodes stored in db.
+func (DatabaseCompactor) CompactBloomTrieTable(db ethdb.Database) error {
+	return compactTable(db, BloomTrieTablePrefix)
+}
+
+// compactTable compacts the key range of the table with the given prefix.
+func compactTable(db ethdb.Database, prefix string) error {
+	ldb, ok := db.(*ethdb.LDBDatabase)
+	if !ok {
+		return errCompactionUnsupported
+	}
+	log.Info("Compacting helper trie table", "prefix", prefix)
+	return ldb.LDB().CompactRange(*util.BytesPrefix([]byte(prefix)))
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestDatabaseCompactor(t *testing.T) {
+	var compactor DatabaseCompactor
+	if err := compactor.CompactChtTable(ethdb.NewMemDatabase()); err != errCompactionUnsupported {
+		t.Fatalf("memory database: have %v, want %v", err, errCompactionUnsupported)
+	}
+	dir, err := ioutil.TempDir("", "light-compact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := ethdb.NewLDBDatabase(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+	head := headers[CHTFrequencyServer-1].Hash()
+
+	if err := compactor.CompactChtTable(db); err != nil {
+		t.Fatalf("failed to compact CHT table: %v", err)
+	}
+	if err := compactor.CompactBloomTrieTable(db); err != nil {
+		t.Fatalf("failed to compact BloomTrie table: %v", err)
+	}
+	if stored, replayed, err := ReplaySection(db, dbHeaderReader{db}, 0, CHTFrequencyServer); err != nil || stored != replayed || stored != GetChtRoot(db, 0, head) {
+		t.Fatalf("CHT damaged by compaction: stored %x, replayed %x, err %v", stored, replayed, err)
+	}
+}
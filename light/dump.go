@@ -0,0 +1,75 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/bits"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/common/hexutil"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// BloomBitsDump is the debug representation of the bloom bit vector of a single
+// bit index in a BloomTrie section.
+type BloomBitsDump struct {
+	BitIndex     uint          `json:"bitIndex"`
+	Compressed   hexutil.Bytes `json:"compressedHex"`
+	Decompressed hexutil.Bytes `json:"decompressedHex"`
+	SetBitCount  int           `json:"decompressedSetBitCount"`
+}
+
+// DumpBloomTrieSection reads the bloom bit vectors of every bit index of a
+// section from the BloomTrie stored with the given section head. Bit indexes
+// without any bits set in the section have no trie entry and are dumped with an
+// empty compressed and an all zero decompressed vector.
+func DumpBloomTrieSection(db ethdb.Database, section uint64, sectionHead common.Hash) ([]BloomBitsDump, error) {
+	root := GetBloomTrieRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return nil, ErrNoTrustedBloomTrie
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		return nil, err
+	}
+	dump := make([]BloomBitsDump, types.BloomBitLength)
+	for bit := uint(0); bit < types.BloomBitLength; bit++ {
+		key := ComputeHelperTrieKey(bit, section)
+		comp, err := t.TryGet(key[:])
+		if err != nil {
+			return nil, err
+		}
+		decomp, err := bitutil.DecompressBytes(comp, BloomTrieFrequency/8)
+		if err != nil {
+			return nil, err
+		}
+		count := 0
+		for _, b := range decomp {
+			count += bits.OnesCount8(b)
+		}
+		dump[bit] = BloomBitsDump{
+			BitIndex:     bit,
+			Compressed:   common.CopyBytes(comp),
+			Decompressed: decomp,
+			SetBitCount:  count,
+		}
+	}
+	return dump, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestDumpBloomTrieSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 2; section++ {
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+	}
+	dump, err := DumpBloomTrieSection(db, 1, lastHead)
+	if err != nil {
+		t.Fatalf("failed to dump section: %v", err)
+	}
+	if len(dump) != types.BloomBitLength {
+		t.Fatalf("dump length mismatch: have %d, want %d", len(dump), types.BloomBitLength)
+	}
+	for bit, entry := range dump {
+		if entry.BitIndex != uint(bit) {
+			t.Fatalf("entry %d: bit index mismatch: have %d", bit, entry.BitIndex)
+		}
+		want, err := BloomTrieLookup(db, uint(bit), 1, lastHead)
+		if err != nil {
+			t.Fatalf("bit %d: lookup failed: %v", bit, err)
+		}
+		if !bytes.Equal(entry.Decompressed, want) {
+			t.Fatalf("bit %d: decompressed bloom bits mismatch", bit)
+		}
+		count := 0
+		for _, b := range want {
+			for ; b != 0; b &= b - 1 {
+				count++
+			}
+		}
+		if entry.SetBitCount != count {
+			t.Fatalf("bit %d: set bit count mismatch: have %d, want %d", bit, entry.SetBitCount, count)
+		}
+		if count == 0 && len(entry.Compressed) != 0 {
+			t.Fatalf("bit %d: empty vector has compressed data %x", bit, entry.Compressed)
+		}
+	}
+	if _, err := DumpBloomTrieSection(db, 2, lastHead); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("missing section: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
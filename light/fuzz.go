@@ -0,0 +1,166 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build gofuzz
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// FuzzBloomTrieCommit implements a go-fuzz fuzzer method (go-fuzz-build -func
+// FuzzBloomTrieCommit) to test committing BloomTrie sections of arbitrary bloom
+// bits. The first input byte selects the section index and whether the rest of
+// the input is stored as compressed bloom bits directly (possibly invalid), or
+// is spread over valid bit vectors. A successful commit has to produce a
+// non-empty root from which all bit vectors can be read back.
+func FuzzBloomTrieCommit(data []byte) int {
+	if len(data) < 2 {
+		return -1
+	}
+	var (
+		section = uint64(data[0] & 0x0f)
+		raw     = data[0]&0x80 != 0
+		payload = data[1:]
+	)
+	db := ethdb.NewMemDatabase()
+	head := &types.Header{Number: new(big.Int).SetUint64((section+1)*BloomTrieFrequency - 1), Extra: payload}
+
+	// Store the bloom bits of the only parent section (client mode)
+	vectors := make([][]byte, types.BloomBitLength)
+	for i := range vectors {
+		if raw {
+			vectors[i] = payload
+		} else {
+			vector := make([]byte, BloomTrieFrequency/8)
+			copy(vector[(i*31)%len(vector):], payload)
+			vectors[i] = bitutil.CompressBytes(vector)
+		}
+		rawdb.WriteBloomBits(db, uint(i), section, head.Hash(), vectors[i])
+	}
+	backend := newBloomTrieIndexerBackend(db, true)
+	if err := backend.Reset(section, common.Hash{}); err != nil {
+		panic(err)
+	}
+	backend.Process(head)
+	if err := backend.Commit(); err != nil {
+		if raw {
+			return 0 // invalid compressed bits are expected to be rejected
+		}
+		panic(err)
+	}
+	root := GetBloomTrieRoot(db, section, head.Hash())
+	if root == (common.Hash{}) {
+		panic("no bloom trie root stored")
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		panic(err)
+	}
+	for i, vector := range vectors {
+		key := ComputeHelperTrieKey(uint(i), section)
+		stored, err := t.TryGet(key[:])
+		if err != nil {
+			panic(err)
+		}
+		decomp, err := bitutil.DecompressBytes(vector, BloomTrieFrequency/8)
+		if err != nil {
+			panic(err)
+		}
+		if !bytes.Equal(stored, bitutil.CompressBytes(decomp)) {
+			panic("bloom bits mismatch")
+		}
+	}
+	return 1
+}
+
+// FuzzChtProcess implements a go-fuzz fuzzer method (go-fuzz-build -func
+// FuzzChtProcess) to test building CHT sections of arbitrary headers and total
+// difficulties. The first input byte selects the section size, followed by one
+// 9 byte record per block: a flag byte whose lowest bit drops the total
+// difficulty of the block, and the total difficulty itself. Blocks without total
+// difficulty have to fail the commit without panicking, complete sections have
+// to produce a non-empty root proving all entries.
+func FuzzChtProcess(data []byte) int {
+	if len(data) < 1 {
+		return -1
+	}
+	sectionSize := uint64(data[0]%64) + 1
+	records := data[1:]
+	if uint64(len(records)) < 9*sectionSize {
+		return -1
+	}
+	db := ethdb.NewMemDatabase()
+	backend := newChtIndexerBackend(db, &ChtIndexerConfig{SectionSize: sectionSize})
+	if err := backend.Reset(0, common.Hash{}); err != nil {
+		panic(err)
+	}
+	var (
+		headers  = make([]*types.Header, sectionSize)
+		tds      = make([]*big.Int, sectionSize)
+		complete = true
+		parent   common.Hash
+	)
+	for i := range headers {
+		record := records[9*i : 9*i+9]
+		headers[i] = &types.Header{Number: big.NewInt(int64(i)), ParentHash: parent, Extra: record}
+		parent = headers[i].Hash()
+
+		if record[0]&1 == 0 {
+			tds[i] = new(big.Int).SetUint64(binary.BigEndian.Uint64(record[1:]))
+			rawdb.WriteTd(db, parent, uint64(i), tds[i])
+		} else {
+			complete = false
+		}
+		backend.Process(headers[i])
+	}
+	if err := backend.Commit(); err != nil {
+		if !complete {
+			return 0 // missing total difficulties have to fail the commit
+		}
+		panic(err)
+	} else if !complete {
+		panic("incomplete section committed")
+	}
+	root := GetChtRoot(db, 0, parent)
+	if root == (common.Hash{}) {
+		panic("no CHT root stored")
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)))
+	if err != nil {
+		panic(err)
+	}
+	for i, header := range headers {
+		node, err := readChtEntry(t, ChtVersion, uint64(i))
+		if err != nil {
+			panic(err)
+		}
+		if node.Hash != header.Hash() || node.Td.Cmp(tds[i]) != 0 {
+			panic("CHT entry mismatch")
+		}
+	}
+	return 1
+}
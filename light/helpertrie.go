@@ -0,0 +1,267 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/log"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// Helper trie types, matching the numbering of the LES/2 protocol.
+const (
+	HelperTrieCht   = iota // Canonical hash trie
+	HelperTrieBloom        // BloomBits trie
+)
+
+var errHelperTrieProofCount = errors.New("invalid number of helper trie proofs")
+
+// ValidateHelperTriePair checks that the stored CHT and BloomTrie sections, both
+// numbered in LES/2 section size, cover block ranges ending at the same block and
+// agree on the given head of that block: the CHT has to map the last block to the
+// head and the BloomTrie root has to be stored for it.
+func ValidateHelperTriePair(db ethdb.Database, chtSection, bloomTrieSection uint64, sectionHead common.Hash) error {
+	headNum := ChtSectionHeadBlock(chtSection, CHTFrequencyClient)
+	if bloomTrieHeadNum := ChtSectionHeadBlock(bloomTrieSection, BloomTrieFrequency); bloomTrieHeadNum != headNum {
+		return fmt.Errorf("CHT section %d ends at block %d, BloomTrie section %d at block %d", chtSection, headNum, bloomTrieSection, bloomTrieHeadNum)
+	}
+	root, version := GetChtRootVersion(db, (chtSection+1)*(CHTFrequencyClient/CHTFrequencyServer)-1, sectionHead)
+	if root == (common.Hash{}) {
+		return ErrNoTrustedCht
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)))
+	if err != nil {
+		return err
+	}
+	node, err := readChtEntry(t, version, headNum)
+	if err != nil {
+		return err
+	}
+	if node.Hash != sectionHead {
+		return fmt.Errorf("CHT entry of block %d is %x, not section head %x", headNum, node.Hash, sectionHead)
+	}
+	if GetBloomTrieRoot(db, bloomTrieSection, sectionHead) == (common.Hash{}) {
+		return ErrNoTrustedBloomTrie
+	}
+	return nil
+}
+
+// HelperTrieCapabilities summarizes the helper trie sections a server can serve.
+// CHT sections are numbered in the server section size (CHTFrequencyServer).
+type HelperTrieCapabilities struct {
+	AvailableChtSections       ChtSectionBitmap
+	AvailableBloomTrieSections BloomTrieSectionBitmap
+}
+
+// BuildHelperTrieCapabilities collects the sections of the CHT and BloomTrie
+// roots stored in the database for the canonical section heads. Roots of
+// non-canonical heads are not served and are left out. Keys that cannot be
+// decoded are skipped and logged.
+func BuildHelperTrieCapabilities(db ethdb.Database) HelperTrieCapabilities {
+	var caps HelperTrieCapabilities
+	chtSections, err := canonicalSections(db, chtPrefix, DefaultChtKeyEncoder, CHTFrequencyServer)
+	if err != nil {
+		log.Warn("Failed to list CHT sections", "err", err)
+	}
+	for _, section := range chtSections {
+		caps.AvailableChtSections.Set(section)
+	}
+	bloomTrieSections, err := canonicalSections(db, bloomTriePrefix, bloomTrieKeyEncoder, BloomTrieFrequency)
+	if err != nil {
+		log.Warn("Failed to list BloomTrie sections", "err", err)
+	}
+	for _, section := range bloomTrieSections {
+		caps.AvailableBloomTrieSections.Set(section)
+	}
+	return caps
+}
+
+// canonicalSections returns the sections among the keys with the given prefix,
+// decoded with enc, whose section head is the canonical header at the end of the
+// section of the given size.
+func canonicalSections(db ethdb.Database, prefix []byte, enc KeyEncoder, sectionSize uint64) ([]uint64, error) {
+	var sections []uint64
+	err := iterateWithPrefix(db, prefix, func(key, value []byte) error {
+		section, head, err := enc.Decode(key)
+		if err != nil {
+			log.Warn("Skipping invalid section key", "key", fmt.Sprintf("%x", key), "err", err)
+			return nil
+		}
+		if rawdb.ReadCanonicalHash(db, ChtSectionHeadBlock(section, sectionSize)) == head {
+			sections = append(sections, section)
+		}
+		return nil
+	})
+	return sections, err
+}
+
+// Update marks the section committed by a helper trie indexer, as reported by an
+// IndexerEvent, as available.
+func (c *HelperTrieCapabilities) Update(ev IndexerEvent) {
+	switch ev.Indexer {
+	case "cht":
+		c.AvailableChtSections.Set(ev.Section)
+	case "bloomtrie":
+		c.AvailableBloomTrieSections.Set(ev.Section)
+	}
+}
+
+// Copy returns a deep copy of the capabilities.
+func (c *HelperTrieCapabilities) Copy() HelperTrieCapabilities {
+	var cpy HelperTrieCapabilities
+	cpy.AvailableChtSections.bits = c.AvailableChtSections.Encode()
+	cpy.AvailableBloomTrieSections.bits = c.AvailableBloomTrieSections.Encode()
+	return cpy
+}
+
+// DataIntegrityReport is the result of AuditChainData.
+type DataIntegrityReport struct {
+	SectionsChecked uint64           // Number of sections audited
+	FailedSections  []uint64         // Sections failing any check, in ascending order
+	Errors          map[uint64]error // First failure of each failed section
+	PassedAll       bool             // Whether all sections passed all checks
+}
+
+// AuditChainData checks the stored helper tries of all LES/2 sections up to and
+// including maxSection against the local chain: the CHT and BloomTrie sections
+// have to agree on the canonical section head (see ValidateHelperTriePair) and
+// the BloomTrie has to match the locally stored bloom bits (see
+// ValidateBloomTrieRoot). All sections are checked even if some fail.
+func AuditChainData(db ethdb.Database, chain HeaderChainReader, maxSection uint64) DataIntegrityReport {
+	report := DataIntegrityReport{Errors: make(map[uint64]error)}
+	for section := uint64(0); section <= maxSection; section++ {
+		report.SectionsChecked++
+		if err := auditSection(db, chain, section); err != nil {
+			report.FailedSections = append(report.FailedSections, section)
+			report.Errors[section] = err
+		}
+	}
+	report.PassedAll = len(report.FailedSections) == 0
+	return report
+}
+
+// auditSection runs the checks of AuditChainData on a single section.
+func auditSection(db ethdb.Database, chain HeaderChainReader, section uint64) error {
+	head := chain.GetHeaderByNumber(ChtSectionHeadBlock(section, CHTFrequencyClient))
+	if head == nil {
+		return ErrNoHeader
+	}
+	if err := ValidateHelperTriePair(db, section, section, head.Hash()); err != nil {
+		return err
+	}
+	ratio := uint64(BloomTrieFrequency / ethBloomBitsSection)
+	parentHeads := make([]common.Hash, ratio)
+	for i := range parentHeads {
+		header := chain.GetHeaderByNumber(ChtSectionHeadBlock(section*ratio+uint64(i), ethBloomBitsSection))
+		if header == nil {
+			return ErrNoHeader
+		}
+		parentHeads[i] = header.Hash()
+	}
+	return ValidateBloomTrieRoot(db, section, head.Hash(), ethBloomBitsSection, ratio, parentHeads)
+}
+
+// HelperTrieProofRequest identifies a single helper trie entry to be proven.
+type HelperTrieProofRequest struct {
+	Type    uint
+	TrieIdx uint64
+	Key     []byte
+}
+
+// LESPeer is a remote light server able to serve helper trie proofs.
+type LESPeer interface {
+	// RequestHelperTrieProofs retrieves the Merkle proofs of all requested helper
+	// trie entries in a single round trip, returning them in request order.
+	RequestHelperTrieProofs(ctx context.Context, reqs []HelperTrieProofRequest) ([][][]byte, error)
+}
+
+// HelperTrieProof bundles the CHT and BloomTrie proofs belonging to a single block.
+type HelperTrieProof struct {
+	ChtProof       [][]byte
+	BloomTrieProof [][]byte
+	BlockNum       uint64
+	Bit            uint // Bloom bit index proven by BloomTrieProof
+}
+
+// Verify checks both proofs against the given trusted CHT and BloomTrie roots of
+// the sections containing the block, returning the proven CHT entry and the
+// decompressed bloom bit vector of the BloomTrie section.
+func (p *HelperTrieProof) Verify(chtRoot, bloomTrieRoot common.Hash) (ChtNode, []byte, error) {
+	chtKey := ComputeChtKey(p.BlockNum)
+	value, _, err := trie.VerifyProof(chtRoot, chtKey[:], proofNodeSet(p.ChtProof))
+	if err != nil {
+		return ChtNode{}, nil, fmt.Errorf("CHT proof verification failed: %v", err)
+	}
+	if len(value) == 0 {
+		return ChtNode{}, nil, ErrChtEntryMissing
+	}
+	node, err := DecodeChtNode(ChtVersion, value)
+	if err != nil {
+		return ChtNode{}, nil, err
+	}
+	bloomKey := ComputeHelperTrieKey(p.Bit, BloomTrieSectionFromBlock(p.BlockNum))
+	comp, _, err := trie.VerifyProof(bloomTrieRoot, bloomKey[:], proofNodeSet(p.BloomTrieProof))
+	if err != nil {
+		return ChtNode{}, nil, fmt.Errorf("BloomTrie proof verification failed: %v", err)
+	}
+	// All zero vectors are not stored in the BloomTrie, an empty value is valid
+	bits, err := bitutil.DecompressBytes(comp, int(BloomTrieFrequency/8))
+	if err != nil {
+		return ChtNode{}, nil, err
+	}
+	return node, bits, nil
+}
+
+// proofNodeSet collects the nodes of a Merkle proof into a node set.
+func proofNodeSet(proof [][]byte) *NodeSet {
+	nodes := make(NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes.NodeSet()
+}
+
+// FetchHelperTrieProof retrieves both the CHT proof of the given block and the
+// BloomTrie proof of the given bloom bit of the section containing the block with
+// a single request. A BloomTrie entry covers a full section rather than a single
+// block, so the bit index has to be specified too.
+func FetchHelperTrieProof(ctx context.Context, peer LESPeer, blockNum uint64, bit uint) (*HelperTrieProof, error) {
+	chtKey := ComputeChtKey(blockNum)
+
+	section := BloomTrieSectionFromBlock(blockNum)
+	bloomKey := ComputeHelperTrieKey(bit, section)
+
+	reqs := []HelperTrieProofRequest{
+		{Type: HelperTrieCht, TrieIdx: blockNum / CHTFrequencyClient, Key: chtKey[:]},
+		{Type: HelperTrieBloom, TrieIdx: section, Key: bloomKey[:]},
+	}
+	proofs, err := peer.RequestHelperTrieProofs(ctx, reqs)
+	if err != nil {
+		return nil, err
+	}
+	if len(proofs) != len(reqs) {
+		return nil, errHelperTrieProofCount
+	}
+	return &HelperTrieProof{ChtProof: proofs[0], BloomTrieProof: proofs[1], BlockNum: blockNum, Bit: bit}, nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// testLESPeer is a LESPeer recording requests and serving canned proofs.
+type testLESPeer struct {
+	reqs   []HelperTrieProofRequest
+	proofs [][][]byte
+}
+
+func (p *testLESPeer) RequestHelperTrieProofs(ctx context.Context, reqs []HelperTrieProofRequest) ([][][]byte, error) {
+	p.reqs = reqs
+	return p.proofs, nil
+}
+
+func TestFetchHelperTrieProof(t *testing.T) {
+	blockNum := uint64(3*BloomTrieFrequency + 5)
+	peer := &testLESPeer{proofs: [][][]byte{{{0x01}}, {{0x02}, {0x03}}}}
+
+	proof, err := FetchHelperTrieProof(context.Background(), peer, blockNum, 7)
+	if err != nil {
+		t.Fatalf("failed to fetch proof: %v", err)
+	}
+	if len(peer.reqs) != 2 {
+		t.Fatalf("request count mismatch: have %d, want 2", len(peer.reqs))
+	}
+	if req := peer.reqs[0]; req.Type != HelperTrieCht || req.TrieIdx != blockNum/CHTFrequencyClient || !bytes.Equal(req.Key, []byte{0, 0, 0, 0, 0, 1, 0x80, 0x05}) {
+		t.Errorf("CHT request mismatch: have %+v", req)
+	}
+	if req := peer.reqs[1]; req.Type != HelperTrieBloom || req.TrieIdx != 3 || !bytes.Equal(req.Key, []byte{0, 7, 0, 0, 0, 0, 0, 0, 0, 3}) {
+		t.Errorf("BloomTrie request mismatch: have %+v", req)
+	}
+	if proof.BlockNum != blockNum || len(proof.ChtProof) != 1 || len(proof.BloomTrieProof) != 2 {
+		t.Errorf("proof mismatch: have %+v", proof)
+	}
+	peer.proofs = peer.proofs[:1]
+	if _, err := FetchHelperTrieProof(context.Background(), peer, blockNum, 7); err != errHelperTrieProofCount {
+		t.Errorf("short reply: have %v, want %v", err, errHelperTrieProofCount)
+	}
+}
+
+func TestHelperTrieProofVerify(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+	chtRoot := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+	bloomTrieRoot := GetBloomTrieRoot(db, 0, heads[len(heads)-1].Hash())
+
+	chtProof, err := proveChtEntry(db, chtRoot, 5)
+	if err != nil {
+		t.Fatalf("failed to prove CHT entry: %v", err)
+	}
+	bt, err := trie.New(bloomTrieRoot, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		t.Fatalf("failed to open bloom trie: %v", err)
+	}
+	var bloomProof NodeList
+	bloomKey := ComputeHelperTrieKey(7, 0)
+	if err := bt.Prove(bloomKey[:], 0, &bloomProof); err != nil {
+		t.Fatalf("failed to prove bloom trie entry: %v", err)
+	}
+	peer := &testLESPeer{proofs: [][][]byte{chtProof, make([][]byte, len(bloomProof))}}
+	for i, node := range bloomProof {
+		peer.proofs[1][i] = node
+	}
+	proof, err := FetchHelperTrieProof(context.Background(), peer, 5, 7)
+	if err != nil {
+		t.Fatalf("failed to fetch proof: %v", err)
+	}
+	node, bits, err := proof.Verify(chtRoot, bloomTrieRoot)
+	if err != nil {
+		t.Fatalf("failed to verify proof: %v", err)
+	}
+	if node.Hash != headers[5].Hash() {
+		t.Errorf("CHT entry mismatch: have %x, want %x", node.Hash, headers[5].Hash())
+	}
+	want, _ := BloomTrieLookup(db, 7, 0, heads[len(heads)-1].Hash())
+	if !bytes.Equal(bits, want) {
+		t.Errorf("bloom bits mismatch")
+	}
+	if _, _, err := proof.Verify(common.Hash{1}, bloomTrieRoot); err == nil {
+		t.Errorf("proof verified against wrong CHT root")
+	}
+	if _, _, err := proof.Verify(chtRoot, common.Hash{1}); err == nil {
+		t.Errorf("proof verified against wrong BloomTrie root")
+	}
+}
+
+// makeTestHelperTrieSection builds a chain of a single LES/2 section along with
+// its CHT, from LES/1 sized sections, and its BloomTrie, from server sized bloom
+// bits sections.
+func makeTestHelperTrieSection(t *testing.T, db ethdb.Database) []*types.Header {
+	headers := makeTestHeaderChain(db, BloomTrieFrequency)
+
+	chtBackend := newTestChtBackend(db, CHTFrequencyServer)
+	var lastHead common.Hash
+	for section := uint64(0); section < CHTFrequencyClient/CHTFrequencyServer; section++ {
+		processChtSection(t, chtBackend, headers, section, lastHead)
+		lastHead = headers[(section+1)*CHTFrequencyServer-1].Hash()
+	}
+	var heads []*types.Header
+	for j := uint64(0); j < BloomTrieFrequency/ethBloomBitsSection; j++ {
+		sectionHead := headers[(j+1)*ethBloomBitsSection-1]
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			rawdb.WriteBloomBits(db, bit, j, sectionHead.Hash(), bitutil.CompressBytes(testBloomBits(bit, j, ethBloomBitsSection)))
+		}
+		heads = append(heads, sectionHead)
+	}
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+	return headers
+}
+
+func TestValidateHelperTriePair(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHelperTrieSection(t, db)
+	head := headers[BloomTrieFrequency-1].Hash()
+
+	if err := ValidateHelperTriePair(db, 0, 0, head); err != nil {
+		t.Fatalf("consistent pair rejected: %v", err)
+	}
+	if err := ValidateHelperTriePair(db, 0, 1, head); err == nil {
+		t.Fatalf("misaligned sections accepted")
+	}
+	if err := ValidateHelperTriePair(db, 0, 0, headers[1].Hash()); err != ErrNoTrustedCht {
+		t.Fatalf("unknown head: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	// A CHT root stored for a head it does not contain must be rejected
+	fake := common.HexToHash("0x01")
+	StoreChtRoot(db, CHTFrequencyClient/CHTFrequencyServer-1, fake, GetChtV2Root(db, 0, head))
+	if err := ValidateHelperTriePair(db, 0, 0, fake); err == nil {
+		t.Fatalf("mismatching section head accepted")
+	}
+	// A missing BloomTrie must be rejected
+	if err := deleteBloomTrieRoot(db, 0, head); err != nil {
+		t.Fatalf("failed to delete bloom trie root: %v", err)
+	}
+	if err := ValidateHelperTriePair(db, 0, 0, head); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("missing BloomTrie: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
+
+func TestBuildHelperTrieCapabilities(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if caps := BuildHelperTrieCapabilities(db); len(caps.AvailableChtSections.Sections()) != 0 || len(caps.AvailableBloomTrieSections.Sections()) != 0 {
+		t.Fatalf("capabilities of empty database: %+v", caps)
+	}
+	makeTestHelperTrieSection(t, db)
+
+	caps := BuildHelperTrieCapabilities(db)
+	if want := []uint64{0, 1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(caps.AvailableChtSections.Sections(), want) {
+		t.Errorf("CHT sections mismatch: have %v, want %v", caps.AvailableChtSections.Sections(), want)
+	}
+	if want := []uint64{0}; !reflect.DeepEqual(caps.AvailableBloomTrieSections.Sections(), want) {
+		t.Errorf("BloomTrie sections mismatch: have %v, want %v", caps.AvailableBloomTrieSections.Sections(), want)
+	}
+	// Roots stored for non-canonical section heads must not be advertised
+	fork := common.HexToHash("0xdeadbeef")
+	StoreChtRoot(db, 3, fork, common.HexToHash("0x01"))
+	StoreChtRoot(db, 8, fork, common.HexToHash("0x02"))
+	StoreBloomTrieRoot(db, 1, fork, common.HexToHash("0x03"))
+
+	caps = BuildHelperTrieCapabilities(db)
+	if want := []uint64{0, 1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(caps.AvailableChtSections.Sections(), want) {
+		t.Errorf("CHT sections mismatch with forked heads: have %v, want %v", caps.AvailableChtSections.Sections(), want)
+	}
+	if want := []uint64{0}; !reflect.DeepEqual(caps.AvailableBloomTrieSections.Sections(), want) {
+		t.Errorf("BloomTrie sections mismatch with forked heads: have %v, want %v", caps.AvailableBloomTrieSections.Sections(), want)
+	}
+}
+
+func TestHelperTrieCapabilitiesUpdate(t *testing.T) {
+	var caps HelperTrieCapabilities
+	caps.Update(IndexerEvent{Indexer: "cht", Section: 2})
+	caps.Update(IndexerEvent{Indexer: "bloomtrie", Section: 1})
+	caps.Update(IndexerEvent{Indexer: "unknown", Section: 5})
+
+	cpy := caps.Copy()
+	caps.Update(IndexerEvent{Indexer: "cht", Section: 3})
+
+	if want := []uint64{2}; !reflect.DeepEqual(cpy.AvailableChtSections.Sections(), want) {
+		t.Errorf("CHT sections mismatch: have %v, want %v", cpy.AvailableChtSections.Sections(), want)
+	}
+	if want := []uint64{1}; !reflect.DeepEqual(cpy.AvailableBloomTrieSections.Sections(), want) {
+		t.Errorf("BloomTrie sections mismatch: have %v, want %v", cpy.AvailableBloomTrieSections.Sections(), want)
+	}
+	if want := []uint64{2, 3}; !reflect.DeepEqual(caps.AvailableChtSections.Sections(), want) {
+		t.Errorf("updated CHT sections mismatch: have %v, want %v", caps.AvailableChtSections.Sections(), want)
+	}
+}
+
+func TestAuditChainData(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHelperTrieSection(t, db)
+	chain := dbHeaderReader{db}
+
+	if report := AuditChainData(db, chain, 0); !report.PassedAll || report.SectionsChecked != 1 {
+		t.Fatalf("consistent data failed audit: %+v", report)
+	}
+	// Sections beyond the stored data must fail without stopping the audit
+	report := AuditChainData(db, chain, 1)
+	if report.PassedAll || report.SectionsChecked != 2 || len(report.FailedSections) != 1 || report.FailedSections[0] != 1 {
+		t.Fatalf("missing section audit mismatch: %+v", report)
+	}
+	// Corrupted bloom bits must be detected
+	head := headers[ethBloomBitsSection-1].Hash()
+	rawdb.WriteBloomBits(db, 1, 0, head, bitutil.CompressBytes(testBloomBits(2, 0, ethBloomBitsSection)))
+
+	report = AuditChainData(db, chain, 0)
+	if report.PassedAll || len(report.FailedSections) != 1 || report.Errors[0] == nil {
+		t.Fatalf("corrupted section audit mismatch: %+v", report)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"time"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/rlp"
+)
+
+// ChtRootEntry is a CHT root recorded in the root history of a section.
+type ChtRootEntry struct {
+	Head common.Hash // Section head the root was committed for
+	Root common.Hash // Committed CHT root
+	Time uint64      // Unix time of the commit
+}
+
+// BloomTrieRootEntry is a BloomTrie root recorded in the root history of a section.
+type BloomTrieRootEntry struct {
+	Head common.Hash // Section head the root was committed for
+	Root common.Hash // Committed BloomTrie root
+	Time uint64      // Unix time of the commit
+}
+
+// rootHistoryEntry is the stored form of the entries of all root histories.
+type rootHistoryEntry struct {
+	Head, Root common.Hash
+	Time       uint64
+}
+
+// ChtRootHistory records the most recently committed CHT roots of each section,
+// so that roots overwritten by recommitting a section remain available for
+// auditing.
+type ChtRootHistory struct {
+	db    ethdb.Database
+	limit int
+}
+
+// NewChtRootHistory creates a CHT root history keeping the last limit roots of
+// each section in db.
+func NewChtRootHistory(db ethdb.Database, limit int) *ChtRootHistory {
+	return &ChtRootHistory{db: db, limit: limit}
+}
+
+// Record adds a committed root to the history of the section, dropping the oldest
+// entries beyond the limit.
+func (h *ChtRootHistory) Record(section uint64, head, root common.Hash) error {
+	return recordRoot(h.db, chtRootHistoryPrefix, h.limit, section, head, root)
+}
+
+// GetChtRootHistory returns the recorded roots of a CHT section, oldest first.
+func GetChtRootHistory(db ethdb.Database, section uint64) []ChtRootEntry {
+	var entries []ChtRootEntry
+	for _, entry := range readRootHistory(db, chtRootHistoryPrefix, section) {
+		entries = append(entries, ChtRootEntry(entry))
+	}
+	return entries
+}
+
+// BloomTrieRootHistory records the most recently committed BloomTrie roots of
+// each section, like ChtRootHistory does for CHTs.
+type BloomTrieRootHistory struct {
+	db    ethdb.Database
+	limit int
+}
+
+// NewBloomTrieRootHistory creates a BloomTrie root history keeping the last limit
+// roots of each section in db.
+func NewBloomTrieRootHistory(db ethdb.Database, limit int) *BloomTrieRootHistory {
+	return &BloomTrieRootHistory{db: db, limit: limit}
+}
+
+// Record adds a committed root to the history of the section, dropping the oldest
+// entries beyond the limit.
+func (h *BloomTrieRootHistory) Record(section uint64, head, root common.Hash) error {
+	return recordRoot(h.db, bloomTrieRootHistoryPrefix, h.limit, section, head, root)
+}
+
+// GetBloomTrieRootHistory returns the recorded roots of a BloomTrie section,
+// oldest first.
+func GetBloomTrieRootHistory(db ethdb.Database, section uint64) []BloomTrieRootEntry {
+	var entries []BloomTrieRootEntry
+	for _, entry := range readRootHistory(db, bloomTrieRootHistoryPrefix, section) {
+		entries = append(entries, BloomTrieRootEntry(entry))
+	}
+	return entries
+}
+
+// readRootHistory reads the root history of a section stored under prefix. A
+// missing or undecodable history is returned empty.
+func readRootHistory(db ethdb.Database, prefix []byte, section uint64) []rootHistoryEntry {
+	data, _ := db.Get(sectionIndexKey(prefix, section))
+	if len(data) == 0 {
+		return nil
+	}
+	var entries []rootHistoryEntry
+	if err := rlp.DecodeBytes(data, &entries); err != nil {
+		return nil
+	}
+	return entries
+}
+
+// recordRoot appends a root committed now to the root history of a section stored
+// under prefix, keeping the last limit entries.
+func recordRoot(db ethdb.Database, prefix []byte, limit int, section uint64, head, root common.Hash) error {
+	entry := rootHistoryEntry{Head: head, Root: root, Time: uint64(time.Now().Unix())}
+	entries := append(readRootHistory(db, prefix, section), entry)
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	enc, err := rlp.EncodeToBytes(entries)
+	if err != nil {
+		return err
+	}
+	return db.Put(sectionIndexKey(prefix, section), enc)
+}
@@ -0,0 +1,86 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestChtRootHistory(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if entries := GetChtRootHistory(db, 0); len(entries) != 0 {
+		t.Fatalf("history of empty database: %v", entries)
+	}
+	// Recommit the same section three times, recording each root
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	head := headers[CHTFrequencyServer-1].Hash()
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.rootHistory = NewChtRootHistory(db, 3)
+	for i := 0; i < 3; i++ {
+		processChtSection(t, backend, headers, 0, common.Hash{})
+	}
+	entries := GetChtRootHistory(db, 0)
+	if len(entries) != 3 {
+		t.Fatalf("history length mismatch: have %d, want 3", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Head != head || entry.Root != GetChtRoot(db, 0, head) || entry.Time == 0 {
+			t.Errorf("entry %d: mismatch: %+v", i, entry)
+		}
+	}
+	// Recording beyond the limit must drop the oldest roots
+	history := NewChtRootHistory(db, 3)
+	for i := byte(1); i <= 2; i++ {
+		if err := history.Record(0, head, common.Hash{i}); err != nil {
+			t.Fatalf("failed to record root: %v", err)
+		}
+	}
+	entries = GetChtRootHistory(db, 0)
+	if len(entries) != 3 || entries[1].Root != (common.Hash{1}) || entries[2].Root != (common.Hash{2}) {
+		t.Fatalf("history not trimmed: %+v", entries)
+	}
+	if entries := GetChtRootHistory(db, 1); len(entries) != 0 {
+		t.Fatalf("history recorded for other section: %v", entries)
+	}
+}
+
+func TestBloomTrieRootHistory(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	head := heads[len(heads)-1].Hash()
+
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	WithBloomTrieRootHistory(2)(backend)
+	for i := 0; i < 3; i++ {
+		processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+	}
+	entries := GetBloomTrieRootHistory(db, 0)
+	if len(entries) != 2 {
+		t.Fatalf("history length mismatch: have %d, want 2", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.Head != head || entry.Root != GetBloomTrieRoot(db, 0, head) || entry.Time == 0 {
+			t.Errorf("entry %d: mismatch: %+v", i, entry)
+		}
+	}
+	if entries := GetChtRootHistory(db, 0); len(entries) != 0 {
+		t.Fatalf("bloom trie roots recorded in CHT history: %v", entries)
+	}
+}
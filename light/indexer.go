@@ -0,0 +1,222 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/event"
+)
+
+var (
+	errManagerRunning = errors.New("indexers already running")
+	errManagerClosed  = errors.New("indexers already stopped")
+)
+
+// IndexerManagerStatus summarizes the progress of the helper trie indexers.
+type IndexerManagerStatus struct {
+	Running           bool   // Whether the indexers are running
+	ChtSections       uint64 // Number of CHT sections stored
+	BloomTrieSections uint64 // Number of BloomTrie sections stored
+}
+
+// ChainIndexerManager manages the lifecycle of the CHT and BloomTrie indexers as
+// a single unit. The BloomTrie indexer is always started after and stopped before
+// the CHT indexer. Indexers cannot be restarted once stopped.
+type ChainIndexerManager struct {
+	cht, bloomTrie *core.ChainIndexer
+	chain          core.ChainIndexerChain
+
+	running bool
+	closed  bool
+	errc    chan error
+	subs    []event.Subscription // Section failure subscriptions of the running indexers
+	lock    sync.Mutex
+}
+
+// NewChainIndexerManager creates a manager for the given indexers, feeding them
+// chain events from chain once started. Either indexer may be nil.
+func NewChainIndexerManager(cht, bloomTrie *core.ChainIndexer, chain core.ChainIndexerChain) *ChainIndexerManager {
+	return &ChainIndexerManager{
+		cht:       cht,
+		bloomTrie: bloomTrie,
+		chain:     chain,
+		errc:      make(chan error, 2),
+	}
+}
+
+// Start starts the CHT indexer followed by the BloomTrie indexer.
+func (m *ChainIndexerManager) Start() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.running {
+		return errManagerRunning
+	}
+	if m.closed {
+		return errManagerClosed
+	}
+	for _, indexer := range []*core.ChainIndexer{m.cht, m.bloomTrie} {
+		if indexer != nil {
+			m.subs = append(m.subs, m.forward(indexer))
+			indexer.Start(m.chain)
+		}
+	}
+	m.running = true
+	return nil
+}
+
+// forward reports the section failures of the given indexer on the error channel
+// until the returned subscription is cancelled.
+func (m *ChainIndexerManager) forward(indexer *core.ChainIndexer) event.Subscription {
+	failures := make(chan core.ChainIndexerError)
+	sub := indexer.SubscribeErrors(failures)
+	go func() {
+		for {
+			select {
+			case failure := <-failures:
+				m.report(fmt.Errorf("%s indexer: section %d: %v", indexer.BackendType(), failure.Section, failure.Err))
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub
+}
+
+// Stop tears down the BloomTrie indexer followed by the CHT indexer. Indexers of
+// a manager which was never started are torn down too. Any failure is both
+// returned and reported on the error channel.
+func (m *ChainIndexerManager) Stop() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.closed {
+		return errManagerClosed
+	}
+	m.running, m.closed = false, true
+
+	var errs []error
+	if m.bloomTrie != nil {
+		if err := m.bloomTrie.Close(); err != nil {
+			errs = append(errs, m.report(fmt.Errorf("%s indexer: %v", m.bloomTrie.BackendType(), err)))
+		}
+	}
+	if m.cht != nil {
+		if err := m.cht.Close(); err != nil {
+			errs = append(errs, m.report(fmt.Errorf("%s indexer: %v", m.cht.BackendType(), err)))
+		}
+	}
+	// Stop forwarding failures only after the indexers are down, so they never
+	// block on delivering one
+	for _, sub := range m.subs {
+		sub.Unsubscribe()
+	}
+	m.subs = nil
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errs[0]
+	default:
+		return fmt.Errorf("%v", errs)
+	}
+}
+
+// report forwards an error to the shared error channel without blocking.
+func (m *ChainIndexerManager) report(err error) error {
+	select {
+	case m.errc <- err:
+	default:
+	}
+	return err
+}
+
+// Errors returns the channel on which failures of either indexer are reported.
+func (m *ChainIndexerManager) Errors() <-chan error {
+	return m.errc
+}
+
+// Status returns the current state of the managed indexers.
+func (m *ChainIndexerManager) Status() IndexerManagerStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := IndexerManagerStatus{Running: m.running}
+	if m.cht != nil {
+		status.ChtSections, _, _ = m.cht.Sections()
+	}
+	if m.bloomTrie != nil {
+		status.BloomTrieSections, _, _ = m.bloomTrie.Sections()
+	}
+	return status
+}
+
+// IndexerEvent is posted on an IndexerEventBus when a helper trie indexer commits
+// a section.
+type IndexerEvent struct {
+	Indexer string      // Name of the committing indexer backend ("cht" or "bloomtrie")
+	Section uint64      // Index of the committed section
+	Head    common.Hash // Head of the committed section
+	Root    common.Hash // Root of the committed helper trie
+}
+
+// IndexerEventBus distributes the section commit events of the helper trie
+// indexers it is passed to. Subscribers have to keep receiving events until they
+// unsubscribe, as commits wait for all of them to accept each event.
+type IndexerEventBus struct {
+	feed event.Feed
+	subs map[<-chan IndexerEvent]event.Subscription
+	lock sync.Mutex
+}
+
+// NewIndexerEventBus creates an event bus without subscribers.
+func NewIndexerEventBus() *IndexerEventBus {
+	return &IndexerEventBus{subs: make(map[<-chan IndexerEvent]event.Subscription)}
+}
+
+// Subscribe returns a new channel receiving all subsequent section commit events.
+func (bus *IndexerEventBus) Subscribe() <-chan IndexerEvent {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	ch := make(chan IndexerEvent, 16)
+	bus.subs[ch] = bus.feed.Subscribe(ch)
+	return ch
+}
+
+// Unsubscribe stops the delivery of events to a channel returned by Subscribe.
+func (bus *IndexerEventBus) Unsubscribe(ch <-chan IndexerEvent) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+
+	if sub, ok := bus.subs[ch]; ok {
+		sub.Unsubscribe()
+		delete(bus.subs, ch)
+	}
+}
+
+// post delivers an event to all subscribers. Posting on a nil bus is a no-op.
+func (bus *IndexerEventBus) post(ev IndexerEvent) {
+	if bus != nil {
+		bus.feed.Send(ev)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/event"
+)
+
+// testIndexerChain is a core.ChainIndexerChain without any blocks beyond genesis.
+type testIndexerChain struct {
+	feed event.Feed
+}
+
+func (c *testIndexerChain) CurrentHeader() *types.Header {
+	return &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1)}
+}
+
+func (c *testIndexerChain) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+func TestChainIndexerManager(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	cht, bloomTrie := NewChtIndexer(db, &DefaultServerChtIndexerConfig), NewBloomTrieIndexer(db, false)
+	cht.AddKnownSectionHead(0, common.Hash{1})
+
+	manager := NewChainIndexerManager(cht, bloomTrie, new(testIndexerChain))
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start indexers: %v", err)
+	}
+	if err := manager.Start(); err != errManagerRunning {
+		t.Fatalf("double start: have %v, want %v", err, errManagerRunning)
+	}
+	status := manager.Status()
+	if !status.Running || status.ChtSections != 1 || status.BloomTrieSections != 0 {
+		t.Fatalf("status mismatch: have %+v", status)
+	}
+	if err := manager.Stop(); err != nil {
+		t.Fatalf("failed to stop indexers: %v", err)
+	}
+	if manager.Status().Running {
+		t.Fatalf("indexers still reported running")
+	}
+	if err := manager.Start(); err != errManagerClosed {
+		t.Fatalf("restart: have %v, want %v", err, errManagerClosed)
+	}
+	if err := manager.Stop(); err != errManagerClosed {
+		t.Fatalf("double stop: have %v, want %v", err, errManagerClosed)
+	}
+	select {
+	case err := <-manager.Errors():
+		t.Fatalf("unexpected indexer error: %v", err)
+	default:
+	}
+}
+
+func TestChainIndexerManagerStopUnstarted(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	manager := NewChainIndexerManager(NewChtIndexer(db, nil), NewBloomTrieIndexer(db, true), new(testIndexerChain))
+
+	if err := manager.Stop(); err != nil {
+		t.Fatalf("failed to stop unstarted indexers: %v", err)
+	}
+	if err := manager.Start(); err != errManagerClosed {
+		t.Fatalf("start after stop: have %v, want %v", err, errManagerClosed)
+	}
+}
+
+// failingIndexerBackend is a core.ChainIndexerBackend failing every section.
+type failingIndexerBackend struct{}
+
+func (failingIndexerBackend) Reset(uint64, common.Hash) error { return errors.New("reset failed") }
+func (failingIndexerBackend) Process(*types.Header)           {}
+func (failingIndexerBackend) Commit() error                   { return nil }
+
+func TestChainIndexerManagerErrors(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	cht := core.NewChainIndexer(db, ethdb.NewTable(db, "failIndex-"), failingIndexerBackend{}, 1, 0, 0, "failing")
+
+	manager := NewChainIndexerManager(cht, nil, new(testIndexerChain))
+	if err := manager.Start(); err != nil {
+		t.Fatalf("failed to start indexers: %v", err)
+	}
+	defer manager.Stop()
+
+	select {
+	case err := <-manager.Errors():
+		if !strings.Contains(err.Error(), "reset failed") {
+			t.Fatalf("error mismatch: have %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("section failure not reported")
+	}
+}
+
+func TestIndexerEventBus(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	bus := NewIndexerEventBus()
+
+	cht := newTestChtBackend(db, CHTFrequencyServer)
+	cht.events = bus
+	bloomTrie := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	bloomTrie.events = bus
+
+	events := bus.Subscribe()
+	processChtSection(t, cht, headers, 0, common.Hash{})
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, bloomTrie, 0, common.Hash{}, heads)
+
+	chtHead, bloomTrieHead := headers[CHTFrequencyServer-1].Hash(), heads[len(heads)-1].Hash()
+	for _, want := range []IndexerEvent{
+		{Indexer: "cht", Section: 0, Head: chtHead, Root: GetChtRoot(db, 0, chtHead)},
+		{Indexer: "bloomtrie", Section: 0, Head: bloomTrieHead, Root: GetBloomTrieRoot(db, 0, bloomTrieHead)},
+	} {
+		select {
+		case have := <-events:
+			if have != want {
+				t.Fatalf("event mismatch: have %+v, want %+v", have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no %s commit event", want.Indexer)
+		}
+	}
+	// Commits must not be held up by unsubscribed channels
+	bus.Unsubscribe(events)
+	for i := 0; i < 32; i++ {
+		processChtSection(t, cht, headers, 0, common.Hash{})
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("event after unsubscribe: %+v", ev)
+	default:
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+// ErrSectionSizeUnknown is returned if no database size is stored for a section.
+var ErrSectionSizeUnknown = errors.New("section size unknown")
+
+// DatabaseInspector reports the storage used by the helper tries in a database.
+type DatabaseInspector struct{}
+
+// InspectChtTableSize returns the total size of the CHT trie nodes stored in db.
+func (DatabaseInspector) InspectChtTableSize(db ethdb.Database) (uint64, error) {
+	return tableValueSize(db, ChtTablePrefix)
+}
+
+// InspectBloomTrieTableSize returns the total size of the BloomTrie trie nodes
+// stored in db.
+func (DatabaseInspector) InspectBloomTrieTableSize(db ethdb.Database) (uint64, error) {
+	return tableValueSize(db, BloomTrieTablePrefix)
+}
+
+// tableValueSize sums the sizes of the values stored in the table with the given
+// prefix. Keys are not counted.
+func tableValueSize(db ethdb.Database, prefix string) (uint64, error) {
+	var size uint64
+	err := iterateWithPrefix(db, []byte(prefix), func(key, value []byte) error {
+		size += uint64(len(value))
+		return nil
+	})
+	return size, err
+}
+
+// StoreChtSectionSize stores the number of trie node bytes written to the database
+// for the CHT of a section.
+func StoreChtSectionSize(db ethdb.Database, section uint64, bytes uint64) error {
+	return storeSectionSize(db, chtSizePrefix, section, bytes)
+}
+
+// GetChtSectionSize returns the number of trie node bytes written to the database
+// for the CHT of a section, or ErrSectionSizeUnknown if it wasn't recorded.
+func GetChtSectionSize(db ethdb.Database, section uint64) (uint64, error) {
+	return readSectionSize(db, chtSizePrefix, section)
+}
+
+// StoreBloomTrieSectionSize stores the number of trie node bytes written to the
+// database for the BloomTrie of a section.
+func StoreBloomTrieSectionSize(db ethdb.Database, section uint64, bytes uint64) error {
+	return storeSectionSize(db, bloomTrieSizePrefix, section, bytes)
+}
+
+// GetBloomTrieSectionSize returns the number of trie node bytes written to the
+// database for the BloomTrie of a section, or ErrSectionSizeUnknown if it wasn't
+// recorded.
+func GetBloomTrieSectionSize(db ethdb.Database, section uint64) (uint64, error) {
+	return readSectionSize(db, bloomTrieSizePrefix, section)
+}
+
+// storeSectionSize stores the database size of a section under prefix.
+func storeSectionSize(db ethdb.Database, prefix []byte, section uint64, bytes uint64) error {
+	var enc [8]byte
+	binary.BigEndian.PutUint64(enc[:], bytes)
+	return db.Put(sectionIndexKey(prefix, section), enc[:])
+}
+
+// readSectionSize reads the database size of a section stored under prefix.
+func readSectionSize(db ethdb.Database, prefix []byte, section uint64) (uint64, error) {
+	data, _ := db.Get(sectionIndexKey(prefix, section))
+	if len(data) != 8 {
+		return 0, ErrSectionSizeUnknown
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// sectionSizes returns all section sizes stored under prefix, keyed by section.
+// Malformed entries are skipped.
+func sectionSizes(db ethdb.Database, prefix []byte) map[uint64]uint64 {
+	sizes := make(map[uint64]uint64)
+	iterateWithPrefix(db, prefix, func(key, value []byte) error {
+		if len(key) == len(prefix)+8 && len(value) == 8 {
+			sizes[binary.BigEndian.Uint64(key[len(prefix):])] = binary.BigEndian.Uint64(value)
+		}
+		return nil
+	})
+	return sizes
+}
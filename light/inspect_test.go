@@ -0,0 +1,129 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestDatabaseInspector(t *testing.T) {
+	var (
+		db        = ethdb.NewMemDatabase()
+		inspector DatabaseInspector
+	)
+	if size, err := inspector.InspectChtTableSize(db); err != nil || size != 0 {
+		t.Fatalf("empty CHT table: have %d/%v, want 0/nil", size, err)
+	}
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+
+	var want uint64
+	for _, key := range db.Keys() {
+		if bytes.HasPrefix(key, []byte(ChtTablePrefix)) {
+			value, _ := db.Get(key)
+			want += uint64(len(value))
+		}
+	}
+	if size, err := inspector.InspectChtTableSize(db); err != nil || size != want || size == 0 {
+		t.Fatalf("CHT table size mismatch: have %d/%v, want %d/nil", size, err, want)
+	}
+	// Other entries must not be counted into the BloomTrie table
+	if size, err := inspector.InspectBloomTrieTableSize(db); err != nil || size != 0 {
+		t.Fatalf("empty BloomTrie table: have %d/%v, want 0/nil", size, err)
+	}
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+	if size, err := inspector.InspectBloomTrieTableSize(db); err != nil || size == 0 {
+		t.Fatalf("BloomTrie table size: have %d/%v, want non-zero", size, err)
+	}
+}
+
+func TestChtSectionSize(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if _, err := GetChtSectionSize(db, 0); err != ErrSectionSizeUnknown {
+		t.Fatalf("missing section size: have %v, want %v", err, ErrSectionSizeUnknown)
+	}
+	// Flush partially too, all batches of the section have to be counted
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.flushLimit = 1000
+	processChtSection(t, backend, headers, 0, common.Hash{})
+
+	first, err := GetChtSectionSize(db, 0)
+	if err != nil {
+		t.Fatalf("failed to read section size: %v", err)
+	}
+	if want, _ := (DatabaseInspector{}).InspectChtTableSize(db); first != want {
+		t.Fatalf("section size mismatch: have %d, want %d", first, want)
+	}
+	processChtSection(t, backend, headers, 1, headers[CHTFrequencyServer-1].Hash())
+	second, err := GetChtSectionSize(db, 1)
+	if err != nil {
+		t.Fatalf("failed to read section size: %v", err)
+	}
+	if want, _ := (DatabaseInspector{}).InspectChtTableSize(db); first+second != want {
+		t.Fatalf("total section size mismatch: have %d, want %d", first+second, want)
+	}
+	if err := StoreChtSectionSize(db, 5, 1234); err != nil {
+		t.Fatalf("failed to store section size: %v", err)
+	}
+	if size, err := GetChtSectionSize(db, 5); err != nil || size != 1234 {
+		t.Fatalf("stored section size mismatch: have %d/%v, want 1234/nil", size, err)
+	}
+}
+
+func TestBloomTrieSectionSize(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	if _, err := GetBloomTrieSectionSize(db, 0); err != ErrSectionSizeUnknown {
+		t.Fatalf("missing section size: have %v, want %v", err, ErrSectionSizeUnknown)
+	}
+	if report := backend.StorageReport(); len(report) != 0 {
+		t.Fatalf("storage report of empty database: %v", report)
+	}
+	var (
+		lastHead common.Hash
+		total    uint64
+	)
+	for section := uint64(0); section < 2; section++ {
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+
+		size, err := GetBloomTrieSectionSize(db, section)
+		if err != nil || size == 0 {
+			t.Fatalf("section %d: size %d, err %v", section, size, err)
+		}
+		total += size
+	}
+	if want, _ := (DatabaseInspector{}).InspectBloomTrieTableSize(db); total != want {
+		t.Fatalf("total section size mismatch: have %d, want %d", total, want)
+	}
+	report := backend.StorageReport()
+	if len(report) != 2 {
+		t.Fatalf("storage report section count mismatch: have %d, want 2", len(report))
+	}
+	for section, size := range report {
+		if want, _ := GetBloomTrieSectionSize(db, section); size != want {
+			t.Errorf("section %d: reported size mismatch: have %d, want %d", section, size, want)
+		}
+	}
+}
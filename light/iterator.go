@@ -0,0 +1,129 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var errIteratorExhausted = errors.New("no more entries")
+
+// BloomTrieIterator iterates the entries of a single section of a stored
+// BloomTrie in bit index order. Bit indexes without any bits set in the section
+// have no entry and are skipped.
+type BloomTrieIterator struct {
+	section uint64
+	it      *trie.Iterator
+	pending bool // Whether the iterator is positioned on an entry not yet returned
+}
+
+// NewBloomTrieIterator creates an iterator over the entries of the BloomTrie
+// section stored with the given section head.
+func NewBloomTrieIterator(db ethdb.Database, section uint64, sectionHead common.Hash) (*BloomTrieIterator, error) {
+	root := GetBloomTrieRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return nil, ErrNoTrustedBloomTrie
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		return nil, err
+	}
+	return &BloomTrieIterator{section: section, it: trie.NewIterator(t.NodeIterator(nil))}, nil
+}
+
+// HasNext reports whether there are more entries to return.
+func (b *BloomTrieIterator) HasNext() bool {
+	// The trie contains the entries of all earlier sections too, interleaved
+	// with the requested ones
+	for !b.pending && b.it.Next() {
+		b.pending = len(b.it.Key) == 10 && binary.BigEndian.Uint64(b.it.Key[2:]) == b.section
+	}
+	return b.pending
+}
+
+// Next returns the bit index and compressed bloom bit vector of the next entry.
+func (b *BloomTrieIterator) Next() (bit uint, compressed []byte, err error) {
+	if !b.HasNext() {
+		if b.it.Err != nil {
+			return 0, nil, b.it.Err
+		}
+		return 0, nil, errIteratorExhausted
+	}
+	b.pending = false
+	return uint(binary.BigEndian.Uint16(b.it.Key)), common.CopyBytes(b.it.Value), nil
+}
+
+// ChtNodeIterator iterates the entries of the blocks of a single section of a
+// stored CHT in ascending block number order.
+type ChtNodeIterator struct {
+	version byte
+	end     uint64 // Number of the last block of the section
+	it      *trie.Iterator
+	pending bool // Whether the iterator is positioned on an entry not yet returned
+	done    bool // Whether the iterator moved past the end of the section
+}
+
+// NewChtNodeIterator creates an iterator over the entries of the CHT section of
+// the given size stored with the given section head.
+func NewChtNodeIterator(db ethdb.Database, section uint64, sectionHead common.Hash, sectionSize uint64) (*ChtNodeIterator, error) {
+	root, version := GetChtRootVersion(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return nil, ErrNoTrustedCht
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)))
+	if err != nil {
+		return nil, err
+	}
+	start := ComputeChtKey(ChtSectionStartBlock(section, sectionSize))
+	return &ChtNodeIterator{
+		version: version,
+		end:     ChtSectionHeadBlock(section, sectionSize),
+		it:      trie.NewIterator(t.NodeIterator(start[:])),
+	}, nil
+}
+
+// HasNext reports whether there are more entries to return.
+func (c *ChtNodeIterator) HasNext() bool {
+	if !c.pending && !c.done {
+		if c.it.Next() && len(c.it.Key) == 8 && binary.BigEndian.Uint64(c.it.Key) <= c.end {
+			c.pending = true
+		} else {
+			c.done = true
+		}
+	}
+	return c.pending
+}
+
+// Next returns the block number and CHT entry of the next block.
+func (c *ChtNodeIterator) Next() (blockNum uint64, node ChtNode, err error) {
+	if !c.HasNext() {
+		if c.it.Err != nil {
+			return 0, ChtNode{}, c.it.Err
+		}
+		return 0, ChtNode{}, errIteratorExhausted
+	}
+	c.pending = false
+	if node, err = DecodeChtNode(c.version, c.it.Value); err != nil {
+		return 0, ChtNode{}, err
+	}
+	return binary.BigEndian.Uint64(c.it.Key), node, nil
+}
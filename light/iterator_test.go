@@ -0,0 +1,124 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+// checkEmptyTestBloomBits fails if testBloomBits sets bits for the given bit index,
+// as bit indexes without any set bits have no BloomTrie entry.
+func checkEmptyTestBloomBits(t *testing.T, bit uint) {
+	for j := uint64(0); j < 2*BloomTrieFrequency/ethBloomBitsSection; j++ {
+		if !bytes.Equal(testBloomBits(bit, j, ethBloomBitsSection), make([]byte, ethBloomBitsSection/8)) {
+			t.Fatalf("bit %d skipped", bit)
+		}
+	}
+}
+
+func TestBloomTrieIterator(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 2; section++ {
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+	}
+	// Iterate the later section, the trie contains the entries of both
+	it, err := NewBloomTrieIterator(db, 1, lastHead)
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	next := uint(0)
+	for it.HasNext() {
+		bit, compressed, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to iterate: %v", err)
+		}
+		for ; next < bit; next++ {
+			checkEmptyTestBloomBits(t, next)
+		}
+		want, err := BloomTrieLookup(db, bit, 1, lastHead)
+		if err != nil {
+			t.Fatalf("bit %d: lookup failed: %v", bit, err)
+		}
+		if have, _ := bitutil.DecompressBytes(compressed, BloomTrieFrequency/8); !bytes.Equal(have, want) {
+			t.Fatalf("bit %d: bloom bits mismatch", bit)
+		}
+		next = bit + 1
+	}
+	for ; next < types.BloomBitLength; next++ {
+		checkEmptyTestBloomBits(t, next)
+	}
+	if _, _, err := it.Next(); err != errIteratorExhausted {
+		t.Fatalf("exhausted iterator: have %v, want %v", err, errIteratorExhausted)
+	}
+	if _, err := NewBloomTrieIterator(db, 2, lastHead); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("missing section: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
+
+func TestChtNodeIterator(t *testing.T) {
+	const sectionSize = 1000
+
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 3*sectionSize)
+	backend := newTestChtBackend(db, sectionSize)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 3; section++ {
+		processChtSection(t, backend, headers, section, lastHead)
+		lastHead = headers[(section+1)*sectionSize-1].Hash()
+	}
+	// Iterate a middle section, its CHT contains the entries of the first one too
+	head := headers[2*sectionSize-1].Hash()
+	it, err := NewChtNodeIterator(db, 1, head, sectionSize)
+	if err != nil {
+		t.Fatalf("failed to create iterator: %v", err)
+	}
+	next := uint64(sectionSize)
+	for it.HasNext() {
+		num, node, err := it.Next()
+		if err != nil {
+			t.Fatalf("failed to iterate: %v", err)
+		}
+		if num != next {
+			t.Fatalf("block number mismatch: have %d, want %d", num, next)
+		}
+		if node.Hash != headers[num].Hash() {
+			t.Fatalf("block %d: hash mismatch: have %x, want %x", num, node.Hash, headers[num].Hash())
+		}
+		next++
+	}
+	if next != 2*sectionSize {
+		t.Fatalf("iteration stopped at block %d", next)
+	}
+	if _, _, err := it.Next(); err != errIteratorExhausted {
+		t.Fatalf("exhausted iterator: have %v, want %v", err, errIteratorExhausted)
+	}
+	if _, err := NewChtNodeIterator(db, 3, lastHead, sectionSize); err != ErrNoTrustedCht {
+		t.Fatalf("missing section: have %v, want %v", err, ErrNoTrustedCht)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+
+	"github.com/akroma-project/akroma/common"
+)
+
+// Database keyspace of the light package. Helper trie roots and auxiliary data
+// are stored directly in the chain database under the key prefixes below, while
+// the trie nodes and the indexer progress live in tables, i.e. under the table
+// prefixes. No prefix may be a prefix of another one, or iterating over the keys
+// of one of them would also yield the keys of the other.
+var (
+	chtPrefix                  = []byte("chtRoot-")          // chtPrefix + chtNum (uint64 big endian) + hash -> trie root hash
+	chtReversePrefix           = []byte("chtRevRoot-")       // chtReversePrefix + chtNum (uint64 big endian) + hash -> reverse trie root hash
+	chtReverseHeadKey          = []byte("chtRevHead")        // root hash of the most recently committed reverse trie
+	chtPatchPrefix             = []byte("chtPatch-")         // chtPatchPrefix + chtNum (uint64 big endian) + hash -> root hash before patching
+	bloomTriePrefix            = []byte("bltRoot-")          // bloomTriePrefix + bloomTrieNum (uint64 big endian) + hash -> trie root hash
+	bloomTriePatchPrefix       = []byte("bltPatch-")         // bloomTriePatchPrefix + bloomTrieNum (uint64 big endian) + hash -> root hash before patching
+	signedCheckpointPrefix     = []byte("signedCheckpoint-") // signedCheckpointPrefix + genesis hash -> RLP encoded signed checkpoint
+	checkpointPrefix           = []byte("checkpoint-")       // checkpointPrefix + genesis hash + sectionIdx (uint64 big endian) -> RLP encoded trusted checkpoint
+	chtRootHistoryPrefix       = []byte("chtRootHistory-")   // chtRootHistoryPrefix + chtNum (uint64 big endian) -> RLP encoded recent roots
+	bloomTrieRootHistoryPrefix = []byte("bltRootHistory-")   // bloomTrieRootHistoryPrefix + bloomTrieNum (uint64 big endian) -> RLP encoded recent roots
+	chtSizePrefix              = []byte("chtSize-")          // chtSizePrefix + chtNum (uint64 big endian) -> trie node bytes written (uint64 big endian)
+	bloomTrieSizePrefix        = []byte("bltSize-")          // bloomTrieSizePrefix + bloomTrieNum (uint64 big endian) -> trie node bytes written (uint64 big endian)
+
+	ChtTablePrefix            = "cht-"      // CHT trie nodes
+	ChtReverseTablePrefix     = "chtr-"     // CHT reverse index trie nodes
+	BloomTrieTablePrefix      = "blt-"      // BloomTrie trie nodes
+	chtIndexTablePrefix       = "chtIndex-" // CHT indexer progress
+	bloomTrieIndexTablePrefix = "bltIndex-" // BloomTrie indexer progress
+)
+
+var errInvalidSectionKey = errors.New("invalid section key")
+
+// sectionIndexKey returns the database key of per-section data keyed only by the
+// section index, without the section head.
+func sectionIndexKey(prefix []byte, section uint64) []byte {
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], section)
+	return append(append([]byte{}, prefix...), encNumber[:]...)
+}
+
+// KeyEncoder converts between section identifiers and the database keys under
+// which data belonging to helper trie sections (like trie roots) is stored.
+type KeyEncoder interface {
+	// Encode returns the database key of the given section.
+	Encode(section uint64, head common.Hash) []byte
+
+	// Decode extracts the section identifier from a database key.
+	Decode(key []byte) (section uint64, head common.Hash, err error)
+}
+
+// sectionKeyEncoder is a KeyEncoder producing keys consisting of a prefix, the
+// big endian section index and the section head hash.
+type sectionKeyEncoder struct {
+	prefix []byte
+}
+
+// Encode implements KeyEncoder.
+func (e sectionKeyEncoder) Encode(section uint64, head common.Hash) []byte {
+	key := make([]byte, len(e.prefix)+8+common.HashLength)
+	copy(key, e.prefix)
+	binary.BigEndian.PutUint64(key[len(e.prefix):], section)
+	copy(key[len(e.prefix)+8:], head[:])
+	return key
+}
+
+// Decode implements KeyEncoder.
+func (e sectionKeyEncoder) Decode(key []byte) (uint64, common.Hash, error) {
+	if len(key) != len(e.prefix)+8+common.HashLength || !bytes.HasPrefix(key, e.prefix) {
+		return 0, common.Hash{}, errInvalidSectionKey
+	}
+	key = key[len(e.prefix):]
+	return binary.BigEndian.Uint64(key[:8]), common.BytesToHash(key[8:]), nil
+}
+
+var (
+	// DefaultChtKeyEncoder encodes the keys of stored CHT roots.
+	DefaultChtKeyEncoder KeyEncoder = sectionKeyEncoder{chtPrefix}
+
+	bloomTrieKeyEncoder      KeyEncoder = sectionKeyEncoder{bloomTriePrefix}
+	chtReverseKeyEncoder     KeyEncoder = sectionKeyEncoder{chtReversePrefix}
+	chtPatchKeyEncoder       KeyEncoder = sectionKeyEncoder{chtPatchPrefix}
+	bloomTriePatchKeyEncoder KeyEncoder = sectionKeyEncoder{bloomTriePatchPrefix}
+)
+
+// ComputeChtKey returns the CHT key of the entry of the given block: the block
+// number as a big endian uint64.
+func ComputeChtKey(blockNum uint64) [8]byte {
+	var key [8]byte
+	binary.BigEndian.PutUint64(key[:], blockNum)
+	return key
+}
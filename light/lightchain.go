@@ -69,13 +69,26 @@ type LightChain struct {
 	procInterrupt int32 // interrupt signaler for block processing
 	wg            sync.WaitGroup
 
-	engine consensus.Engine
+	engine   consensus.Engine
+	verifier ProofVerifier // verifier for CHT proofs of headers retrieved on demand (nil: Merkle proof only)
+}
+
+// LightChainOption configures optional behaviour of the light chain.
+type LightChainOption func(*LightChain)
+
+// WithProofVerifier sets an additional verifier for the CHT proofs of headers
+// retrieved on demand. By default none is set and the proofs are only checked
+// while reading the entry from the Merkle proof.
+func WithProofVerifier(verifier ProofVerifier) LightChainOption {
+	return func(bc *LightChain) {
+		bc.verifier = verifier
+	}
 }
 
 // NewLightChain returns a fully initialised light chain using information
 // available in the database. It initialises the default Ethereum header
 // validator.
-func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.Engine) (*LightChain, error) {
+func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.Engine, opts ...LightChainOption) (*LightChain, error) {
 	bodyCache, _ := lru.New(bodyCacheLimit)
 	bodyRLPCache, _ := lru.New(bodyCacheLimit)
 	blockCache, _ := lru.New(blockCacheLimit)
@@ -89,6 +102,9 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 		blockCache:   blockCache,
 		engine:       engine,
 	}
+	for _, opt := range opts {
+		opt(bc)
+	}
 	var err error
 	bc.hc, err = core.NewHeaderChain(odr.Database(), config, bc.engine, bc.getProcInterrupt)
 	if err != nil {
@@ -98,8 +114,12 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 	if bc.genesisBlock == nil {
 		return nil, core.ErrNoGenesis
 	}
-	if cp, ok := trustedCheckpoints[bc.genesisBlock.Hash()]; ok {
-		bc.addTrustedCheckpoint(cp)
+	if cp, ok := NewCheckpointRegistry(bc.chainDb).Lookup(bc.genesisBlock.Hash()); ok {
+		if err := cp.Validate(); err != nil {
+			log.Error("Ignoring invalid trusted checkpoint", "err", err)
+		} else {
+			bc.addTrustedCheckpoint(cp)
+		}
 	}
 	if err := bc.loadLastState(); err != nil {
 		return nil, err
@@ -116,7 +136,7 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 }
 
 // addTrustedCheckpoint adds a trusted checkpoint to the blockchain
-func (self *LightChain) addTrustedCheckpoint(cp trustedCheckpoint) {
+func (self *LightChain) addTrustedCheckpoint(cp TrustedCheckpoint) {
 	if self.odr.ChtIndexer() != nil {
 		StoreChtRoot(self.chainDb, cp.sectionIdx, cp.sectionHead, cp.chtRoot)
 		self.odr.ChtIndexer().AddKnownSectionHead(cp.sectionIdx, cp.sectionHead)
@@ -128,7 +148,13 @@ func (self *LightChain) addTrustedCheckpoint(cp trustedCheckpoint) {
 	if self.odr.BloomIndexer() != nil {
 		self.odr.BloomIndexer().AddKnownSectionHead(cp.sectionIdx, cp.sectionHead)
 	}
-	log.Info("Added trusted checkpoint", "chain", cp.name, "block", (cp.sectionIdx+1)*CHTFrequencyClient-1, "hash", cp.sectionHead)
+	log.Info("Added trusted checkpoint", "chain", cp.name, "block", ChtSectionHeadBlock(cp.sectionIdx, CHTFrequencyClient), "hash", cp.sectionHead)
+}
+
+// ProofVerifier returns the verifier set with WithProofVerifier, or nil if none
+// was set.
+func (self *LightChain) ProofVerifier() ProofVerifier {
+	return self.verifier
 }
 
 func (self *LightChain) getProcInterrupt() bool {
@@ -445,7 +471,7 @@ func (self *LightChain) GetHeaderByNumberOdr(ctx context.Context, number uint64)
 	if header := self.hc.GetHeaderByNumber(number); header != nil {
 		return header, nil
 	}
-	return GetHeaderByNumber(ctx, self.odr, number)
+	return getHeaderByNumber(ctx, self.odr, number, self.verifier)
 }
 
 // Config retrieves the header chain's chain configuration.
@@ -457,9 +483,9 @@ func (self *LightChain) SyncCht(ctx context.Context) bool {
 	}
 	headNum := self.CurrentHeader().Number.Uint64()
 	chtCount, _, _ := self.odr.ChtIndexer().Sections()
-	if headNum+1 < chtCount*CHTFrequencyClient {
-		num := chtCount*CHTFrequencyClient - 1
-		header, err := GetHeaderByNumber(ctx, self.odr, num)
+	if headNum+1 < ChtSectionStartBlock(chtCount, CHTFrequencyClient) {
+		num := ChtSectionHeadBlock(chtCount-1, CHTFrequencyClient)
+		header, err := getHeaderByNumber(ctx, self.odr, num, self.verifier)
 		if header != nil && err == nil {
 			self.mu.Lock()
 			if self.hc.CurrentHeader().Number.Uint64() < header.Number.Uint64() {
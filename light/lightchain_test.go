@@ -347,3 +347,25 @@ func TestReorgBadHeaderHashes(t *testing.T) {
 		t.Errorf("last header hash mismatch: have: %x, want %x", ncm.CurrentHeader().Hash(), headers[2].Hash())
 	}
 }
+
+// Tests that CHT proofs are only passed to a verifier set with WithProofVerifier.
+func TestLightChainProofVerifier(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	gspec := core.Genesis{Config: params.TestChainConfig}
+	gspec.MustCommit(db)
+
+	lc, err := NewLightChain(&dummyOdr{db: db}, gspec.Config, ethash.NewFaker())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verifier := lc.ProofVerifier(); verifier != nil {
+		t.Fatalf("default verifier mismatch: have %T, want nil", verifier)
+	}
+	lc, err = NewLightChain(&dummyOdr{db: db}, gspec.Config, ethash.NewFaker(), WithProofVerifier(SNARKProofVerifier{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lc.ProofVerifier().(SNARKProofVerifier); !ok {
+		t.Fatalf("configured verifier mismatch: have %T, want SNARKProofVerifier", lc.ProofVerifier())
+	}
+}
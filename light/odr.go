@@ -134,6 +134,7 @@ type ChtRequest struct {
 	OdrRequest
 	ChtNum, BlockNum uint64
 	ChtRoot          common.Hash
+	Verifier         ProofVerifier // Checks the retrieved CHT proof (nil: Merkle proof only)
 	Header           *types.Header
 	Td               *big.Int
 	Proof            *NodeSet
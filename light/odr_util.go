@@ -25,12 +25,20 @@ import (
 	"github.com/akroma-project/akroma/core/rawdb"
 	"github.com/akroma-project/akroma/core/types"
 	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/ethdb"
 	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
 )
 
 var sha3_nil = crypto.Keccak256Hash(nil)
 
 func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*types.Header, error) {
+	return getHeaderByNumber(ctx, odr, number, nil)
+}
+
+// getHeaderByNumber retrieves a canonical header, checking the CHT proof of headers
+// retrieved from the network with the given verifier if not nil.
+func getHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64, verifier ProofVerifier) (*types.Header, error) {
 	db := odr.Database()
 	hash := rawdb.ReadCanonicalHash(db, number)
 	if (hash != common.Hash{}) {
@@ -53,16 +61,16 @@ func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*typ
 		for chtCount > 0 && canonicalHash != sectionHead && canonicalHash != (common.Hash{}) {
 			chtCount--
 			if chtCount > 0 {
-				sectionHeadNum = chtCount*CHTFrequencyClient - 1
+				sectionHeadNum = ChtSectionHeadBlock(chtCount-1, CHTFrequencyClient)
 				sectionHead = odr.ChtIndexer().SectionHead(chtCount - 1)
 				canonicalHash = rawdb.ReadCanonicalHash(db, sectionHeadNum)
 			}
 		}
 	}
-	if number >= chtCount*CHTFrequencyClient {
+	if number >= ChtSectionStartBlock(chtCount, CHTFrequencyClient) {
 		return nil, ErrNoTrustedCht
 	}
-	r := &ChtRequest{ChtRoot: GetChtRoot(db, chtCount-1, sectionHead), ChtNum: chtCount - 1, BlockNum: number}
+	r := &ChtRequest{ChtRoot: GetChtRoot(db, chtCount-1, sectionHead), ChtNum: chtCount - 1, BlockNum: number, Verifier: verifier}
 	if err := odr.Retrieve(ctx, r); err != nil {
 		return nil, err
 	}
@@ -230,3 +238,38 @@ func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxLi
 		return result, nil
 	}
 }
+
+// BloomBitsLookup retrieves the compressed bloom bit vector of the given bit index
+// in a BloomTrie section, reading it from the local BloomTrie of the section if
+// its nodes are available (e.g. built by the server side indexer). Otherwise the
+// vector is retrieved through the fallback backend like GetBloomBits, unless the
+// fallback is nil.
+func BloomBitsLookup(ctx context.Context, db ethdb.Database, bit uint, section uint64, sectionHead common.Hash, fallback OdrBackend) ([]byte, error) {
+	bits, err := localBloomBits(db, bit, section, sectionHead)
+	if err == nil {
+		return bits, nil
+	}
+	if fallback == nil {
+		return nil, err
+	}
+	bitsets, err := GetBloomBits(ctx, fallback, bit, []uint64{section})
+	if err != nil {
+		return nil, err
+	}
+	return bitsets[0], nil
+}
+
+// localBloomBits reads a compressed bloom bit vector from the locally stored
+// BloomTrie of the given section.
+func localBloomBits(db ethdb.Database, bit uint, section uint64, sectionHead common.Hash) ([]byte, error) {
+	root := GetBloomTrieRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return nil, ErrNoTrustedBloomTrie
+	}
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		return nil, err
+	}
+	encKey := ComputeHelperTrieKey(bit, section)
+	return t.TryGet(encKey[:])
+}
@@ -0,0 +1,132 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync"
+
+	"github.com/akroma-project/akroma/event"
+)
+
+// BlockNumberSource is a source of block numbers known to the light client, such
+// as the end of the last committed CHT section, the local header chain head or
+// the head announced by a server.
+type BlockNumberSource interface {
+	// BlockNumber returns the highest block number currently known to the source.
+	BlockNumber() uint64
+
+	// SubscribeBlockNumber notifies ch whenever the source learns of a new block number.
+	SubscribeBlockNumber(ch chan<- uint64) event.Subscription
+}
+
+// BlockNumberOracle merges a set of block number sources and tracks the highest
+// block number reported by any of them.
+type BlockNumberOracle struct {
+	highest uint64
+	subs    []chan uint64
+
+	sourceSubs []event.Subscription
+	wg         sync.WaitGroup
+	lock       sync.Mutex
+}
+
+// NewBlockNumberOracle creates an oracle tracking the given sources. The oracle
+// must be stopped with Stop once it is no longer needed.
+func NewBlockNumberOracle(sources ...BlockNumberSource) *BlockNumberOracle {
+	o := new(BlockNumberOracle)
+	for _, source := range sources {
+		ch := make(chan uint64, 16)
+		o.sourceSubs = append(o.sourceSubs, source.SubscribeBlockNumber(ch))
+		o.advance(source.BlockNumber())
+
+		o.wg.Add(1)
+		go o.loop(ch, o.sourceSubs[len(o.sourceSubs)-1])
+	}
+	return o
+}
+
+// loop feeds the block numbers received from a single source into the oracle
+// until the source subscription ends.
+func (o *BlockNumberOracle) loop(ch <-chan uint64, sub event.Subscription) {
+	defer o.wg.Done()
+
+	for {
+		select {
+		case number := <-ch:
+			o.advance(number)
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
+// advance raises the highest known block number and notifies the subscribers
+// if number is above it.
+func (o *BlockNumberOracle) advance(number uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if number <= o.highest {
+		return
+	}
+	o.highest = number
+	for _, ch := range o.subs {
+		// Subscribers are only interested in the latest number, replace any
+		// stale one not yet received.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- number
+	}
+}
+
+// Highest returns the highest block number reported by any of the sources.
+func (o *BlockNumberOracle) Highest() uint64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	return o.highest
+}
+
+// Subscribe returns a channel receiving the highest block number whenever it
+// advances. Numbers not received before the next advance are dropped, so a slow
+// reader only ever sees the latest one. The channel is closed by Stop.
+func (o *BlockNumberOracle) Subscribe() <-chan uint64 {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	ch := make(chan uint64, 1)
+	o.subs = append(o.subs, ch)
+	return ch
+}
+
+// Stop unsubscribes from all sources and closes the subscriber channels.
+func (o *BlockNumberOracle) Stop() {
+	for _, sub := range o.sourceSubs {
+		sub.Unsubscribe()
+	}
+	o.wg.Wait()
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for _, ch := range o.subs {
+		close(ch)
+	}
+	o.subs = nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akroma-project/akroma/event"
+)
+
+// testBlockNumberSource is a block number source advanced manually by the test.
+type testBlockNumberSource struct {
+	number uint64
+	feed   event.Feed
+}
+
+func (s *testBlockNumberSource) BlockNumber() uint64 {
+	return atomic.LoadUint64(&s.number)
+}
+
+func (s *testBlockNumberSource) SubscribeBlockNumber(ch chan<- uint64) event.Subscription {
+	return s.feed.Subscribe(ch)
+}
+
+func (s *testBlockNumberSource) set(number uint64) {
+	atomic.StoreUint64(&s.number, number)
+	s.feed.Send(number)
+}
+
+// Tests that the oracle tracks the highest number reported by any source and
+// only notifies subscribers when it advances.
+func TestBlockNumberOracle(t *testing.T) {
+	cht := &testBlockNumberSource{number: 32767}
+	local := &testBlockNumberSource{number: 40000}
+	peer := new(testBlockNumberSource)
+
+	oracle := NewBlockNumberOracle(cht, local, peer)
+	defer oracle.Stop()
+
+	if highest := oracle.Highest(); highest != 40000 {
+		t.Fatalf("initial highest mismatch: have %d, want %d", highest, 40000)
+	}
+	updates := oracle.Subscribe()
+
+	expect := func(want uint64) {
+		t.Helper()
+		select {
+		case have := <-updates:
+			if have != want {
+				t.Fatalf("update mismatch: have %d, want %d", have, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no update for %d", want)
+		}
+		if highest := oracle.Highest(); highest != want {
+			t.Fatalf("highest mismatch: have %d, want %d", highest, want)
+		}
+	}
+	peer.set(40100)
+	expect(40100)
+
+	// A source falling behind the others must not produce an update
+	local.set(40050)
+	cht.set(65535)
+	expect(65535)
+
+	select {
+	case number := <-updates:
+		t.Fatalf("unexpected update %d", number)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// Tests that stopping the oracle closes the subscriber channels.
+func TestBlockNumberOracleStop(t *testing.T) {
+	oracle := NewBlockNumberOracle(new(testBlockNumberSource))
+	updates := oracle.Subscribe()
+	oracle.Stop()
+
+	if _, ok := <-updates; ok {
+		t.Fatal("subscription not closed")
+	}
+}
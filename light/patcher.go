@@ -0,0 +1,199 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/log"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var (
+	errNoPatchBackup = errors.New("no pre-patch root stored for section")
+	errChtNotLatest  = errors.New("CHT section is not the latest one")
+)
+
+// laterSectionStored reports whether a root of the section following the given
+// one is stored under any section head with the given key encoder. Helper trie
+// sections are cumulative, so such a section contains all entries of the given
+// one.
+func laterSectionStored(db ethdb.Database, enc KeyEncoder, section uint64) (bool, error) {
+	key := enc.Encode(section+1, common.Hash{})
+	next, err := firstKeyWithPrefix(db, key[:len(key)-common.HashLength])
+	return next != nil, err
+}
+
+// storePatchBackup stores the pre-patch root of a section unless the section was
+// already patched before.
+func storePatchBackup(db ethdb.Database, key []byte, root common.Hash) error {
+	if has, err := db.Has(key); err != nil || has {
+		return err
+	}
+	return db.Put(key, root.Bytes())
+}
+
+// ChtPatch is a corrected CHT entry of a single block.
+type ChtPatch struct {
+	BlockNum    uint64
+	CorrectNode ChtNode
+}
+
+// ChtPatcher replaces individual entries of stored CHT sections, avoiding the
+// rebuild of an entire section to fix a few incorrect entries.
+type ChtPatcher struct {
+	sectionSize uint64
+}
+
+// NewChtPatcher creates a patcher for CHTs with the given section size.
+func NewChtPatcher(sectionSize uint64) *ChtPatcher {
+	return &ChtPatcher{sectionSize: sectionSize}
+}
+
+// Apply writes the patched entries into the CHT of the given section and stores
+// the resulting root in place of the current one. The root from before the first
+// patch of the section is kept, see Rollback. As later sections contain all entries
+// of the earlier ones, only the latest stored section can be patched.
+func (p *ChtPatcher) Apply(db ethdb.Database, section uint64, sectionHead common.Hash, patches []ChtPatch) (newRoot common.Hash, err error) {
+	root := GetChtRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return common.Hash{}, ErrNoTrustedCht
+	}
+	if later, err := laterSectionStored(db, DefaultChtKeyEncoder, section); err != nil {
+		return common.Hash{}, err
+	} else if later {
+		return common.Hash{}, errChtNotLatest
+	}
+	triedb := trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix))
+	t, err := trie.New(root, triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	start, end := ChtSectionStartBlock(section, p.sectionSize), ChtSectionHeadBlock(section, p.sectionSize)
+	for _, patch := range patches {
+		if patch.BlockNum < start || patch.BlockNum > end {
+			return common.Hash{}, fmt.Errorf("block %d outside of CHT section %d", patch.BlockNum, section)
+		}
+		data, err := rlp.EncodeToBytes(patch.CorrectNode)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		encNumber := ComputeChtKey(patch.BlockNum)
+		t.Update(encNumber[:], data)
+	}
+	if newRoot, err = t.Commit(nil); err != nil {
+		return common.Hash{}, err
+	}
+	if err := triedb.Commit(newRoot, false); err != nil {
+		return common.Hash{}, err
+	}
+	if err := storePatchBackup(db, chtPatchKeyEncoder.Encode(section, sectionHead), root); err != nil {
+		return common.Hash{}, err
+	}
+	StoreChtRoot(db, section, sectionHead, newRoot)
+	log.Info("Patched CHT section", "section", section, "head", sectionHead, "entries", len(patches), "old", root, "new", newRoot)
+	return newRoot, nil
+}
+
+// Rollback restores the root the given CHT section had before it was patched.
+func (p *ChtPatcher) Rollback(db ethdb.Database, section uint64, sectionHead common.Hash) error {
+	backupKey := chtPatchKeyEncoder.Encode(section, sectionHead)
+	data, _ := db.Get(backupKey)
+	if len(data) != common.HashLength {
+		return errNoPatchBackup
+	}
+	StoreChtRoot(db, section, sectionHead, common.BytesToHash(data))
+	return db.Delete(backupKey)
+}
+
+// BloomTriePatch is a corrected compressed bloom bit vector of a single bit index.
+type BloomTriePatch struct {
+	Bit        uint
+	Compressed []byte
+}
+
+// BloomTriePatcher replaces individual bit entries of stored BloomTrie sections.
+type BloomTriePatcher struct{}
+
+// NewBloomTriePatcher creates a BloomTrie patcher.
+func NewBloomTriePatcher() *BloomTriePatcher {
+	return &BloomTriePatcher{}
+}
+
+// Apply writes the patched bit entries into the BloomTrie of the given section and
+// stores the resulting root in place of the current one. The root from before the
+// first patch of the section is kept, see Rollback. As later sections contain all
+// entries of the earlier ones, only the latest stored section can be patched.
+func (p *BloomTriePatcher) Apply(db ethdb.Database, section uint64, sectionHead common.Hash, patches []BloomTriePatch) (newRoot common.Hash, err error) {
+	root := GetBloomTrieRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return common.Hash{}, ErrNoTrustedBloomTrie
+	}
+	if later, err := laterSectionStored(db, bloomTrieKeyEncoder, section); err != nil {
+		return common.Hash{}, err
+	} else if later {
+		return common.Hash{}, errBloomTrieNotLatest
+	}
+	triedb := trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix))
+	t, err := trie.New(root, triedb)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	for _, patch := range patches {
+		if patch.Bit >= types.BloomBitLength {
+			return common.Hash{}, fmt.Errorf("bloom bit index %d out of range", patch.Bit)
+		}
+		if _, err := bitutil.DecompressBytes(patch.Compressed, BloomTrieFrequency/8); err != nil {
+			return common.Hash{}, fmt.Errorf("invalid bloom bits for bit %d: %v", patch.Bit, err)
+		}
+		encKey := ComputeHelperTrieKey(patch.Bit, section)
+		if len(patch.Compressed) > 0 {
+			t.Update(encKey[:], patch.Compressed)
+		} else {
+			t.Delete(encKey[:])
+		}
+	}
+	if newRoot, err = t.Commit(nil); err != nil {
+		return common.Hash{}, err
+	}
+	if err := triedb.Commit(newRoot, false); err != nil {
+		return common.Hash{}, err
+	}
+	if err := storePatchBackup(db, bloomTriePatchKeyEncoder.Encode(section, sectionHead), root); err != nil {
+		return common.Hash{}, err
+	}
+	StoreBloomTrieRoot(db, section, sectionHead, newRoot)
+	log.Info("Patched bloom trie section", "section", section, "head", sectionHead, "entries", len(patches), "old", root, "new", newRoot)
+	return newRoot, nil
+}
+
+// Rollback restores the root the given BloomTrie section had before it was patched.
+func (p *BloomTriePatcher) Rollback(db ethdb.Database, section uint64, sectionHead common.Hash) error {
+	backupKey := bloomTriePatchKeyEncoder.Encode(section, sectionHead)
+	data, _ := db.Get(backupKey)
+	if len(data) != common.HashLength {
+		return errNoPatchBackup
+	}
+	StoreBloomTrieRoot(db, section, sectionHead, common.BytesToHash(data))
+	return db.Delete(backupKey)
+}
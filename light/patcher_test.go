@@ -0,0 +1,127 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+)
+
+func TestChtPatcher(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+
+	head := headers[len(headers)-1].Hash()
+	oldRoot := GetChtRoot(db, 0, head)
+	patcher := NewChtPatcher(CHTFrequencyServer)
+
+	if _, err := patcher.Apply(db, 0, head, []ChtPatch{{BlockNum: CHTFrequencyServer}}); err == nil {
+		t.Fatalf("patch outside of section accepted")
+	}
+	patch := ChtPatch{BlockNum: 7, CorrectNode: ChtNode{Hash: common.Hash{7}, Td: big.NewInt(7)}}
+	newRoot, err := patcher.Apply(db, 0, head, []ChtPatch{patch})
+	if err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+	if newRoot == oldRoot || GetChtRoot(db, 0, head) != newRoot {
+		t.Fatalf("patched root not stored")
+	}
+	proof, err := makeMerkleProofSet(db, newRoot, 7, 8)
+	if err != nil {
+		t.Fatalf("failed to prove patched section: %v", err)
+	}
+	nodes, err := proof.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify patched section: %v", err)
+	}
+	if !nodes[7].Equal(patch.CorrectNode) {
+		t.Errorf("patched entry mismatch: have %v, want %v", nodes[7], patch.CorrectNode)
+	}
+	if nodes[8].Hash != headers[8].Hash() {
+		t.Errorf("unpatched entry changed: have %x, want %x", nodes[8].Hash, headers[8].Hash())
+	}
+	if err := patcher.Rollback(db, 0, head); err != nil {
+		t.Fatalf("failed to roll back patch: %v", err)
+	}
+	if root := GetChtRoot(db, 0, head); root != oldRoot {
+		t.Fatalf("rolled back root mismatch: have %x, want %x", root, oldRoot)
+	}
+	if err := patcher.Rollback(db, 0, head); err != errNoPatchBackup {
+		t.Fatalf("second rollback: have %v, want %v", err, errNoPatchBackup)
+	}
+	// Sections followed by later ones must not be patched
+	StoreChtRoot(db, 1, common.Hash{1}, common.Hash{2})
+	if _, err := patcher.Apply(db, 0, head, []ChtPatch{patch}); err != errChtNotLatest {
+		t.Fatalf("patch of older section: have %v, want %v", err, errChtNotLatest)
+	}
+}
+
+func TestBloomTriePatcher(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+
+	head := heads[len(heads)-1].Hash()
+	oldRoot := GetBloomTrieRoot(db, 0, head)
+	patcher := NewBloomTriePatcher()
+
+	if _, err := patcher.Apply(db, 0, head, []BloomTriePatch{{Bit: types.BloomBitLength}}); err == nil {
+		t.Fatalf("out of range bit accepted")
+	}
+	want := make([]byte, BloomTrieFrequency/8)
+	want[100] = 0x42
+	if _, err := patcher.Apply(db, 0, head, []BloomTriePatch{{Bit: 5, Compressed: bitutil.CompressBytes(want)}}); err != nil {
+		t.Fatalf("failed to apply patch: %v", err)
+	}
+	have, err := BloomTrieLookup(db, 5, 0, head)
+	if err != nil {
+		t.Fatalf("failed to read patched entry: %v", err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Errorf("patched entry mismatch")
+	}
+	if err := patcher.Rollback(db, 0, head); err != nil {
+		t.Fatalf("failed to roll back patch: %v", err)
+	}
+	if root := GetBloomTrieRoot(db, 0, head); root != oldRoot {
+		t.Fatalf("rolled back root mismatch: have %x, want %x", root, oldRoot)
+	}
+	StoreBloomTrieRoot(db, 1, common.Hash{1}, common.Hash{2})
+	if _, err := patcher.Apply(db, 0, head, []BloomTriePatch{{Bit: 5}}); err != errBloomTrieNotLatest {
+		t.Fatalf("patch of older section: have %v, want %v", err, errBloomTrieNotLatest)
+	}
+}
+
+// makeMerkleProofSet collects the CHT proofs of the given blocks into a set.
+func makeMerkleProofSet(db ethdb.Database, root common.Hash, blocks ...uint64) (*MerkleProofSet, error) {
+	set := NewMerkleProofSet(root)
+	for _, num := range blocks {
+		proof, err := proveChtEntry(db, root, num)
+		if err != nil {
+			return nil, err
+		}
+		set.Add(num, proof)
+	}
+	return set, nil
+}
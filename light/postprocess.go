@@ -17,9 +17,17 @@
 package light
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/akroma-project/akroma/common"
@@ -29,6 +37,7 @@ import (
 	"github.com/akroma-project/akroma/core/types"
 	"github.com/akroma-project/akroma/ethdb"
 	"github.com/akroma-project/akroma/log"
+	"github.com/akroma-project/akroma/metrics"
 	"github.com/akroma-project/akroma/params"
 	"github.com/akroma-project/akroma/rlp"
 	"github.com/akroma-project/akroma/trie"
@@ -45,19 +54,58 @@ const (
 
 	HelperTrieConfirmations        = 2048 // number of confirmations before a server is expected to have the given HelperTrie available
 	HelperTrieProcessConfirmations = 256  // number of confirmations before a HelperTrie is generated
+
+	// ChtVersion is the version of the CHT entry format, stored along with each CHT
+	// root so entries of different formats can be told apart. Roots stored without
+	// a version predate versioning and use the version 1 format.
+	ChtVersion = 1
+
+	chtFlushCheckInterval = 256 // number of processed blocks between dirty node checks if partial flushing is enabled
+	chtBytesPerBlock      = 45  // default estimate of the CHT node bytes stored per block, see SectionSizeBytes
+
+	chtShrinkThreshold = 4096 // number of dirty CHT nodes at Commit above which the trie is reopened, see ShrinkTrie
+
+	chtResetAttempts = 3                      // number of attempts to open the CHT trie in Reset
+	chtResetBackoff  = 100 * time.Millisecond // delay before the first retry, doubled after each attempt
+)
+
+var (
+	chtResetFailureCounter = metrics.NewRegisteredCounter("light/cht/reset/failures", nil)
+
+	// Registered counterparts of ProcessMetrics, summed over all CHT indexers
+	chtProcessedCounter     = metrics.NewRegisteredCounter("light/cht/process/blocks", nil)
+	chtNilTdCounter         = metrics.NewRegisteredCounter("light/cht/process/nilTd", nil)
+	chtEncodingErrorCounter = metrics.NewRegisteredCounter("light/cht/process/encodingErrors", nil)
 )
 
-// trustedCheckpoint represents a set of post-processed trie roots (CHT and BloomTrie) associated with
+// TrustedCheckpoint represents a set of post-processed trie roots (CHT and BloomTrie) associated with
 // the appropriate section index and head hash. It is used to start light syncing from this checkpoint
 // and avoid downloading the entire header chain while still being able to securely access old headers/logs.
-type trustedCheckpoint struct {
+type TrustedCheckpoint struct {
 	name                                string
 	sectionIdx                          uint64
 	sectionHead, chtRoot, bloomTrieRoot common.Hash
+	annotation                          *CheckpointAnnotation // informational block metadata (nil if not annotated)
+}
+
+// Validate checks that none of the section index, section head and trie roots of
+// the checkpoint is left at its zero value.
+func (cp TrustedCheckpoint) Validate() error {
+	switch {
+	case cp.sectionIdx == 0:
+		return fmt.Errorf("checkpoint %q: missing section index", cp.name)
+	case cp.sectionHead == (common.Hash{}):
+		return fmt.Errorf("checkpoint %q: missing section head", cp.name)
+	case cp.chtRoot == (common.Hash{}):
+		return fmt.Errorf("checkpoint %q: missing CHT root", cp.name)
+	case cp.bloomTrieRoot == (common.Hash{}):
+		return fmt.Errorf("checkpoint %q: missing BloomTrie root", cp.name)
+	}
+	return nil
 }
 
 var (
-	mainnetCheckpoint = trustedCheckpoint{
+	mainnetCheckpoint = TrustedCheckpoint{
 		name:          "mainnet",
 		sectionIdx:    174,
 		sectionHead:   common.HexToHash("a3ef48cd8f1c3a08419f0237fc7763491fe89497b3144b17adf87c1c43664613"),
@@ -65,7 +113,7 @@ var (
 		bloomTrieRoot: common.HexToHash("6b7497a4a03e33870a2383cb6f5e70570f12b1bf5699063baf8c71d02ca90b02"),
 	}
 
-	ropstenCheckpoint = trustedCheckpoint{
+	ropstenCheckpoint = TrustedCheckpoint{
 		name:          "ropsten",
 		sectionIdx:    102,
 		sectionHead:   common.HexToHash("9017ab08465cb2b2dee035ee5b817bbd7fa28e2c8d2cd903e0aed1cccb249e89"),
@@ -74,18 +122,27 @@ var (
 	}
 )
 
-// trustedCheckpoints associates each known checkpoint with the genesis hash of the chain it belongs to
-var trustedCheckpoints = map[common.Hash]trustedCheckpoint{
-	params.MainnetGenesisHash: mainnetCheckpoint,
-	params.TestnetGenesisHash: ropstenCheckpoint,
+// trustedCheckpoints associates the known checkpoints with the genesis hash of the chain they belong to
+var trustedCheckpoints = map[common.Hash]*TrustedCheckpointSet{
+	params.MainnetGenesisHash: NewTrustedCheckpointSet(mainnetCheckpoint),
+	params.TestnetGenesisHash: NewTrustedCheckpointSet(ropstenCheckpoint),
 }
 
 var (
 	ErrNoTrustedCht       = errors.New("No trusted canonical hash trie")
 	ErrNoTrustedBloomTrie = errors.New("No trusted bloom trie")
 	ErrNoHeader           = errors.New("Header not found")
-	chtPrefix             = []byte("chtRoot-") // chtPrefix + chtNum (uint64 big endian) -> trie root hash
-	ChtTablePrefix        = "cht-"
+
+	ErrNotInReverseIndex = errors.New("block hash not found in CHT reverse index")
+
+	ErrIncompleteSectionHeads = errors.New("bloom trie section heads incomplete")
+
+	ErrTrieNotInitialized = errors.New("helper trie not initialized, Reset failed")
+
+	errBloomTrieNotLatest = errors.New("bloom trie section is not the latest one")
+	errChtNoSection       = errors.New("no CHT section being processed")
+	errTrieDirty          = errors.New("helper trie has uncommitted changes")
+	errUnknownChtVersion  = errors.New("unknown CHT entry version")
 )
 
 // ChtNode structures are stored in the Canonical Hash Trie in an RLP encoded format
@@ -94,13 +151,115 @@ type ChtNode struct {
 	Td   *big.Int
 }
 
+// Equal reports whether the two nodes contain the same hash and total difficulty.
+func (n ChtNode) Equal(other ChtNode) bool {
+	if n.Hash != other.Hash {
+		return false
+	}
+	if n.Td == nil || other.Td == nil {
+		return n.Td == other.Td
+	}
+	return n.Td.Cmp(other.Td) == 0
+}
+
+// ChtNodePool is a pool of ChtNode values reused while encoding CHT entries, so
+// processing a block does not allocate a node to pass to the encoder.
+type ChtNodePool struct {
+	pool sync.Pool
+}
+
+// NewChtNodePool creates an empty node pool.
+func NewChtNodePool() *ChtNodePool {
+	return &ChtNodePool{pool: sync.Pool{New: func() interface{} { return &ChtNode{Td: new(big.Int)} }}}
+}
+
+// Get returns a node from the pool, allocating a new one if none is available.
+// The contents of the node are undefined.
+func (p *ChtNodePool) Get() *ChtNode {
+	return p.pool.Get().(*ChtNode)
+}
+
+// Put returns a node obtained from Get to the pool. The node must not be used
+// afterwards.
+func (p *ChtNodePool) Put(node *ChtNode) {
+	p.pool.Put(node)
+}
+
+// chtNodePool holds the nodes encoded by the CHT indexer backends.
+var chtNodePool = NewChtNodePool()
+
+// DecodeChtNode decodes a CHT entry encoded in the format of the given version.
+func DecodeChtNode(version byte, data []byte) (ChtNode, error) {
+	var node ChtNode
+	switch version {
+	case 0, 1:
+		err := rlp.DecodeBytes(data, &node)
+		return node, err
+	default:
+		return node, errUnknownChtVersion
+	}
+}
+
+// ChtSectionStartBlock returns the number of the first block in the given section.
+func ChtSectionStartBlock(sectionIdx, sectionSize uint64) uint64 {
+	return sectionIdx * sectionSize
+}
+
+// ChtSectionHeadBlock returns the number of the last block (the section head) in
+// the given section.
+func ChtSectionHeadBlock(sectionIdx, sectionSize uint64) uint64 {
+	return (sectionIdx+1)*sectionSize - 1
+}
+
+// AlignToSection returns the inclusive block range of the section of the given
+// size containing blockNum.
+func AlignToSection(blockNum, sectionSize uint64) (sectionStart, sectionEnd uint64) {
+	section := blockNum / sectionSize
+	return ChtSectionStartBlock(section, sectionSize), ChtSectionHeadBlock(section, sectionSize)
+}
+
 // GetChtRoot reads the CHT root assoctiated to the given section from the database
 // Note that sectionIdx is specified according to LES/1 CHT section size
 func GetChtRoot(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) common.Hash {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], sectionIdx)
-	data, _ := db.Get(append(append(chtPrefix, encNumber[:]...), sectionHead.Bytes()...))
-	return common.BytesToHash(data)
+	root, _ := GetChtRootVersion(db, sectionIdx, sectionHead)
+	return root
+}
+
+// ErrSectionNotIndexed is returned by GetChtRootOrError for sections beyond the
+// last indexed one, whose CHT root may still be stored later.
+type ErrSectionNotIndexed struct {
+	Section           uint64
+	MaxIndexedSection uint64
+}
+
+func (e *ErrSectionNotIndexed) Error() string {
+	return fmt.Sprintf("CHT section %d not indexed yet (last indexed section %d)", e.Section, e.MaxIndexedSection)
+}
+
+// GetChtRootOrError reads the CHT root of the given section like GetChtRoot, but
+// distinguishes sections not indexed yet, reported as *ErrSectionNotIndexed, from
+// indexed sections without a root for the given head, reported as ErrNoTrustedCht.
+func GetChtRootOrError(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash, maxIndexedSection uint64) (common.Hash, error) {
+	if sectionIdx > maxIndexedSection {
+		return common.Hash{}, &ErrSectionNotIndexed{Section: sectionIdx, MaxIndexedSection: maxIndexedSection}
+	}
+	root := GetChtRoot(db, sectionIdx, sectionHead)
+	if root == (common.Hash{}) {
+		return common.Hash{}, ErrNoTrustedCht
+	}
+	return root, nil
+}
+
+// GetChtRootVersion reads the CHT root assoctiated to the given section from the
+// database along with the version of the entry format of the trie. Roots stored
+// before versioning are reported with version 0.
+// Note that sectionIdx is specified according to LES/1 CHT section size
+func GetChtRootVersion(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) (common.Hash, byte) {
+	data, _ := db.Get(DefaultChtKeyEncoder.Encode(sectionIdx, sectionHead))
+	if len(data) == common.HashLength+1 {
+		return common.BytesToHash(data[1:]), data[0]
+	}
+	return common.BytesToHash(data), 0
 }
 
 // GetChtV2Root reads the CHT root assoctiated to the given section from the database
@@ -112,9 +271,240 @@ func GetChtV2Root(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash)
 // StoreChtRoot writes the CHT root assoctiated to the given section into the database
 // Note that sectionIdx is specified according to LES/1 CHT section size
 func StoreChtRoot(db ethdb.Database, sectionIdx uint64, sectionHead, root common.Hash) {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], sectionIdx)
-	db.Put(append(append(chtPrefix, encNumber[:]...), sectionHead.Bytes()...), root.Bytes())
+	db.Put(DefaultChtKeyEncoder.Encode(sectionIdx, sectionHead), append([]byte{ChtVersion}, root.Bytes()...))
+}
+
+// DeleteChtSection removes the stored CHT root of the given section along with the
+// trie nodes not shared with the previous section. The section size and the head
+// of the previous section are derived from the section head, which has to be
+// available in the local chain. Only the latest stored section can be removed,
+// as later sections share its nodes. The reverse index and the progress of the
+// CHT indexer are left untouched.
+func DeleteChtSection(db ethdb.Database, section uint64, sectionHead common.Hash) error {
+	root := GetChtRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return ErrNoTrustedCht
+	}
+	if later, err := laterSectionStored(db, DefaultChtKeyEncoder, section); err != nil {
+		return err
+	} else if later {
+		return errChtNotLatest
+	}
+	var prevRoot common.Hash
+	if section > 0 {
+		headNum := rawdb.ReadHeaderNumber(db, sectionHead)
+		if headNum == nil {
+			return ErrNoHeader
+		}
+		sectionSize := (*headNum + 1) / (section + 1)
+		prevHead := rawdb.ReadCanonicalHash(db, section*sectionSize-1)
+		if prevRoot = GetChtRoot(db, section-1, prevHead); prevRoot == (common.Hash{}) {
+			return fmt.Errorf("no CHT root stored for previous section %d", section-1)
+		}
+	}
+	stale, err := deleteSectionNodes(db, ChtTablePrefix, prevRoot, root)
+	if err != nil {
+		return err
+	}
+	if err := db.Delete(DefaultChtKeyEncoder.Encode(section, sectionHead)); err != nil {
+		return err
+	}
+	if err := db.Delete(sectionIndexKey(chtSizePrefix, section)); err != nil {
+		return err
+	}
+	log.Info("Removed CHT section", "section", section, "head", sectionHead, "nodes", stale)
+	return nil
+}
+
+// deleteSectionNodes deletes the nodes of the helper trie with the given root that
+// are not part of the trie of the previous section from the table with the given
+// prefix, and returns the number of deleted nodes.
+func deleteSectionNodes(db ethdb.Database, prefix string, prevRoot, root common.Hash) (int, error) {
+	triedb := trie.NewDatabase(ethdb.NewTable(db, prefix))
+	prevTrie, err := trie.New(prevRoot, triedb)
+	if err != nil {
+		return 0, err
+	}
+	curTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return 0, err
+	}
+	// Collect all nodes first, the iterator resolves them from the database lazily
+	var stale []common.Hash
+	it, _ := trie.NewDifferenceIterator(prevTrie.NodeIterator(nil), curTrie.NodeIterator(nil))
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			stale = append(stale, hash)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	table := ethdb.NewTable(db, prefix)
+	for _, hash := range stale {
+		if err := table.Delete(hash[:]); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
+
+// ChtSectionCount returns the number of distinct sections with a CHT root stored
+// in the database.
+func ChtSectionCount(db ethdb.Database) (uint64, error) {
+	return countSections(db, chtPrefix, DefaultChtKeyEncoder)
+}
+
+// countSections returns the number of distinct section indexes among the keys
+// with the given prefix, decoded with enc.
+func countSections(db ethdb.Database, prefix []byte, enc KeyEncoder) (uint64, error) {
+	sections, err := listSections(db, prefix, enc)
+	return uint64(len(sections)), err
+}
+
+// listSections returns the distinct section indexes among the keys with the
+// given prefix, decoded with enc, in ascending order.
+func listSections(db ethdb.Database, prefix []byte, enc KeyEncoder) ([]uint64, error) {
+	seen := make(map[uint64]struct{})
+	err := iterateWithPrefix(db, prefix, func(key, value []byte) error {
+		section, _, err := enc.Decode(key)
+		if err != nil {
+			return fmt.Errorf("invalid section key %x: %v", key, err)
+		}
+		seen[section] = struct{}{}
+		return nil
+	})
+	sections := make([]uint64, 0, len(seen))
+	for section := range seen {
+		sections = append(sections, section)
+	}
+	sort.Slice(sections, func(i, j int) bool { return sections[i] < sections[j] })
+	return sections, err
+}
+
+// SectionSizeConsistencyCheck infers the section size the stored CHT roots were
+// created with from the earliest stored root and its section head, and reports
+// whether it matches sectionSize. If no CHT roots are stored, sectionSize is
+// considered consistent.
+func SectionSizeConsistencyCheck(db ethdb.Database, sectionSize uint64) (storedSectionSize uint64, consistent bool, err error) {
+	key, err := firstKeyWithPrefix(db, chtPrefix)
+	if err != nil {
+		return 0, false, err
+	}
+	if key == nil {
+		return sectionSize, true, nil
+	}
+	sectionIdx, sectionHead, err := DefaultChtKeyEncoder.Decode(key)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid CHT root key %x: %v", key, err)
+	}
+	headNum := rawdb.ReadHeaderNumber(db, sectionHead)
+	if headNum == nil {
+		return 0, false, ErrNoHeader
+	}
+	if (*headNum+1)%(sectionIdx+1) != 0 {
+		return 0, false, fmt.Errorf("CHT section %d head #%d is not on a section boundary", sectionIdx, *headNum)
+	}
+	storedSectionSize = (*headNum + 1) / (sectionIdx + 1)
+	return storedSectionSize, storedSectionSize == sectionSize, nil
+}
+
+// firstKeyWithPrefix returns the lexicographically smallest key in the database
+// starting with the given prefix, or nil if there is none.
+func firstKeyWithPrefix(db ethdb.Database, prefix []byte) ([]byte, error) {
+	switch db := db.(type) {
+	case *ethdb.LDBDatabase:
+		it := db.NewIteratorWithPrefix(prefix)
+		defer it.Release()
+		if it.Next() {
+			return common.CopyBytes(it.Key()), nil
+		}
+		return nil, it.Error()
+	case *ethdb.MemDatabase:
+		var first []byte
+		for _, key := range db.Keys() {
+			if bytes.HasPrefix(key, prefix) && (first == nil || bytes.Compare(key, first) < 0) {
+				first = key
+			}
+		}
+		return first, nil
+	default:
+		return nil, fmt.Errorf("database type %T does not support iteration", db)
+	}
+}
+
+// iterateWithPrefix calls fn for every key starting with the given prefix and its
+// value, in no particular order, until fn returns an error.
+func iterateWithPrefix(db ethdb.Database, prefix []byte, fn func(key, value []byte) error) error {
+	switch db := db.(type) {
+	case *ethdb.LDBDatabase:
+		it := db.NewIteratorWithPrefix(prefix)
+		defer it.Release()
+		for it.Next() {
+			if err := fn(it.Key(), it.Value()); err != nil {
+				return err
+			}
+		}
+		return it.Error()
+	case *ethdb.MemDatabase:
+		for _, key := range db.Keys() {
+			if !bytes.HasPrefix(key, prefix) {
+				continue
+			}
+			value, err := db.Get(key)
+			if err != nil {
+				return err
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("database type %T does not support iteration", db)
+	}
+}
+
+// getChtReverseRoot reads the reverse index trie root associated to the given section.
+func getChtReverseRoot(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) common.Hash {
+	data, _ := db.Get(chtReverseKeyEncoder.Encode(sectionIdx, sectionHead))
+	return common.BytesToHash(data)
+}
+
+// storeChtReverseRoot writes the reverse index trie root associated to the given
+// section and marks it as the most recent one.
+func storeChtReverseRoot(db ethdb.Database, sectionIdx uint64, sectionHead, root common.Hash) {
+	db.Put(chtReverseKeyEncoder.Encode(sectionIdx, sectionHead), root.Bytes())
+	db.Put(chtReverseHeadKey, root.Bytes())
+}
+
+// GetBlockNumberByChtHash looks up the number of the block with the given hash
+// in the most recently committed CHT reverse index.
+func GetBlockNumberByChtHash(db ethdb.Database, hash common.Hash) (uint64, error) {
+	data, _ := db.Get(chtReverseHeadKey)
+	if len(data) != common.HashLength {
+		return 0, ErrNotInReverseIndex
+	}
+	t, err := trie.New(common.BytesToHash(data), trie.NewDatabase(ethdb.NewTable(db, ChtReverseTablePrefix)))
+	if err != nil {
+		return 0, err
+	}
+	enc, err := t.TryGet(hash[:])
+	if err != nil {
+		return 0, err
+	}
+	if len(enc) != 8 {
+		return 0, ErrNotInReverseIndex
+	}
+	return binary.BigEndian.Uint64(enc), nil
+}
+
+// ProcessMetrics contains the counters of the CHT indexer backend, accumulated
+// over all processed sections.
+type ProcessMetrics struct {
+	BlocksProcessed uint64 // Number of blocks added to a CHT
+	NilTdCount      uint64 // Number of blocks skipped for lack of a total difficulty
+	EncodingErrors  uint64 // Number of blocks skipped for failing to encode their CHT entry
 }
 
 // ChtIndexerBackend implements core.ChainIndexerBackend
@@ -124,25 +514,163 @@ type ChtIndexerBackend struct {
 	section, sectionSize uint64
 	lastHash             common.Hash
 	trie                 *trie.Trie
+	processed            uint64         // number of blocks processed since the last Reset, accessed atomically
+	skipped              uint64         // number of blocks skipped since the last Reset, accessed atomically
+	lastErr              error          // error of the last block skipped since the last Reset
+	metrics              ProcessMetrics // processing counters, accessed atomically
+	verifySamples        int            // number of entries to spot-check against the chain after each commit (debug)
+	flushLimit           int            // number of dirty trie nodes triggering a partial flush (0 = never)
+	memoryLimit          uint64         // estimated size of unflushed entries triggering a partial flush (0 = never)
+	pendingSize          uint64         // estimated size of the entries added since the last Reset or FlushPartial
+	flushedSize          uint64         // size of the CHT nodes flushed by FlushPartial since the last Reset
+	bytesPerBlock        uint64         // CHT node bytes stored per block in the last committed section, accessed atomically
+
+	newTrie func(common.Hash, *trie.Database) (*trie.Trie, error) // trie constructor, replaceable in tests (nil = trie.New)
+
+	revTriedb *trie.Database // hash -> number reverse index trie database (nil if disabled)
+	revTrie   *trie.Trie
+
+	nodeCache *ChtNodeCache // Decoded entries served by LookupNode (nil if disabled)
+
+	events      *IndexerEventBus // Bus to post section commits on (nil if disabled)
+	rootHistory *ChtRootHistory  // History to record committed roots in (nil if disabled)
 }
 
-// NewBloomTrieIndexer creates a BloomTrie chain indexer
-func NewChtIndexer(db ethdb.Database, clientMode bool) *core.ChainIndexer {
-	var sectionSize, confirmReq uint64
-	if clientMode {
-		sectionSize = CHTFrequencyClient
-		confirmReq = HelperTrieConfirmations
-	} else {
-		sectionSize = CHTFrequencyServer
-		confirmReq = HelperTrieProcessConfirmations
+// ChtIndexerConfig contains the parameters of the CHT indexer.
+type ChtIndexerConfig struct {
+	SectionSize   uint64        // Number of blocks in a CHT section
+	Confirmations uint64        // Number of confirmations needed before a section is processed
+	Throttling    time.Duration // Disk throttling to prevent a heavy upgrade from hogging resources
+	VerifySamples int           // Number of entries to spot-check against the chain after each commit (debug, 0 = off)
+	FlushLimit    int           // Number of dirty trie nodes triggering a partial flush (0 = never), see FlushPartial
+	MemoryLimit   uint64        // Estimated bytes of unflushed entries triggering a partial flush (0 = never)
+	ReverseIndex  bool          // Whether to maintain a hash -> number reverse index, see GetBlockNumberByChtHash
+	RootHistory   int           // Number of recently committed roots recorded per section (0 = off)
+	NodeCacheSize int           // Number of decoded CHT entries cached for LookupNode (0 = off)
+
+	Events *IndexerEventBus // Bus to post section commits on (nil = none)
+
+	// AuditSink, if set, receives every CHT trie node written to the database,
+	// before the write, as an append-only log (see ReplayChtAuditLog).
+	AuditSink io.Writer
+}
+
+// DefaultChtIndexerConfig contains the CHT indexer settings of light clients.
+var DefaultChtIndexerConfig = ChtIndexerConfig{
+	SectionSize:   CHTFrequencyClient,
+	Confirmations: HelperTrieConfirmations,
+	Throttling:    100 * time.Millisecond,
+}
+
+// DefaultServerChtIndexerConfig contains the CHT indexer settings of light servers.
+var DefaultServerChtIndexerConfig = ChtIndexerConfig{
+	SectionSize:   CHTFrequencyServer,
+	Confirmations: HelperTrieProcessConfirmations,
+	Throttling:    100 * time.Millisecond,
+}
+
+// HeaderChainReader is the subset of chain methods needed to check helper trie
+// contents against the local canonical chain.
+type HeaderChainReader interface {
+	// GetHeaderByNumber retrieves the canonical header with the given number.
+	GetHeaderByNumber(number uint64) *types.Header
+}
+
+// Both full and light header chains can be used to verify CHT contents.
+var (
+	_ HeaderChainReader = (*core.HeaderChain)(nil)
+	_ HeaderChainReader = (*LightChain)(nil)
+)
+
+// dbHeaderReader implements HeaderChainReader directly on top of a chain database.
+type dbHeaderReader struct {
+	db ethdb.Database
+}
+
+// GetHeaderByNumber implements HeaderChainReader.
+func (r dbHeaderReader) GetHeaderByNumber(number uint64) *types.Header {
+	hash := rawdb.ReadCanonicalHash(r.db, number)
+	if hash == (common.Hash{}) {
+		return nil
+	}
+	return rawdb.ReadHeader(r.db, hash, number)
+}
+
+// NewChtIndexer creates a CHT chain indexer with the given configuration. A nil
+// config means DefaultChtIndexerConfig.
+func NewChtIndexer(db ethdb.Database, config *ChtIndexerConfig) *core.ChainIndexer {
+	if config == nil {
+		config = &DefaultChtIndexerConfig
+	}
+	idb := ethdb.NewTable(db, chtIndexTablePrefix)
+	backend := newChtIndexerBackend(db, config)
+	return core.NewChainIndexer(db, idb, backend, config.SectionSize, config.Confirmations, config.Throttling, "cht")
+}
+
+// newChtIndexerBackend creates a CHT indexer backend with the given configuration.
+func newChtIndexerBackend(db ethdb.Database, config *ChtIndexerConfig) *ChtIndexerBackend {
+	table := ethdb.NewTable(db, ChtTablePrefix)
+	if config.AuditSink != nil {
+		table = &auditDatabase{Database: table, sink: config.AuditSink}
 	}
-	idb := ethdb.NewTable(db, "chtIndex-")
 	backend := &ChtIndexerBackend{
-		diskdb:      db,
-		triedb:      trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)),
-		sectionSize: sectionSize,
+		diskdb:        db,
+		triedb:        trie.NewDatabase(table),
+		sectionSize:   config.SectionSize,
+		verifySamples: config.VerifySamples,
+		flushLimit:    config.FlushLimit,
+		memoryLimit:   config.MemoryLimit,
+		events:        config.Events,
 	}
-	return core.NewChainIndexer(db, idb, backend, sectionSize, confirmReq, time.Millisecond*100, "cht")
+	if config.RootHistory > 0 {
+		backend.rootHistory = NewChtRootHistory(db, config.RootHistory)
+	}
+	if config.ReverseIndex {
+		backend.revTriedb = trie.NewDatabase(ethdb.NewTable(db, ChtReverseTablePrefix))
+	}
+	if config.NodeCacheSize > 0 {
+		backend.nodeCache = NewChtNodeCache(config.NodeCacheSize)
+	}
+	return backend
+}
+
+// RebuildChtSection rebuilds and recommits the CHT of a section from the canonical
+// headers in the database, rewriting all its trie nodes. It can be used to repair
+// a corrupted section while the node is running, as it uses a separate backend
+// from the running indexer; the commit is posted to the event bus of the config.
+// The section is built on top of the stored CHT of the previous section.
+func RebuildChtSection(db ethdb.Database, config *ChtIndexerConfig, section uint64) error {
+	if config == nil {
+		config = &DefaultChtIndexerConfig
+	}
+	var lastHead common.Hash
+	if section > 0 {
+		if lastHead = rawdb.ReadCanonicalHash(db, ChtSectionHeadBlock(section-1, config.SectionSize)); lastHead == (common.Hash{}) {
+			return ErrNoHeader
+		}
+	}
+	backend := newChtIndexerBackend(db, config)
+	if err := backend.Reset(section, lastHead); err != nil {
+		return err
+	}
+	chain := dbHeaderReader{db}
+	for num := ChtSectionStartBlock(section, config.SectionSize); num <= ChtSectionHeadBlock(section, config.SectionSize); num++ {
+		header := chain.GetHeaderByNumber(num)
+		if header == nil {
+			return ErrNoHeader
+		}
+		if header.ParentHash != lastHead {
+			return fmt.Errorf("chain reorged during CHT section %d rebuild", section)
+		}
+		backend.Process(header)
+		lastHead = header.Hash()
+	}
+	return backend.Commit()
+}
+
+// Name implements core.ChainIndexerBackendNamer
+func (c *ChtIndexerBackend) Name() string {
+	return "cht"
 }
 
 // Reset implements core.ChainIndexerBackend
@@ -152,65 +680,480 @@ func (c *ChtIndexerBackend) Reset(section uint64, lastSectionHead common.Hash) e
 		root = GetChtRoot(c.diskdb, section-1, lastSectionHead)
 	}
 	var err error
-	c.trie, err = trie.New(root, c.triedb)
-	c.section = section
+	c.trie, err = c.openTrie(root, c.triedb)
+	if err == nil && c.revTriedb != nil {
+		var revRoot common.Hash
+		if section > 0 {
+			revRoot = getChtReverseRoot(c.diskdb, section-1, lastSectionHead)
+		}
+		c.revTrie, err = c.openTrie(revRoot, c.revTriedb)
+	}
+	c.section, c.lastHash, c.pendingSize, c.flushedSize, c.lastErr = section, common.Hash{}, 0, 0, nil
+	atomic.StoreUint64(&c.processed, 0)
+	atomic.StoreUint64(&c.skipped, 0)
 	return err
 }
 
+// openTrie opens the trie with the given root, retrying with exponential backoff
+// to ride out trie nodes being temporarily unavailable.
+func (c *ChtIndexerBackend) openTrie(root common.Hash, db *trie.Database) (*trie.Trie, error) {
+	newTrie := c.newTrie
+	if newTrie == nil {
+		newTrie = trie.New
+	}
+	var err error
+	for i := 0; i < chtResetAttempts; i++ {
+		if i > 0 {
+			time.Sleep(chtResetBackoff << uint(i-1))
+		}
+		var t *trie.Trie
+		if t, err = newTrie(root, db); err == nil {
+			return t, nil
+		}
+		log.Warn("Failed to open CHT trie", "root", root, "attempt", i+1, "err", err)
+	}
+	chtResetFailureCounter.Inc(1)
+	return nil, err
+}
+
 // Process implements core.ChainIndexerBackend
 func (c *ChtIndexerBackend) Process(header *types.Header) {
 	hash, num := header.Hash(), header.Number.Uint64()
 	c.lastHash = hash
 
+	// Without the tries of a successful Reset the block can't be added either
+	if c.trie == nil || (c.revTriedb != nil && c.revTrie == nil) {
+		atomic.AddUint64(&c.skipped, 1)
+		c.lastErr = ErrTrieNotInitialized
+		return
+	}
+	// Blocks that cannot be added are skipped, failing the Commit of the section
 	td := rawdb.ReadTd(c.diskdb, hash, num)
 	if td == nil {
-		panic(nil)
+		atomic.AddUint64(&c.metrics.NilTdCount, 1)
+		atomic.AddUint64(&c.skipped, 1)
+		chtNilTdCounter.Inc(1)
+		c.lastErr = fmt.Errorf("missing total difficulty of block %d [%x…]", num, hash[:4])
+		log.Error("Missing total difficulty for CHT entry", "number", num, "hash", hash)
+		return
+	}
+	encNumber := ComputeChtKey(num)
+	node := chtNodePool.Get()
+	node.Hash = hash
+	node.Td.Set(td)
+	data, err := rlp.EncodeToBytes(node)
+	chtNodePool.Put(node)
+	if err != nil {
+		atomic.AddUint64(&c.metrics.EncodingErrors, 1)
+		atomic.AddUint64(&c.skipped, 1)
+		chtEncodingErrorCounter.Inc(1)
+		c.lastErr = fmt.Errorf("failed to encode CHT entry of block %d: %v", num, err)
+		log.Error("Failed to encode CHT entry", "number", num, "hash", hash, "err", err)
+		return
+	}
+	// Flush the pending entries first if the new one would exceed the memory limit
+	size := uint64(len(encNumber) + len(data))
+	if c.revTrie != nil {
+		size += uint64(len(hash) + len(encNumber))
+	}
+	if c.memoryLimit > 0 && c.pendingSize > 0 && c.pendingSize+size > c.memoryLimit {
+		if err := c.FlushPartial(); err != nil {
+			log.Error("Failed to flush partial CHT section", "section", c.section, "err", err)
+		}
 	}
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], num)
-	data, _ := rlp.EncodeToBytes(ChtNode{hash, td})
+	atomic.AddUint64(&c.metrics.BlocksProcessed, 1)
+	chtProcessedCounter.Inc(1)
 	c.trie.Update(encNumber[:], data)
+	if c.revTrie != nil {
+		c.revTrie.Update(hash[:], encNumber[:])
+	}
+	c.pendingSize += size
+	processed := atomic.AddUint64(&c.processed, 1)
+
+	if c.flushLimit > 0 && processed%chtFlushCheckInterval == 0 && c.DirtyNodeCount() > c.flushLimit {
+		if err := c.FlushPartial(); err != nil {
+			log.Error("Failed to flush partial CHT section", "section", c.section, "err", err)
+		}
+	}
+}
+
+// Metrics returns a snapshot of the processing counters of the backend.
+func (c *ChtIndexerBackend) Metrics() ProcessMetrics {
+	return ProcessMetrics{
+		BlocksProcessed: atomic.LoadUint64(&c.metrics.BlocksProcessed),
+		NilTdCount:      atomic.LoadUint64(&c.metrics.NilTdCount),
+		EncodingErrors:  atomic.LoadUint64(&c.metrics.EncodingErrors),
+	}
+}
+
+// DirtyNodeCount returns the number of CHT trie nodes modified in memory since
+// the last Reset or FlushPartial, or zero if no section is being processed.
+func (c *ChtIndexerBackend) DirtyNodeCount() int {
+	if c.trie == nil {
+		return 0
+	}
+	return c.trie.DirtyNodeCount()
+}
+
+// Section returns the index of the section being processed, as set by the last Reset.
+func (c *ChtIndexerBackend) Section() uint64 {
+	return c.section
+}
+
+// SectionHead returns the hash of the last header processed since the last Reset,
+// which is the section head once the section is complete, or the zero hash if no
+// header was processed yet.
+func (c *ChtIndexerBackend) SectionHead() common.Hash {
+	return c.lastHash
+}
+
+// The chain indexer warns about the blocks the CHT backend skipped in a section.
+var _ core.ChainIndexerErrorReporter = (*ChtIndexerBackend)(nil)
+
+// LastError returns the reason the last block skipped since the last Reset could
+// not be added to the CHT, or nil if no block was skipped.
+func (c *ChtIndexerBackend) LastError() error {
+	return c.lastErr
+}
+
+// NumErrors returns the number of blocks skipped since the last Reset for lack of
+// a total difficulty or failing to encode their CHT entry.
+func (c *ChtIndexerBackend) NumErrors() uint64 {
+	return atomic.LoadUint64(&c.skipped)
+}
+
+// ProcessedBlocks returns the number of blocks processed since the last Reset.
+func (c *ChtIndexerBackend) ProcessedBlocks() uint64 {
+	return atomic.LoadUint64(&c.processed)
+}
+
+// CurrentSectionProgress returns the fraction of the blocks of the current section
+// processed since the last Reset.
+func (c *ChtIndexerBackend) CurrentSectionProgress() float64 {
+	if c.sectionSize == 0 {
+		return 0
+	}
+	return float64(c.ProcessedBlocks()) / float64(c.sectionSize)
+}
+
+// ProcessedRange returns the first and last block number processed since the last
+// Reset. If no blocks were processed yet, ok is false and the range is undefined.
+func (c *ChtIndexerBackend) ProcessedRange() (start, end uint64, ok bool) {
+	processed := c.ProcessedBlocks()
+	if processed == 0 {
+		return 0, 0, false
+	}
+	start = ChtSectionStartBlock(c.section, c.sectionSize)
+	return start, start + processed - 1, true
 }
 
 // Commit implements core.ChainIndexerBackend
 func (c *ChtIndexerBackend) Commit() error {
+	if skipped := c.NumErrors(); skipped > 0 {
+		log.Warn("Skipped blocks in CHT section", "section", c.section, "skipped", skipped)
+	}
+	if processed := c.ProcessedBlocks(); processed != c.sectionSize {
+		return fmt.Errorf("incomplete CHT section %d: processed %d of %d blocks", c.section, processed, c.sectionSize)
+	}
+	dirty := c.trie.DirtyNodeCount()
 	root, err := c.trie.Commit(nil)
 	if err != nil {
 		return err
 	}
+	size := c.flushedSize + dirtyNodesSize(c.triedb)
+	atomic.StoreUint64(&c.bytesPerBlock, size/c.sectionSize)
 	c.triedb.Commit(root, false)
+	if err := StoreChtSectionSize(c.diskdb, c.section, size); err != nil {
+		log.Warn("Failed to store CHT section size", "section", c.section, "err", err)
+	}
 
 	if ((c.section+1)*c.sectionSize)%CHTFrequencyClient == 0 {
 		log.Info("Storing CHT", "section", c.section*c.sectionSize/CHTFrequencyClient, "head", c.lastHash, "root", root)
 	}
 	StoreChtRoot(c.diskdb, c.section, c.lastHash, root)
+	if c.rootHistory != nil {
+		if err := c.rootHistory.Record(c.section, c.lastHash, root); err != nil {
+			log.Warn("Failed to record CHT root history", "section", c.section, "err", err)
+		}
+	}
+
+	if c.revTrie != nil {
+		revRoot, err := c.revTrie.Commit(nil)
+		if err != nil {
+			return err
+		}
+		if err := c.revTriedb.Commit(revRoot, false); err != nil {
+			return err
+		}
+		storeChtReverseRoot(c.diskdb, c.section, c.lastHash, revRoot)
+	}
+	if c.verifySamples > 0 {
+		mismatches, err := c.VerifyAgainstChain(dbHeaderReader{c.diskdb}, c.section, c.lastHash, c.verifySamples)
+		if err != nil {
+			log.Warn("Failed to verify CHT section", "section", c.section, "err", err)
+		} else if mismatches > 0 {
+			log.Error("CHT section does not match local chain", "section", c.section, "samples", c.verifySamples, "mismatches", mismatches)
+		}
+	}
+	if dirty > chtShrinkThreshold {
+		if err := c.ShrinkTrie(); err != nil {
+			log.Warn("Failed to shrink CHT trie", "section", c.section, "err", err)
+		}
+	}
+	c.events.post(IndexerEvent{Indexer: c.Name(), Section: c.section, Head: c.lastHash, Root: root})
+	return nil
+}
+
+// CommitWithTimeout runs Commit, giving up once ctx is cancelled or expires. The
+// database does not support aborting writes, so a commit given up on keeps running
+// in the background and the backend must not be used until a new Reset.
+func (c *ChtIndexerBackend) CommitWithTimeout(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- c.Commit()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrieRoot returns the root hash of the CHT of the section being processed,
+// including all blocks processed so far, without writing anything to the database.
+func (c *ChtIndexerBackend) TrieRoot() (common.Hash, error) {
+	if c.trie == nil {
+		return common.Hash{}, errChtNoSection
+	}
+	return c.trie.Hash(), nil
+}
+
+// IsFullyProcessed reports whether a CHT root is stored for the given section,
+// belonging to the section head found in the local canonical chain.
+func (c *ChtIndexerBackend) IsFullyProcessed(section uint64) bool {
+	head := rawdb.ReadCanonicalHash(c.diskdb, ChtSectionHeadBlock(section, c.sectionSize))
+	if head == (common.Hash{}) {
+		return false
+	}
+	return GetChtRoot(c.diskdb, section, head) != (common.Hash{})
+}
+
+// FlushPartial writes the trie nodes accumulated so far into the database without
+// storing a CHT root, and reopens the tries from the flushed state to release the
+// memory held by the in-memory nodes. The reverse index trie is flushed too if
+// enabled. The section can still be finalized by a later Commit.
+func (c *ChtIndexerBackend) FlushPartial() error {
+	if c.trie == nil {
+		return errChtNoSection
+	}
+	var (
+		size uint64
+		err  error
+	)
+	if c.trie, size, err = flushTrie(c.trie, c.triedb); err != nil {
+		return err
+	}
+	c.flushedSize += size
+	if c.revTrie != nil {
+		if c.revTrie, _, err = flushTrie(c.revTrie, c.revTriedb); err != nil {
+			return err
+		}
+	}
+	c.pendingSize = 0
 	return nil
 }
 
+// ShrinkTrie replaces the in-memory tries with fresh instances opened at their
+// committed roots, releasing the nodes cached by the old instances. Unlike Reset
+// it leaves the section and its counters untouched. It fails if the tries hold
+// changes not committed yet.
+func (c *ChtIndexerBackend) ShrinkTrie() error {
+	if c.trie == nil {
+		return errChtNoSection
+	}
+	if c.trie.DirtyNodeCount() > 0 || (c.revTrie != nil && c.revTrie.DirtyNodeCount() > 0) {
+		return errTrieDirty
+	}
+	t, err := trie.New(c.trie.Hash(), c.triedb)
+	if err != nil {
+		return err
+	}
+	if c.revTrie != nil {
+		rev, err := trie.New(c.revTrie.Hash(), c.revTriedb)
+		if err != nil {
+			return err
+		}
+		c.revTrie = rev
+	}
+	c.trie = t
+	return nil
+}
+
+// flushTrie commits t into the database and reopens it at the committed root. It
+// also returns the size of the flushed nodes.
+func flushTrie(t *trie.Trie, triedb *trie.Database) (*trie.Trie, uint64, error) {
+	root, err := t.Commit(nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	size := dirtyNodesSize(triedb)
+	if err := triedb.Commit(root, false); err != nil {
+		return nil, 0, err
+	}
+	t, err = trie.New(root, triedb)
+	return t, size, err
+}
+
+// dirtyNodesSize returns the total size of the nodes cached in triedb that have
+// not been written to disk yet. It walks every cached node, so it is only called
+// right before the cache is flushed anyway.
+func dirtyNodesSize(triedb *trie.Database) uint64 {
+	var size uint64
+	for _, hash := range triedb.Nodes() {
+		if blob, err := triedb.Node(hash); err == nil {
+			size += uint64(len(blob))
+		}
+	}
+	return size
+}
+
+// SectionSizeBytes returns an estimate of the database space taken by the CHT
+// nodes of a section. The estimate is based on the nodes stored for the last
+// committed section, or on an empirical default before the first commit. It is
+// approximate: the size of a section depends on the shape of the CHT and on the
+// database overhead.
+func (c *ChtIndexerBackend) SectionSizeBytes() uint64 {
+	perBlock := atomic.LoadUint64(&c.bytesPerBlock)
+	if perBlock == 0 {
+		perBlock = chtBytesPerBlock
+	}
+	return c.sectionSize * perBlock
+}
+
+// VerifyAgainstChain reads sampleCount randomly chosen entries of a committed CHT
+// section and checks them against the canonical headers of the given chain. It
+// returns the number of entries not matching the chain.
+func (c *ChtIndexerBackend) VerifyAgainstChain(chain HeaderChainReader, section uint64, sectionHead common.Hash, sampleCount int) (mismatches int, err error) {
+	root, version := GetChtRootVersion(c.diskdb, section, sectionHead)
+	if root == (common.Hash{}) {
+		return 0, fmt.Errorf("no CHT root stored for section %d", section)
+	}
+	t, err := trie.New(root, c.triedb)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < sampleCount; i++ {
+		num := section*c.sectionSize + uint64(rand.Int63n(int64(c.sectionSize)))
+
+		encNumber := ComputeChtKey(num)
+		data, err := t.TryGet(encNumber[:])
+		if err != nil {
+			return mismatches, err
+		}
+		node, err := DecodeChtNode(version, data)
+		if err != nil {
+			return mismatches, fmt.Errorf("invalid CHT entry for block %d: %v", num, err)
+		}
+		if header := chain.GetHeaderByNumber(num); header == nil || header.Hash() != node.Hash {
+			mismatches++
+		}
+	}
+	return mismatches, nil
+}
+
+// LookupNode reads the CHT entry of the given block from the committed CHT
+// section stored with the given section head. Decoded entries are served from
+// and added to the node cache if enabled, so repeated lookups of the same block
+// neither open the trie nor decode the entry again.
+func (c *ChtIndexerBackend) LookupNode(section uint64, sectionHead common.Hash, blockNum uint64) (ChtNode, error) {
+	if node, ok := c.nodeCache.Get(section, blockNum, sectionHead); ok {
+		return node, nil
+	}
+	root, version := GetChtRootVersion(c.diskdb, section, sectionHead)
+	if root == (common.Hash{}) {
+		return ChtNode{}, ErrNoTrustedCht
+	}
+	t, err := trie.New(root, c.triedb)
+	if err != nil {
+		return ChtNode{}, err
+	}
+	node, err := readChtEntry(t, version, blockNum)
+	if err != nil {
+		return ChtNode{}, err
+	}
+	c.nodeCache.Add(section, blockNum, sectionHead, node)
+	return node, nil
+}
+
 const (
 	BloomTrieFrequency        = 32768
 	ethBloomBitsSection       = 4096
 	ethBloomBitsConfirmations = 256
+
+	bloomTrieUsageWindow = 10 // number of recent commits ProjectedDiskUsage averages over
 )
 
+// Compile time check that BloomTrieFrequency is a positive multiple of
+// ethBloomBitsSection, making the bloom trie ratio a positive integer.
 var (
-	bloomTriePrefix      = []byte("bltRoot-") // bloomTriePrefix + bloomTrieNum (uint64 big endian) -> trie root hash
-	BloomTrieTablePrefix = "blt-"
+	_ = [1]struct{}{}[BloomTrieFrequency%ethBloomBitsSection]
+	_ = uint(BloomTrieFrequency/ethBloomBitsSection - 1)
 )
 
+// BloomTrieSectionFromBlock returns the index of the BloomTrie section containing
+// the given block.
+func BloomTrieSectionFromBlock(blockNum uint64) uint64 {
+	return blockNum / BloomTrieFrequency
+}
+
+// BloomTrieParentSectionFromBlock returns the index of the bloom bits section of
+// the given size, the parent section of a BloomTrie, containing the given block.
+func BloomTrieParentSectionFromBlock(blockNum, parentSectionSize uint64) uint64 {
+	return blockNum / parentSectionSize
+}
+
 // GetBloomTrieRoot reads the BloomTrie root assoctiated to the given section from the database
 func GetBloomTrieRoot(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) common.Hash {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], sectionIdx)
-	data, _ := db.Get(append(append(bloomTriePrefix, encNumber[:]...), sectionHead.Bytes()...))
+	data, _ := db.Get(bloomTrieKeyEncoder.Encode(sectionIdx, sectionHead))
 	return common.BytesToHash(data)
 }
 
+// ComputeHelperTrieKey returns the BloomTrie key of the bloom bit vector of the
+// given bit index and section: the bit index as a big endian uint16 followed by
+// the section index as a big endian uint64.
+func ComputeHelperTrieKey(bit uint, section uint64) [10]byte {
+	var key [10]byte
+	binary.BigEndian.PutUint16(key[0:2], uint16(bit))
+	binary.BigEndian.PutUint64(key[2:10], section)
+	return key
+}
+
+// BloomTrieLookup reads the bloom bit vector of the given bit index belonging to
+// the given BloomTrie section from the locally stored BloomTrie and returns it in
+// decompressed form.
+func BloomTrieLookup(db ethdb.Database, bit uint, sectionIdx uint64, sectionHead common.Hash) ([]byte, error) {
+	comp, err := localBloomBits(db, bit, sectionIdx, sectionHead)
+	if err != nil {
+		return nil, err
+	}
+	return bitutil.DecompressBytes(comp, BloomTrieFrequency/8)
+}
+
 // StoreBloomTrieRoot writes the BloomTrie root assoctiated to the given section into the database
 func StoreBloomTrieRoot(db ethdb.Database, sectionIdx uint64, sectionHead, root common.Hash) {
-	var encNumber [8]byte
-	binary.BigEndian.PutUint64(encNumber[:], sectionIdx)
-	db.Put(append(append(bloomTriePrefix, encNumber[:]...), sectionHead.Bytes()...), root.Bytes())
+	db.Put(bloomTrieKeyEncoder.Encode(sectionIdx, sectionHead), root.Bytes())
+}
+
+// BloomTrieSectionCount returns the number of distinct sections with a BloomTrie
+// root stored in the database.
+func BloomTrieSectionCount(db ethdb.Database) (uint64, error) {
+	return countSections(db, bloomTriePrefix, bloomTrieKeyEncoder)
+}
+
+// deleteBloomTrieRoot removes the BloomTrie root assoctiated to the given section from the database
+func deleteBloomTrieRoot(db ethdb.Database, sectionIdx uint64, sectionHead common.Hash) error {
+	return db.Delete(bloomTrieKeyEncoder.Encode(sectionIdx, sectionHead))
 }
 
 // BloomTrieIndexerBackend implements core.ChainIndexerBackend
@@ -220,27 +1163,177 @@ type BloomTrieIndexerBackend struct {
 	section, parentSectionSize, bloomTrieRatio uint64
 	trie                                       *trie.Trie
 	sectionHeads                               []common.Hash
+
+	wal *writeAheadLog // Log of trie node batches written before the database (nil if disabled)
+
+	readCache *BloomTrieReadCache // Decompressed vectors served by LookupBloomBits (nil if disabled)
+
+	commitTimer      metrics.Timer        // Time spent committing a section (nil if not instrumented)
+	compressionGauge metrics.GaugeFloat64 // Compression ratio of the last committed section
+	nodeGauge        metrics.Gauge        // Number of trie nodes flushed in the last committed section
+	usageGauge       metrics.Gauge        // Projected disk usage of a section, see ProjectedDiskUsage
+
+	events      *IndexerEventBus      // Bus to post section commits on (nil if disabled)
+	rootHistory *BloomTrieRootHistory // History to record committed roots in (nil if disabled)
+
+	stats     SectionStats   // Statistics of the last committed section
+	history   []SectionStats // Statistics of all sections committed by this backend
+	statsLock sync.RWMutex
+}
+
+// SectionStats contains statistics about a committed BloomTrie section.
+type SectionStats struct {
+	Section           uint64        // Index of the committed section
+	Root              common.Hash   // BloomTrie root after the commit
+	CompressedBytes   uint64        // Total size of the compressed bloom bits
+	DecompressedBytes uint64        // Total size of the decompressed bloom bits
+	CommitDuration    time.Duration // Time it took to commit the section
+}
+
+// BloomTrieIndexerOption configures optional behaviour of the BloomTrie indexer backend.
+type BloomTrieIndexerOption func(*BloomTrieIndexerBackend)
+
+// withBloomTrieWAL records bloom trie node writes in the given write-ahead log.
+func withBloomTrieWAL(wal *writeAheadLog) BloomTrieIndexerOption {
+	return func(b *BloomTrieIndexerBackend) {
+		b.wal = wal
+	}
+}
+
+// WithBloomTrieMetrics instruments the backend with commit metrics registered
+// in reg. If reg is nil, the default metrics registry is used.
+func WithBloomTrieMetrics(reg metrics.Registry) BloomTrieIndexerOption {
+	return func(b *BloomTrieIndexerBackend) {
+		b.commitTimer = metrics.NewRegisteredTimer("light/bloomtrie/commit", reg)
+		b.compressionGauge = metrics.NewRegisteredGaugeFloat64("light/bloomtrie/compression", reg)
+		b.nodeGauge = metrics.NewRegisteredGauge("light/bloomtrie/nodes", reg)
+		b.usageGauge = metrics.NewRegisteredGauge("light/bloomtrie/projectedDiskUsage", reg)
+	}
+}
+
+// WithBloomTrieEvents posts the section commits of the backend on the given bus.
+func WithBloomTrieEvents(bus *IndexerEventBus) BloomTrieIndexerOption {
+	return func(b *BloomTrieIndexerBackend) {
+		b.events = bus
+	}
+}
+
+// WithBloomTrieRootHistory records the last limit committed roots of each section,
+// see GetBloomTrieRootHistory.
+func WithBloomTrieRootHistory(limit int) BloomTrieIndexerOption {
+	return func(b *BloomTrieIndexerBackend) {
+		b.rootHistory = NewBloomTrieRootHistory(b.diskdb, limit)
+	}
+}
+
+// WithBloomTrieReadCache caches up to size decompressed bloom bit vectors read
+// through LookupBloomBits.
+func WithBloomTrieReadCache(size int) BloomTrieIndexerOption {
+	return func(b *BloomTrieIndexerBackend) {
+		b.readCache = NewBloomTrieReadCache(size)
+	}
+}
+
+// NewBloomTrieIndexerWithMetrics creates a BloomTrie chain indexer reporting its
+// commit duration, compression ratio and node count into the given registry.
+func NewBloomTrieIndexerWithMetrics(db ethdb.Database, clientMode bool, reg metrics.Registry) *core.ChainIndexer {
+	return NewBloomTrieIndexer(db, clientMode, WithBloomTrieMetrics(reg))
 }
 
 // NewBloomTrieIndexer creates a BloomTrie chain indexer
-func NewBloomTrieIndexer(db ethdb.Database, clientMode bool) *core.ChainIndexer {
+func NewBloomTrieIndexer(db ethdb.Database, clientMode bool, opts ...BloomTrieIndexerOption) *core.ChainIndexer {
+	backend := newBloomTrieIndexerBackend(db, clientMode, opts...)
+	idb := ethdb.NewTable(db, bloomTrieIndexTablePrefix)
+
+	confirmReq := uint64(HelperTrieProcessConfirmations)
+	if clientMode {
+		confirmReq = HelperTrieConfirmations
+	}
+	return core.NewChainIndexer(db, idb, backend, BloomTrieFrequency, confirmReq-ethBloomBitsConfirmations, time.Millisecond*100, "bloomtrie")
+}
+
+// NewBloomTrieIndexerWithWAL creates a BloomTrie chain indexer recording its trie
+// node writes in a write-ahead log stored in the file at path. Any entries left
+// over from a previous run are replayed into the database first; the indexer is
+// not created if that fails.
+func NewBloomTrieIndexerWithWAL(db ethdb.Database, clientMode bool, path string, opts ...BloomTrieIndexerOption) (*core.ChainIndexer, error) {
+	wal := newWriteAheadLog(path)
+	n, err := wal.replay(ethdb.NewTable(db, BloomTrieTablePrefix))
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay bloom trie write-ahead log: %v", err)
+	}
+	if n > 0 {
+		log.Info("Replayed bloom trie write-ahead log", "entries", n)
+	}
+	return NewBloomTrieIndexer(db, clientMode, append(opts, withBloomTrieWAL(wal))...), nil
+}
+
+// newBloomTrieIndexerBackend creates a BloomTrie indexer backend.
+func newBloomTrieIndexerBackend(db ethdb.Database, clientMode bool, opts ...BloomTrieIndexerOption) *BloomTrieIndexerBackend {
 	backend := &BloomTrieIndexerBackend{
 		diskdb: db,
-		triedb: trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)),
 	}
-	idb := ethdb.NewTable(db, "bltIndex-")
+	for _, opt := range opts {
+		opt(backend)
+	}
+	table := ethdb.NewTable(db, BloomTrieTablePrefix)
+	if backend.wal != nil {
+		table = &walDatabase{Database: table, wal: backend.wal}
+	}
+	backend.triedb = trie.NewDatabase(table)
 
-	var confirmReq uint64
 	if clientMode {
 		backend.parentSectionSize = BloomTrieFrequency
-		confirmReq = HelperTrieConfirmations
 	} else {
 		backend.parentSectionSize = ethBloomBitsSection
-		confirmReq = HelperTrieProcessConfirmations
 	}
 	backend.bloomTrieRatio = BloomTrieFrequency / backend.parentSectionSize
 	backend.sectionHeads = make([]common.Hash, backend.bloomTrieRatio)
-	return core.NewChainIndexer(db, idb, backend, BloomTrieFrequency, confirmReq-ethBloomBitsConfirmations, time.Millisecond*100, "bloomtrie")
+	return backend
+}
+
+// RebuildBloomTrieSection rebuilds and recommits the BloomTrie of a section from
+// the bloom bits stored for the canonical parent section heads, rewriting all its
+// trie nodes. Like RebuildChtSection, it uses a separate backend from the running
+// indexer, configured by the given options, and builds on top of the stored
+// BloomTrie of the previous section.
+func RebuildBloomTrieSection(db ethdb.Database, clientMode bool, section uint64, opts ...BloomTrieIndexerOption) error {
+	var lastHead common.Hash
+	if section > 0 {
+		if lastHead = rawdb.ReadCanonicalHash(db, section*BloomTrieFrequency-1); lastHead == (common.Hash{}) {
+			return ErrNoHeader
+		}
+	}
+	backend := newBloomTrieIndexerBackend(db, clientMode, opts...)
+	if err := backend.Reset(section, lastHead); err != nil {
+		return err
+	}
+	chain := dbHeaderReader{db}
+	for j := uint64(0); j < backend.bloomTrieRatio; j++ {
+		header := chain.GetHeaderByNumber((section*backend.bloomTrieRatio+j+1)*backend.parentSectionSize - 1)
+		if header == nil {
+			return ErrNoHeader
+		}
+		backend.Process(header)
+	}
+	return backend.Commit()
+}
+
+// ParentSectionSize returns the size of the bloom bits sections the BloomTrie
+// entries are assembled from.
+func (b *BloomTrieIndexerBackend) ParentSectionSize() uint64 {
+	return b.parentSectionSize
+}
+
+// NumParentSections returns the number of bloom bits sections making up a single
+// BloomTrie section.
+func (b *BloomTrieIndexerBackend) NumParentSections() uint64 {
+	return b.bloomTrieRatio
+}
+
+// Name implements core.ChainIndexerBackendNamer
+func (b *BloomTrieIndexerBackend) Name() string {
+	return "bloomtrie"
 }
 
 // Reset implements core.ChainIndexerBackend
@@ -252,7 +1345,106 @@ func (b *BloomTrieIndexerBackend) Reset(section uint64, lastSectionHead common.H
 	var err error
 	b.trie, err = trie.New(root, b.triedb)
 	b.section = section
-	return err
+	for i := range b.sectionHeads {
+		b.sectionHeads[i] = common.Hash{}
+	}
+	if err != nil {
+		return err
+	}
+	return b.SanityCheck()
+}
+
+// SanityCheck verifies the consistency of the backend state needed to process
+// and commit a section.
+func (b *BloomTrieIndexerBackend) SanityCheck() error {
+	switch {
+	case b.trie == nil:
+		return errors.New("bloom trie not opened")
+	case b.parentSectionSize == 0 || BloomTrieFrequency%b.parentSectionSize != 0:
+		return fmt.Errorf("parent section size %d does not divide bloom trie section size %d", b.parentSectionSize, BloomTrieFrequency)
+	case b.bloomTrieRatio != BloomTrieFrequency/b.parentSectionSize:
+		return fmt.Errorf("bloom trie ratio %d does not match parent section size %d", b.bloomTrieRatio, b.parentSectionSize)
+	case uint64(len(b.sectionHeads)) != b.bloomTrieRatio:
+		return fmt.Errorf("section head count %d does not match bloom trie ratio %d", len(b.sectionHeads), b.bloomTrieRatio)
+	}
+	return nil
+}
+
+// ResetToSection removes the stored BloomTrie section, see DeleteBloomTrieSection,
+// then resets the backend so the section can be rebuilt. Section heads are looked
+// up in the local canonical chain.
+func (b *BloomTrieIndexerBackend) ResetToSection(section uint64) error {
+	head := rawdb.ReadCanonicalHash(b.diskdb, (section+1)*BloomTrieFrequency-1)
+	if err := DeleteBloomTrieSection(b.diskdb, section, head); err != nil {
+		return err
+	}
+	var prevHead common.Hash
+	if section > 0 {
+		prevHead = rawdb.ReadCanonicalHash(b.diskdb, section*BloomTrieFrequency-1)
+	}
+	return b.Reset(section, prevHead)
+}
+
+// DeleteBloomTrieSection removes the stored BloomTrie root of the given section
+// along with the trie nodes not shared with the previous section, whose head is
+// looked up in the local canonical chain. Only the latest stored section can be
+// removed, as later sections share its nodes.
+func DeleteBloomTrieSection(db ethdb.Database, section uint64, sectionHead common.Hash) error {
+	root := GetBloomTrieRoot(db, section, sectionHead)
+	if root == (common.Hash{}) {
+		return ErrNoTrustedBloomTrie
+	}
+	if later, err := laterSectionStored(db, bloomTrieKeyEncoder, section); err != nil {
+		return err
+	} else if later {
+		return errBloomTrieNotLatest
+	}
+	var prevRoot common.Hash
+	if section > 0 {
+		prevHead := rawdb.ReadCanonicalHash(db, section*BloomTrieFrequency-1)
+		if prevRoot = GetBloomTrieRoot(db, section-1, prevHead); prevRoot == (common.Hash{}) {
+			return fmt.Errorf("no bloom trie root stored for previous section %d", section-1)
+		}
+	}
+	stale, err := deleteSectionNodes(db, BloomTrieTablePrefix, prevRoot, root)
+	if err != nil {
+		return err
+	}
+	if err := deleteBloomTrieRoot(db, section, sectionHead); err != nil {
+		return err
+	}
+	if err := db.Delete(sectionIndexKey(bloomTrieSizePrefix, section)); err != nil {
+		return err
+	}
+	log.Info("Removed bloom trie section", "section", section, "head", sectionHead, "nodes", stale)
+	return nil
+}
+
+// StorageReport returns the number of trie node bytes written to the database for
+// each committed BloomTrie section, keyed by section index.
+func (b *BloomTrieIndexerBackend) StorageReport() map[uint64]uint64 {
+	return sectionSizes(b.diskdb, bloomTrieSizePrefix)
+}
+
+// CurrentSectionProgress returns the fraction of the bloom bits sections of the
+// current section whose heads were processed since the last Reset.
+func (b *BloomTrieIndexerBackend) CurrentSectionProgress() float64 {
+	if b.bloomTrieRatio == 0 {
+		return 0
+	}
+	return float64(b.NumParentSectionsProcessed()) / float64(b.bloomTrieRatio)
+}
+
+// NumParentSectionsProcessed returns the number of bloom bits sections of the
+// current section whose heads were processed since the last Reset.
+func (b *BloomTrieIndexerBackend) NumParentSectionsProcessed() uint64 {
+	var processed uint64
+	for _, head := range b.sectionHeads {
+		if head != (common.Hash{}) {
+			processed++
+		}
+	}
+	return processed
 }
 
 // Process implements core.ChainIndexerBackend
@@ -263,23 +1455,136 @@ func (b *BloomTrieIndexerBackend) Process(header *types.Header) {
 	}
 }
 
+// ProcessBatch processes a batch of consecutive headers of the current section,
+// recording the parent section heads among them.
+func (b *BloomTrieIndexerBackend) ProcessBatch(headers []*types.Header) error {
+	start := b.section * BloomTrieFrequency
+	for _, header := range headers {
+		number := header.Number.Uint64()
+		if number < start || number >= start+BloomTrieFrequency {
+			return fmt.Errorf("header #%d outside of bloom trie section %d", number, b.section)
+		}
+		if num := number - start; (num+1)%b.parentSectionSize == 0 {
+			b.sectionHeads[num/b.parentSectionSize] = header.Hash()
+		}
+	}
+	return nil
+}
+
 // Commit implements core.ChainIndexerBackend
 func (b *BloomTrieIndexerBackend) Commit() error {
-	var compSize, decompSize uint64
+	start := time.Now()
+	if b.commitTimer != nil {
+		defer b.commitTimer.UpdateSince(start)
+	}
+	if b.trie == nil {
+		return ErrTrieNotInitialized
+	}
+	if processed := b.NumParentSectionsProcessed(); processed < b.bloomTrieRatio {
+		log.Warn("Incomplete bloom trie section", "section", b.section, "heads", processed, "want", b.bloomTrieRatio)
+		return ErrIncompleteSectionHeads
+	}
+	compSize, decompSize, err := updateBloomTrie(b.diskdb, b.trie, b.section, b.parentSectionSize, b.bloomTrieRatio, b.sectionHeads)
+	if err != nil {
+		return err
+	}
+	root, err := b.trie.Commit(nil)
+	if err != nil {
+		return err
+	}
+	if b.nodeGauge != nil {
+		b.nodeGauge.Update(int64(len(b.triedb.Nodes())))
+		b.compressionGauge.Update(float64(compSize) / float64(decompSize))
+	}
+	size := dirtyNodesSize(b.triedb)
+	if err := b.triedb.Commit(root, false); err != nil {
+		return err
+	}
+	if err := StoreBloomTrieSectionSize(b.diskdb, b.section, size); err != nil {
+		log.Warn("Failed to store bloom trie section size", "section", b.section, "err", err)
+	}
+	sectionHead := b.sectionHeads[b.bloomTrieRatio-1]
+	log.Info("Storing bloom trie", "section", b.section, "head", sectionHead, "root", root, "compression", float64(compSize)/float64(decompSize))
+	StoreBloomTrieRoot(b.diskdb, b.section, sectionHead, root)
+	if b.rootHistory != nil {
+		if err := b.rootHistory.Record(b.section, sectionHead, root); err != nil {
+			log.Warn("Failed to record bloom trie root history", "section", b.section, "err", err)
+		}
+	}
+
+	b.statsLock.Lock()
+	b.stats = SectionStats{
+		Section:           b.section,
+		Root:              root,
+		CompressedBytes:   compSize,
+		DecompressedBytes: decompSize,
+		CommitDuration:    time.Since(start),
+	}
+	b.history = append(b.history, b.stats)
+	b.statsLock.Unlock()
+
+	if b.usageGauge != nil {
+		b.usageGauge.Update(int64(b.ProjectedDiskUsage()))
+	}
+	// Every section rewrites all bit entries, so the trie is always worth shrinking
+	if err := b.ShrinkTrie(); err != nil {
+		log.Warn("Failed to shrink bloom trie", "section", b.section, "err", err)
+	}
+
+	b.events.post(IndexerEvent{Indexer: b.Name(), Section: b.section, Head: sectionHead, Root: root})
+	return nil
+}
+
+// ShrinkTrie replaces the in-memory trie with a fresh instance opened at its
+// committed root, releasing the nodes cached by the old instance. It fails if
+// the trie holds changes not committed yet.
+func (b *BloomTrieIndexerBackend) ShrinkTrie() error {
+	if b.trie == nil {
+		return ErrTrieNotInitialized
+	}
+	if b.trie.DirtyNodeCount() > 0 {
+		return errTrieDirty
+	}
+	t, err := trie.New(b.trie.Hash(), b.triedb)
+	if err != nil {
+		return err
+	}
+	b.trie = t
+	return nil
+}
+
+// LookupBloomBits reads the decompressed bloom bit vector of the given bit index
+// from the committed BloomTrie section stored with the given section head, like
+// BloomTrieLookup. Vectors are served from and added to the read cache if
+// enabled, so repeated log filtering over the same sections does not decompress
+// them again.
+func (b *BloomTrieIndexerBackend) LookupBloomBits(bit uint, section uint64, sectionHead common.Hash) ([]byte, error) {
+	if data, ok := b.readCache.Get(bit, section, sectionHead); ok {
+		return data, nil
+	}
+	data, err := BloomTrieLookup(b.diskdb, bit, section, sectionHead)
+	if err != nil {
+		return nil, err
+	}
+	b.readCache.Add(bit, section, sectionHead, data)
+	return data, nil
+}
 
+// updateBloomTrie reads the bloom bits of all parent sections belonging to the
+// given BloomTrie section, merges them per bit index and writes the compressed
+// vectors into t. It returns the total compressed and decompressed data sizes.
+func updateBloomTrie(db ethdb.Database, t *trie.Trie, section, parentSectionSize, bloomTrieRatio uint64, sectionHeads []common.Hash) (compSize, decompSize uint64, err error) {
 	for i := uint(0); i < types.BloomBitLength; i++ {
-		var encKey [10]byte
-		binary.BigEndian.PutUint16(encKey[0:2], uint16(i))
-		binary.BigEndian.PutUint64(encKey[2:10], b.section)
+		encKey := ComputeHelperTrieKey(i, section)
 		var decomp []byte
-		for j := uint64(0); j < b.bloomTrieRatio; j++ {
-			data, err := rawdb.ReadBloomBits(b.diskdb, i, b.section*b.bloomTrieRatio+j, b.sectionHeads[j])
+		for j := uint64(0); j < bloomTrieRatio; j++ {
+			data, err := rawdb.ReadBloomBits(db, i, section*bloomTrieRatio+j, sectionHeads[j])
 			if err != nil {
-				return err
+				return 0, 0, err
 			}
-			decompData, err2 := bitutil.DecompressBytes(data, int(b.parentSectionSize/8))
-			if err2 != nil {
-				return err2
+			decompData, err := bitutil.DecompressBytes(data, int(parentSectionSize/8))
+			if err != nil {
+				return 0, 0, err
 			}
 			decomp = append(decomp, decompData...)
 		}
@@ -288,20 +1593,173 @@ func (b *BloomTrieIndexerBackend) Commit() error {
 		decompSize += uint64(len(decomp))
 		compSize += uint64(len(comp))
 		if len(comp) > 0 {
-			b.trie.Update(encKey[:], comp)
+			t.Update(encKey[:], comp)
 		} else {
-			b.trie.Delete(encKey[:])
+			t.Delete(encKey[:])
 		}
 	}
-	root, err := b.trie.Commit(nil)
+	return compSize, decompSize, nil
+}
+
+// ValidateBloomTrieRoot recomputes the BloomTrie root of a section from the raw
+// bloom bits stored in the database and compares it with the stored root. The
+// root of the previous section is looked up using the canonical hash of its
+// section head, so the canonical chain has to be available locally.
+func ValidateBloomTrieRoot(db ethdb.Database, section uint64, sectionHead common.Hash, parentSectionSize, bloomTrieRatio uint64, parentSectionHeads []common.Hash) error {
+	if uint64(len(parentSectionHeads)) != bloomTrieRatio {
+		return fmt.Errorf("parent section head count mismatch: have %d, want %d", len(parentSectionHeads), bloomTrieRatio)
+	}
+	stored, expected, err := replayBloomTrieSection(db, section, sectionHead, parentSectionSize, bloomTrieRatio, parentSectionHeads)
 	if err != nil {
 		return err
 	}
-	b.triedb.Commit(root, false)
+	if expected != stored {
+		return fmt.Errorf("bloom trie root mismatch for section %d: expected %x, stored %x", section, expected, stored)
+	}
+	return nil
+}
 
-	sectionHead := b.sectionHeads[b.bloomTrieRatio-1]
-	log.Info("Storing bloom trie", "section", b.section, "head", sectionHead, "root", root, "compression", float64(compSize)/float64(decompSize))
-	StoreBloomTrieRoot(b.diskdb, b.section, sectionHead, root)
+// BloomTrieContinuityError is returned by VerifyBloomTrieChain for the first
+// section that does not follow from the previous one. If the break is a changed
+// bloom bit vector, BitIdx is its bit and the previous section's vector is
+// returned as Expected, the one found in the broken section as Actual.
+type BloomTrieContinuityError struct {
+	Section  uint64
+	BitIdx   uint
+	Expected []byte
+	Actual   []byte
+	Reason   string
+}
 
+func (e *BloomTrieContinuityError) Error() string {
+	return fmt.Sprintf("bloom trie chain broken at section %d, bit %d: %s", e.Section, e.BitIdx, e.Reason)
+}
+
+// VerifyBloomTrieChain checks that the stored BloomTries of the consecutive
+// sections from startSection to endSection, with the given section heads, form a
+// single chain: as sections extend the trie of their predecessor, the trie of
+// each section has to contain the compressed bloom bits of the previous section
+// unchanged.
+func VerifyBloomTrieChain(db ethdb.Database, startSection, endSection uint64, sectionHeads []common.Hash) error {
+	if endSection < startSection || uint64(len(sectionHeads)) != endSection-startSection+1 {
+		return fmt.Errorf("%d section heads for sections %d-%d", len(sectionHeads), startSection, endSection)
+	}
+	triedb := trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix))
+
+	var prev *trie.Trie
+	for i, head := range sectionHeads {
+		section := startSection + uint64(i)
+
+		root := GetBloomTrieRoot(db, section, head)
+		if root == (common.Hash{}) {
+			return &BloomTrieContinuityError{Section: section, Reason: "no bloom trie root stored"}
+		}
+		t, err := trie.New(root, triedb)
+		if err != nil {
+			return &BloomTrieContinuityError{Section: section, Reason: err.Error()}
+		}
+		if prev != nil {
+			for bit := uint(0); bit < types.BloomBitLength; bit++ {
+				key := ComputeHelperTrieKey(bit, section-1)
+				expected, err := prev.TryGet(key[:])
+				if err != nil {
+					return &BloomTrieContinuityError{Section: section - 1, BitIdx: bit, Reason: err.Error()}
+				}
+				actual, err := t.TryGet(key[:])
+				if err != nil {
+					return &BloomTrieContinuityError{Section: section, BitIdx: bit, Reason: err.Error()}
+				}
+				if !bytes.Equal(expected, actual) {
+					return &BloomTrieContinuityError{Section: section, BitIdx: bit, Expected: expected, Actual: actual, Reason: "previous section bloom bits changed"}
+				}
+			}
+		}
+		prev = t
+	}
 	return nil
 }
+
+// ReplayBloomTrieSection rebuilds the BloomTrie of a committed section from the
+// bloom bits of its parent sections, identified by sectionHeads, and returns the
+// stored root along with the rebuilt one. The rebuilt trie is only kept in memory.
+func ReplayBloomTrieSection(db ethdb.Database, sectionIdx uint64, sectionHeads []common.Hash, parentSectionSize uint64) (storedRoot, replayedRoot common.Hash, err error) {
+	if parentSectionSize == 0 || BloomTrieFrequency%parentSectionSize != 0 {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("invalid parent section size %d", parentSectionSize)
+	}
+	bloomTrieRatio := BloomTrieFrequency / parentSectionSize
+	if uint64(len(sectionHeads)) != bloomTrieRatio {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("parent section head count mismatch: have %d, want %d", len(sectionHeads), bloomTrieRatio)
+	}
+	return replayBloomTrieSection(db, sectionIdx, sectionHeads[bloomTrieRatio-1], parentSectionSize, bloomTrieRatio, sectionHeads)
+}
+
+// replayBloomTrieSection returns the stored root of a BloomTrie section and the
+// root recomputed on top of the stored root of the previous section.
+func replayBloomTrieSection(db ethdb.Database, section uint64, sectionHead common.Hash, parentSectionSize, bloomTrieRatio uint64, parentSectionHeads []common.Hash) (storedRoot, replayedRoot common.Hash, err error) {
+	storedRoot = GetBloomTrieRoot(db, section, sectionHead)
+	if storedRoot == (common.Hash{}) {
+		return common.Hash{}, common.Hash{}, fmt.Errorf("no bloom trie root stored for section %d", section)
+	}
+	var prevRoot common.Hash
+	if section > 0 {
+		prevHead := rawdb.ReadCanonicalHash(db, section*BloomTrieFrequency-1)
+		if prevRoot = GetBloomTrieRoot(db, section-1, prevHead); prevRoot == (common.Hash{}) {
+			return storedRoot, common.Hash{}, fmt.Errorf("no bloom trie root stored for previous section %d", section-1)
+		}
+	}
+	t, err := trie.New(prevRoot, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		return storedRoot, common.Hash{}, err
+	}
+	if _, _, err := updateBloomTrie(db, t, section, parentSectionSize, bloomTrieRatio, parentSectionHeads); err != nil {
+		return storedRoot, common.Hash{}, err
+	}
+	return storedRoot, t.Hash(), nil
+}
+
+// Stats returns the statistics of the last successfully committed section.
+func (b *BloomTrieIndexerBackend) Stats() SectionStats {
+	b.statsLock.RLock()
+	defer b.statsLock.RUnlock()
+
+	return b.stats
+}
+
+// AllStats returns the statistics of all sections committed by the backend, in
+// commit order.
+func (b *BloomTrieIndexerBackend) AllStats() []SectionStats {
+	b.statsLock.RLock()
+	defer b.statsLock.RUnlock()
+
+	return append([]SectionStats(nil), b.history...)
+}
+
+// ProjectedDiskUsage estimates the size of the compressed bloom bits stored for a
+// completed section, averaged over the last few committed sections. Before the
+// first commit it conservatively assumes the bloom bits do not compress at all.
+func (b *BloomTrieIndexerBackend) ProjectedDiskUsage() uint64 {
+	b.statsLock.RLock()
+	defer b.statsLock.RUnlock()
+
+	recent := b.history
+	if len(recent) > bloomTrieUsageWindow {
+		recent = recent[len(recent)-bloomTrieUsageWindow:]
+	}
+	if len(recent) == 0 {
+		return types.BloomBitLength * b.parentSectionSize * b.bloomTrieRatio / 8
+	}
+	var total uint64
+	for _, stats := range recent {
+		total += stats.CompressedBytes
+	}
+	return total / uint64(len(recent))
+}
+
+// CompressionRatio returns the ratio of the compressed to the decompressed size of
+// the bloom bits of the section.
+func (s SectionStats) CompressionRatio() float64 {
+	if s.DecompressedBytes == 0 {
+		return 0
+	}
+	return float64(s.CompressedBytes) / float64(s.DecompressedBytes)
+}
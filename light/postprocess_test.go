@@ -0,0 +1,2444 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/common/bitutil"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/core/bloombits"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/metrics"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+// makeTestHeaderChain writes a canonical chain of n headers (including the
+// genesis header) together with their total difficulties into db.
+func makeTestHeaderChain(db ethdb.Database, n uint64) []*types.Header {
+	var (
+		headers = make([]*types.Header, n)
+		parent  common.Hash
+		td      = new(big.Int)
+	)
+	for i := uint64(0); i < n; i++ {
+		header := &types.Header{
+			ParentHash: parent,
+			Number:     new(big.Int).SetUint64(i),
+			Difficulty: big.NewInt(131072),
+			Time:       new(big.Int).SetUint64(i * 15),
+		}
+		hash := header.Hash()
+		td.Add(td, header.Difficulty)
+
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteTd(db, hash, i, td)
+		rawdb.WriteCanonicalHash(db, hash, i)
+
+		headers[i], parent = header, hash
+	}
+	return headers
+}
+
+// newTestChtBackend creates a CHT indexer backend operating on db with the given
+// section size.
+func newTestChtBackend(db ethdb.Database, sectionSize uint64) *ChtIndexerBackend {
+	return &ChtIndexerBackend{
+		diskdb:      db,
+		triedb:      trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)),
+		sectionSize: sectionSize,
+	}
+}
+
+// processChtSection runs a full section of headers through the backend.
+func processChtSection(t testing.TB, backend *ChtIndexerBackend, headers []*types.Header, section uint64, lastHead common.Hash) {
+	if err := backend.Reset(section, lastHead); err != nil {
+		t.Fatalf("failed to reset section %d: %v", section, err)
+	}
+	for _, header := range headers[section*backend.sectionSize : (section+1)*backend.sectionSize] {
+		backend.Process(header)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section %d: %v", section, err)
+	}
+}
+
+func TestChtProcessedBlocks(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	// A partially processed section must not be committed
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:CHTFrequencyServer/2] {
+		backend.Process(header)
+	}
+	if n := backend.ProcessedBlocks(); n != CHTFrequencyServer/2 {
+		t.Fatalf("processed block count mismatch: have %d, want %d", n, CHTFrequencyServer/2)
+	}
+	if err := backend.Commit(); err == nil {
+		t.Fatalf("incomplete section committed")
+	}
+	// Resetting must clear the counter and allow full sections through
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	if n := backend.ProcessedBlocks(); n != CHTFrequencyServer {
+		t.Fatalf("processed block count mismatch: have %d, want %d", n, CHTFrequencyServer)
+	}
+	backend.Reset(1, headers[CHTFrequencyServer-1].Hash())
+	if n := backend.ProcessedBlocks(); n != 0 {
+		t.Fatalf("processed block count not reset: have %d", n)
+	}
+}
+
+func TestBloomTrieWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bloomtrie-wal")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bloomtrie.wal")
+
+	// Simulate a crash after the log was written but before the batch made it to disk
+	entries := []walEntry{{[]byte("key1"), []byte("value1")}, {[]byte("key2"), []byte("value2")}}
+	if err := newWriteAheadLog(path).append(entries); err != nil {
+		t.Fatalf("failed to append to log: %v", err)
+	}
+	db := ethdb.NewMemDatabase()
+	indexer, err := NewBloomTrieIndexerWithWAL(db, false, path)
+	if err != nil {
+		t.Fatalf("failed to create indexer: %v", err)
+	}
+	defer indexer.Close()
+
+	for _, entry := range entries {
+		value, err := db.Get(append([]byte(BloomTrieTablePrefix), entry.Key...))
+		if err != nil || !bytes.Equal(value, entry.Value) {
+			t.Errorf("entry %q not replayed: have %q, err %v", entry.Key, value, err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("log not truncated after replay: %v", err)
+	}
+	// Batches written through the log must leave it empty after success
+	wdb := &walDatabase{Database: ethdb.NewMemDatabase(), wal: newWriteAheadLog(path)}
+	batch := wdb.NewBatch()
+	batch.Put([]byte("key3"), []byte("value3"))
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	if ok, _ := wdb.Has([]byte("key3")); !ok {
+		t.Errorf("batch entry missing from database")
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != 0 {
+		t.Errorf("log not truncated after batch write: %v", err)
+	}
+	// An unusable log must prevent the indexer from being created
+	if indexer, err := NewBloomTrieIndexerWithWAL(db, false, dir); err == nil {
+		indexer.Close()
+		t.Errorf("indexer created with unusable log")
+	}
+}
+
+func TestChtAuditSink(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+
+	// Flush partially too, so the log spans several batches
+	var sink bytes.Buffer
+	config := DefaultServerChtIndexerConfig
+	config.FlushLimit, config.AuditSink = 1000, &sink
+	backend := newChtIndexerBackend(db, &config)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	if sink.Len() == 0 {
+		t.Fatalf("no trie nodes recorded in the audit sink")
+	}
+	// Replaying the log into an empty database must reconstruct the CHT
+	head := headers[len(headers)-1].Hash()
+	root := GetChtRoot(db, 0, head)
+
+	restored := ethdb.NewMemDatabase()
+	n, err := ReplayChtAuditLog(restored, &sink)
+	if err != nil {
+		t.Fatalf("failed to replay audit log: %v", err)
+	}
+	var stored int
+	iterateWithPrefix(db, []byte(ChtTablePrefix), func(key, value []byte) error {
+		stored++
+		return nil
+	})
+	if n != stored {
+		t.Errorf("replayed node count mismatch: have %d, want %d", n, stored)
+	}
+	cht, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(restored, ChtTablePrefix)))
+	if err != nil {
+		t.Fatalf("failed to open restored CHT: %v", err)
+	}
+	for _, header := range headers {
+		var encNumber [8]byte
+		binary.BigEndian.PutUint64(encNumber[:], header.Number.Uint64())
+		if data, err := cht.TryGet(encNumber[:]); err != nil || len(data) == 0 {
+			t.Fatalf("block %d missing from restored CHT: %v", header.Number, err)
+		}
+	}
+}
+
+func TestChtNodeEqual(t *testing.T) {
+	tests := []struct {
+		a, b  ChtNode
+		equal bool
+	}{
+		{ChtNode{common.Hash{1}, big.NewInt(1)}, ChtNode{common.Hash{1}, big.NewInt(1)}, true},
+		{ChtNode{common.Hash{1}, big.NewInt(1)}, ChtNode{common.Hash{2}, big.NewInt(1)}, false},
+		{ChtNode{common.Hash{1}, big.NewInt(1)}, ChtNode{common.Hash{1}, big.NewInt(2)}, false},
+		{ChtNode{common.Hash{1}, nil}, ChtNode{common.Hash{1}, big.NewInt(0)}, false},
+		{ChtNode{common.Hash{1}, nil}, ChtNode{common.Hash{1}, nil}, true},
+	}
+	for i, tt := range tests {
+		if eq := tt.a.Equal(tt.b); eq != tt.equal {
+			t.Errorf("test %d: equality mismatch: have %v, want %v", i, eq, tt.equal)
+		}
+	}
+}
+
+// proveChtEntry creates a Merkle proof of the given block number in the CHT with
+// the given root.
+func proveChtEntry(db ethdb.Database, root common.Hash, blockNum uint64) ([][]byte, error) {
+	t, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, ChtTablePrefix)))
+	if err != nil {
+		return nil, err
+	}
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], blockNum)
+
+	var proof NodeList
+	if err := t.Prove(encNumber[:], 0, &proof); err != nil {
+		return nil, err
+	}
+	nodes := make([][]byte, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+// makeTestChtProofs builds a single CHT section and returns its root along with
+// proofs for the first count blocks.
+func makeTestChtProofs(t testing.TB, count int) ([]*types.Header, common.Hash, [][][]byte) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit CHT: %v", err)
+	}
+	root := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	proofs := make([][][]byte, count)
+	for i := range proofs {
+		proof, err := proveChtEntry(db, root, uint64(i))
+		if err != nil {
+			t.Fatalf("failed to prove block %d: %v", i, err)
+		}
+		proofs[i] = proof
+	}
+	return headers, root, proofs
+}
+
+func TestMerkleProofSet(t *testing.T) {
+	headers, root, proofs := makeTestChtProofs(t, 100)
+
+	set := NewMerkleProofSet(root)
+	total := 0
+	for i, proof := range proofs {
+		set.Add(uint64(i), proof)
+		total += len(proof)
+	}
+	if set.NodeCount() >= total {
+		t.Errorf("shared nodes not deduplicated: %d nodes, %d total", set.NodeCount(), total)
+	}
+	nodes, err := set.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify proof set: %v", err)
+	}
+	for i := range proofs {
+		if nodes[uint64(i)].Hash != headers[i].Hash() {
+			t.Errorf("block %d: hash mismatch: have %x, want %x", i, nodes[uint64(i)].Hash, headers[i].Hash())
+		}
+	}
+	// Proofs must not verify against a different root
+	set = NewMerkleProofSet(common.Hash{1})
+	set.Add(0, proofs[0])
+	if _, err := set.Verify(); err == nil {
+		t.Errorf("proof set verified against invalid root")
+	}
+}
+
+func TestMerkleProofSetCompressedProofs(t *testing.T) {
+	headers, root, proofs := makeTestChtProofs(t, 100)
+
+	set := NewMerkleProofSet(root)
+	size := 0
+	for i, proof := range proofs {
+		set.Add(uint64(i), proof)
+		for _, node := range proof {
+			size += len(node)
+		}
+	}
+	compressed := set.CompressedProofs()
+	have := 0
+	for _, node := range compressed {
+		have += len(node)
+	}
+	if have*2 > size {
+		t.Errorf("compressed proofs too large: %d bytes, %d uncompressed", have, size)
+	}
+	// The compressed nodes must prove all blocks on their own
+	decompressed := NewMerkleProofSet(root)
+	for i := range proofs {
+		decompressed.Add(uint64(i), compressed)
+	}
+	nodes, err := decompressed.Verify()
+	if err != nil {
+		t.Fatalf("failed to verify compressed proofs: %v", err)
+	}
+	for i := range proofs {
+		if nodes[uint64(i)].Hash != headers[i].Hash() {
+			t.Errorf("block %d: hash mismatch: have %x, want %x", i, nodes[uint64(i)].Hash, headers[i].Hash())
+		}
+	}
+}
+
+func BenchmarkMerkleProofSet(b *testing.B) {
+	_, root, proofs := makeTestChtProofs(b, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		set := NewMerkleProofSet(root)
+		for j, proof := range proofs {
+			set.Add(uint64(j), proof)
+		}
+		if _, err := set.Verify(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndividualChtProofs(b *testing.B) {
+	_, root, proofs := makeTestChtProofs(b, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, proof := range proofs {
+			var encNumber [8]byte
+			binary.BigEndian.PutUint64(encNumber[:], uint64(j))
+
+			nodes := make(NodeList, len(proof))
+			for k, node := range proof {
+				nodes[k] = node
+			}
+			if _, _, err := trie.VerifyProof(root, encNumber[:], nodes.NodeSet()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestBloomTrieIndexerMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	indexer := NewBloomTrieIndexerWithMetrics(ethdb.NewMemDatabase(), false, reg)
+	defer indexer.Close()
+
+	for _, name := range []string{"light/bloomtrie/commit", "light/bloomtrie/compression", "light/bloomtrie/nodes", "light/bloomtrie/projectedDiskUsage"} {
+		if reg.Get(name) == nil {
+			t.Errorf("metric %s not registered", name)
+		}
+	}
+}
+
+func TestChtVerifyAgainstChain(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+
+	head := headers[len(headers)-1].Hash()
+	if mismatches, err := backend.VerifyAgainstChain(dbHeaderReader{db}, 0, head, 64); err != nil || mismatches != 0 {
+		t.Fatalf("consistent section failed verification: %d mismatches, err %v", mismatches, err)
+	}
+	// Drop the canonical chain, every sample should mismatch
+	for _, header := range headers {
+		rawdb.DeleteCanonicalHash(db, header.Number.Uint64())
+	}
+	if mismatches, err := backend.VerifyAgainstChain(dbHeaderReader{db}, 0, head, 64); err != nil || mismatches != 64 {
+		t.Fatalf("mismatch count wrong: have %d, want %d, err %v", mismatches, 64, err)
+	}
+	if _, err := backend.VerifyAgainstChain(dbHeaderReader{db}, 1, head, 64); err == nil {
+		t.Fatalf("verified section without stored root")
+	}
+}
+
+func TestGetChtRootOrError(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+	head := headers[CHTFrequencyServer-1].Hash()
+
+	root, err := GetChtRootOrError(db, 0, head, 0)
+	if err != nil {
+		t.Fatalf("indexed section rejected: %v", err)
+	}
+	if want := GetChtRoot(db, 0, head); root != want {
+		t.Fatalf("root mismatch: have %x, want %x", root, want)
+	}
+	if _, err := GetChtRootOrError(db, 0, common.Hash{1}, 0); err != ErrNoTrustedCht {
+		t.Fatalf("unknown head: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	_, err = GetChtRootOrError(db, 1, head, 0)
+	if nerr, ok := err.(*ErrSectionNotIndexed); !ok || nerr.Section != 1 || nerr.MaxIndexedSection != 0 {
+		t.Fatalf("unindexed section: have %v, want *ErrSectionNotIndexed", err)
+	}
+}
+
+func TestChtSectionBlocks(t *testing.T) {
+	tests := []struct {
+		section, size uint64
+		start, head   uint64
+	}{
+		{0, CHTFrequencyServer, 0, 4095},
+		{1, CHTFrequencyServer, 4096, 8191},
+		{0, CHTFrequencyClient, 0, 32767},
+		{174, CHTFrequencyClient, 5701632, 5734399},
+	}
+	for i, tt := range tests {
+		if start := ChtSectionStartBlock(tt.section, tt.size); start != tt.start {
+			t.Errorf("test %d: start block mismatch: have %d, want %d", i, start, tt.start)
+		}
+		if head := ChtSectionHeadBlock(tt.section, tt.size); head != tt.head {
+			t.Errorf("test %d: head block mismatch: have %d, want %d", i, head, tt.head)
+		}
+	}
+}
+
+func TestAlignToSection(t *testing.T) {
+	tests := []struct {
+		block, size uint64
+		start, end  uint64
+	}{
+		{0, CHTFrequencyServer, 0, 4095},
+		{4095, CHTFrequencyServer, 0, 4095},
+		{4096, CHTFrequencyServer, 4096, 8191},
+		{5000, CHTFrequencyServer, 4096, 8191},
+		{32767, CHTFrequencyClient, 0, 32767},
+		{5710000, CHTFrequencyClient, 5701632, 5734399},
+		{100, 1, 100, 100},
+	}
+	for i, tt := range tests {
+		start, end := AlignToSection(tt.block, tt.size)
+		if start != tt.start || end != tt.end {
+			t.Errorf("test %d: range mismatch: have [%d, %d], want [%d, %d]", i, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestBloomTrieSectionFromBlock(t *testing.T) {
+	tests := []struct {
+		block, parentSize uint64
+		section, parent   uint64
+	}{
+		{0, ethBloomBitsSection, 0, 0},
+		{4095, ethBloomBitsSection, 0, 0},
+		{4096, ethBloomBitsSection, 0, 1},
+		{32767, ethBloomBitsSection, 0, 7},
+		{32768, ethBloomBitsSection, 1, 8},
+		{32768, BloomTrieFrequency, 1, 1},
+		{5734399, BloomTrieFrequency, 174, 174},
+	}
+	for i, tt := range tests {
+		if section := BloomTrieSectionFromBlock(tt.block); section != tt.section {
+			t.Errorf("test %d: section mismatch: have %d, want %d", i, section, tt.section)
+		}
+		if parent := BloomTrieParentSectionFromBlock(tt.block, tt.parentSize); parent != tt.parent {
+			t.Errorf("test %d: parent section mismatch: have %d, want %d", i, parent, tt.parent)
+		}
+	}
+}
+
+// newTestBloomTrieBackend creates a BloomTrie indexer backend operating on db,
+// built from parent bloom bits sections of the given size.
+func newTestBloomTrieBackend(db ethdb.Database, parentSectionSize uint64) *BloomTrieIndexerBackend {
+	ratio := uint64(BloomTrieFrequency / parentSectionSize)
+	return &BloomTrieIndexerBackend{
+		diskdb:            db,
+		triedb:            trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)),
+		parentSectionSize: parentSectionSize,
+		bloomTrieRatio:    ratio,
+		sectionHeads:      make([]common.Hash, ratio),
+	}
+}
+
+// testBloomBits generates a deterministic bloom bit vector for the given bit and
+// parent section.
+func testBloomBits(bit uint, parentSection, parentSectionSize uint64) []byte {
+	data := make([]byte, parentSectionSize/8)
+	if bit%3 != 0 {
+		for i := uint64(bit); i < uint64(len(data)); i += 37 + parentSection {
+			data[i] = byte(1 << ((uint64(bit) + i) % 8))
+		}
+	}
+	return data
+}
+
+// makeTestBloomSection writes the bloom bits of all parent sections covered by
+// the given BloomTrie section into db and returns the parent section head headers.
+func makeTestBloomSection(db ethdb.Database, section, parentSectionSize uint64) []*types.Header {
+	ratio := uint64(BloomTrieFrequency / parentSectionSize)
+	heads := make([]*types.Header, ratio)
+	for j := uint64(0); j < ratio; j++ {
+		parentSection := section*ratio + j
+		heads[j] = &types.Header{
+			Number:     new(big.Int).SetUint64((parentSection+1)*parentSectionSize - 1),
+			Difficulty: big.NewInt(131072),
+		}
+		hash := heads[j].Hash()
+		for i := uint(0); i < types.BloomBitLength; i++ {
+			rawdb.WriteBloomBits(db, i, parentSection, hash, bitutil.CompressBytes(testBloomBits(i, parentSection, parentSectionSize)))
+		}
+	}
+	return heads
+}
+
+// processBloomTrieSection runs the given parent section heads through the backend
+// and commits the section.
+func processBloomTrieSection(t testing.TB, backend *BloomTrieIndexerBackend, section uint64, lastHead common.Hash, heads []*types.Header) {
+	if err := backend.Reset(section, lastHead); err != nil {
+		t.Fatalf("failed to reset section %d: %v", section, err)
+	}
+	for _, head := range heads {
+		backend.Process(head)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section %d: %v", section, err)
+	}
+}
+
+func TestBloomTrieSectionStats(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+
+	stats := backend.Stats()
+	if stats.Section != 0 {
+		t.Errorf("section mismatch: have %d, want %d", stats.Section, 0)
+	}
+	if want := GetBloomTrieRoot(db, 0, heads[len(heads)-1].Hash()); stats.Root != want {
+		t.Errorf("root mismatch: have %x, want %x", stats.Root, want)
+	}
+	if want := uint64(types.BloomBitLength * BloomTrieFrequency / 8); stats.DecompressedBytes != want {
+		t.Errorf("decompressed size mismatch: have %d, want %d", stats.DecompressedBytes, want)
+	}
+	if stats.CompressedBytes == 0 || stats.CompressedBytes >= stats.DecompressedBytes {
+		t.Errorf("invalid compressed size: %d", stats.CompressedBytes)
+	}
+}
+
+func TestBloomTrieAllStats(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	if stats := backend.AllStats(); len(stats) != 0 {
+		t.Fatalf("stats before commit: %+v", stats)
+	}
+	var lastHead common.Hash
+	for section := uint64(0); section < 3; section++ {
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+	}
+	stats := backend.AllStats()
+	if len(stats) != 3 {
+		t.Fatalf("stats count mismatch: have %d, want 3", len(stats))
+	}
+	for i, s := range stats {
+		if s.Section != uint64(i) {
+			t.Errorf("stats %d: section mismatch: have %d", i, s.Section)
+		}
+		if ratio := s.CompressionRatio(); ratio <= 0 || ratio >= 1 {
+			t.Errorf("stats %d: invalid compression ratio %v", i, ratio)
+		}
+	}
+	if stats[2] != backend.Stats() {
+		t.Fatalf("last stats mismatch: have %+v, want %+v", stats[2], backend.Stats())
+	}
+}
+
+func TestBloomTrieProjectedDiskUsage(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	if want := uint64(types.BloomBitLength * BloomTrieFrequency / 8); backend.ProjectedDiskUsage() != want {
+		t.Fatalf("default usage mismatch: have %d, want %d", backend.ProjectedDiskUsage(), want)
+	}
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+	if want := backend.Stats().CompressedBytes; backend.ProjectedDiskUsage() != want {
+		t.Fatalf("usage mismatch after commit: have %d, want %d", backend.ProjectedDiskUsage(), want)
+	}
+	// Only the last bloomTrieUsageWindow commits should be averaged
+	backend.history = nil
+	for i := uint64(0); i < bloomTrieUsageWindow+2; i++ {
+		backend.history = append(backend.history, SectionStats{Section: i, CompressedBytes: i * 100})
+	}
+	if want := uint64(650); backend.ProjectedDiskUsage() != want {
+		t.Fatalf("windowed usage mismatch: have %d, want %d", backend.ProjectedDiskUsage(), want)
+	}
+}
+
+func TestValidateBloomTrieRoot(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+
+	var (
+		ratio       = uint64(BloomTrieFrequency / ethBloomBitsSection)
+		sectionHead = heads[len(heads)-1].Hash()
+		headHashes  = make([]common.Hash, len(heads))
+	)
+	for i, head := range heads {
+		headHashes[i] = head.Hash()
+	}
+	if err := ValidateBloomTrieRoot(db, 0, sectionHead, ethBloomBitsSection, ratio, headHashes); err != nil {
+		t.Fatalf("valid bloom trie root rejected: %v", err)
+	}
+	// Corrupt a single bloom bit vector and ensure the mismatch is detected
+	rawdb.WriteBloomBits(db, 1, 0, headHashes[0], bitutil.CompressBytes(make([]byte, ethBloomBitsSection/8)))
+	if err := ValidateBloomTrieRoot(db, 0, sectionHead, ethBloomBitsSection, ratio, headHashes); err == nil {
+		t.Fatalf("corrupt bloom bits not detected")
+	}
+}
+
+func TestReplayBloomTrieSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+
+	headHashes := make([]common.Hash, len(heads))
+	for i, head := range heads {
+		headHashes[i] = head.Hash()
+	}
+	stored, replayed, err := ReplayBloomTrieSection(db, 0, headHashes, ethBloomBitsSection)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if stored != replayed {
+		t.Fatalf("root mismatch: stored %x, replayed %x", stored, replayed)
+	}
+	if _, _, err := ReplayBloomTrieSection(db, 0, headHashes[1:], ethBloomBitsSection); err == nil {
+		t.Fatalf("short section head list accepted")
+	}
+}
+
+func TestRebuildBloomTrieSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	for _, head := range heads {
+		rawdb.WriteHeader(db, head)
+		rawdb.WriteCanonicalHash(db, head.Hash(), head.Number.Uint64())
+	}
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+
+	// Lose the root node of the section and rebuild it
+	head := heads[len(heads)-1].Hash()
+	root := GetBloomTrieRoot(db, 0, head)
+	ethdb.NewTable(db, BloomTrieTablePrefix).Delete(root.Bytes())
+	if _, err := BloomTrieLookup(db, 1, 0, head); err == nil {
+		t.Fatalf("corrupt bloom trie read")
+	}
+	bus := NewIndexerEventBus()
+	events := bus.Subscribe()
+	defer bus.Unsubscribe(events)
+
+	errc := make(chan error, 1)
+	go func() { errc <- RebuildBloomTrieSection(db, false, 0, WithBloomTrieEvents(bus)) }()
+
+	if ev := <-events; ev.Section != 0 || ev.Head != head || ev.Root != root {
+		t.Fatalf("commit event mismatch: have %+v", ev)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to rebuild section: %v", err)
+	}
+	bits, err := BloomTrieLookup(db, 1, 0, head)
+	if err != nil {
+		t.Fatalf("rebuilt bloom trie not readable: %v", err)
+	}
+	var want []byte
+	for j := uint64(0); j < uint64(len(heads)); j++ {
+		want = append(want, testBloomBits(1, j, ethBloomBitsSection)...)
+	}
+	if !bytes.Equal(bits, want) {
+		t.Fatalf("rebuilt bloom bits mismatch")
+	}
+}
+
+func TestChtFlushPartial(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+
+	// Build the section in one go for a reference root
+	reference := newTestChtBackend(ethdb.NewMemDatabase(), CHTFrequencyServer)
+	reference.diskdb = db
+	processChtSection(t, reference, headers, 0, common.Hash{})
+	want := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	// Build it again with intermediate flushes into a separate trie database
+	flushdb := ethdb.NewMemDatabase()
+	backend := newTestChtBackend(flushdb, CHTFrequencyServer)
+	backend.diskdb = db
+	backend.Reset(0, common.Hash{})
+	for i, header := range headers {
+		backend.Process(header)
+		if i%1000 == 999 {
+			if err := backend.FlushPartial(); err != nil {
+				t.Fatalf("failed to flush partial section: %v", err)
+			}
+			if flushdb.Len() == 0 {
+				t.Fatalf("no trie nodes written by partial flush")
+			}
+		}
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+	if have := GetChtRoot(db, 0, headers[len(headers)-1].Hash()); have != want {
+		t.Fatalf("root mismatch after partial flushes: have %x, want %x", have, want)
+	}
+}
+
+// localBloomOdr is an OdrBackend serving bloom bits from the local database only.
+type localBloomOdr struct {
+	OdrBackend
+	db ethdb.Database
+}
+
+func (odr localBloomOdr) Database() ethdb.Database             { return odr.db }
+func (odr localBloomOdr) BloomTrieIndexer() *core.ChainIndexer { return nil }
+
+// makeTestCanonicalBloomSection stores the bloom bits of a client side bloom bits
+// section along with the canonical hash of its head.
+func makeTestCanonicalBloomSection(db ethdb.Database, section uint64) common.Hash {
+	head := makeTestBloomSection(db, section, BloomTrieFrequency)[0]
+	rawdb.WriteCanonicalHash(db, head.Hash(), head.Number.Uint64())
+	return head.Hash()
+}
+
+func TestBloomTrieReadCache(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	head := makeTestCanonicalBloomSection(db, 0)
+	odr := localBloomOdr{db: db}
+	cache := NewBloomTrieReadCache(16)
+
+	want := testBloomBits(5, 0, BloomTrieFrequency)
+	for i := 0; i < 2; i++ {
+		bitsets, err := GetDecompressedBloomBits(context.Background(), odr, cache, 5, []uint64{0})
+		if err != nil {
+			t.Fatalf("failed to read bloom bits: %v", err)
+		}
+		if !bytes.Equal(bitsets[0], want) {
+			t.Fatalf("bloom bits mismatch")
+		}
+	}
+	if cache.Len() != 1 {
+		t.Errorf("cache size mismatch: have %d, want %d", cache.Len(), 1)
+	}
+	if _, ok := cache.Get(5, 0, head); !ok {
+		t.Errorf("bloom bits not cached under section head")
+	}
+	if _, ok := cache.Get(5, 0, common.Hash{1}); ok {
+		t.Errorf("cached entry served for different section head")
+	}
+	if _, err := GetDecompressedBloomBits(context.Background(), odr, cache, 5, []uint64{1}); err != ErrNoTrustedBloomTrie {
+		t.Errorf("unavailable section: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
+
+func TestBloomBitsLookup(t *testing.T) {
+	// Build a BloomTrie locally from server side bloom bits sections
+	db := ethdb.NewMemDatabase()
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), 0, common.Hash{}, heads)
+	head := heads[len(heads)-1].Hash()
+
+	for _, bit := range []uint{1, 3, 100} {
+		var want []byte
+		for j := uint64(0); j < uint64(len(heads)); j++ {
+			want = append(want, testBloomBits(bit, j, ethBloomBitsSection)...)
+		}
+		have, err := BloomBitsLookup(context.Background(), db, bit, 0, head, nil)
+		if err != nil {
+			t.Fatalf("bit %d: local lookup failed: %v", bit, err)
+		}
+		if !bytes.Equal(have, bitutil.CompressBytes(want)) {
+			t.Errorf("bit %d: bloom bits mismatch", bit)
+		}
+	}
+	// Without a local trie, the lookup has to fall back to the backend
+	if _, err := BloomBitsLookup(context.Background(), ethdb.NewMemDatabase(), 1, 0, head, nil); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("missing trie without fallback: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+	remote := ethdb.NewMemDatabase()
+	makeTestCanonicalBloomSection(remote, 0)
+	have, err := BloomBitsLookup(context.Background(), ethdb.NewMemDatabase(), 1, 0, head, localBloomOdr{db: remote})
+	if err != nil {
+		t.Fatalf("fallback lookup failed: %v", err)
+	}
+	if !bytes.Equal(have, bitutil.CompressBytes(testBloomBits(1, 0, BloomTrieFrequency))) {
+		t.Errorf("fallback bloom bits mismatch")
+	}
+}
+
+func TestHistoricalBloomFilter(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		addr    = common.HexToAddress("0x01")
+		topic   = common.HexToHash("0x02")
+		other   = common.HexToAddress("0x03")
+		logBits = make(map[uint]bool)
+	)
+	for _, key := range [][]byte{addr.Bytes(), topic.Bytes()} {
+		for _, bit := range bloomIndexes(key) {
+			logBits[bit] = true
+		}
+	}
+	// Store bloom bits with a single block of section 1 containing the log
+	const block = 5000
+	for section := uint64(0); section < 2; section++ {
+		ratio := uint64(BloomTrieFrequency / ethBloomBitsSection)
+		heads := make([]*types.Header, ratio)
+		for j := uint64(0); j < ratio; j++ {
+			parentSection := section*ratio + j
+			heads[j] = &types.Header{Number: new(big.Int).SetUint64((parentSection+1)*ethBloomBitsSection - 1), Difficulty: big.NewInt(1)}
+			for bit := uint(0); bit < types.BloomBitLength; bit++ {
+				data := make([]byte, ethBloomBitsSection/8)
+				if section == 1 && j == block/ethBloomBitsSection && logBits[bit] {
+					offset := block % ethBloomBitsSection
+					data[offset/8] |= 0x80 >> (offset % 8)
+				}
+				rawdb.WriteBloomBits(db, bit, parentSection, heads[j].Hash(), bitutil.CompressBytes(data))
+			}
+		}
+		var last common.Hash
+		if section > 0 {
+			last = rawdb.ReadCanonicalHash(db, section*BloomTrieFrequency-1)
+		}
+		processBloomTrieSection(t, newTestBloomTrieBackend(db, ethBloomBitsSection), section, last, heads)
+		rawdb.WriteCanonicalHash(db, heads[ratio-1].Hash(), heads[ratio-1].Number.Uint64())
+	}
+	filter := NewHistoricalBloomFilter(nil)
+	tests := []struct {
+		address common.Address
+		topics  []common.Hash
+		want    []uint64
+	}{
+		{addr, nil, []uint64{1}},
+		{addr, []common.Hash{topic}, []uint64{1}},
+		{other, nil, nil},
+		{addr, []common.Hash{common.HexToHash("0x04")}, nil},
+	}
+	for i, tt := range tests {
+		have, err := filter.MatchesAnySection(context.Background(), tt.address, tt.topics, db)
+		if err != nil {
+			t.Fatalf("test %d: filter failed: %v", i, err)
+		}
+		if !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: matching sections mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+// benchmarkBloomBitsRead measures a log filter like retrieval of every bloom bit
+// of the same sections, repeated for each iteration.
+func benchmarkBloomBitsRead(b *testing.B, cache *BloomTrieReadCache) {
+	db := ethdb.NewMemDatabase()
+	sections := []uint64{0, 1}
+	for _, section := range sections {
+		makeTestCanonicalBloomSection(db, section)
+	}
+	odr := localBloomOdr{db: db}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			if _, err := GetDecompressedBloomBits(context.Background(), odr, cache, bit, sections); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBloomBitsReadUncached(b *testing.B) { benchmarkBloomBitsRead(b, nil) }
+func BenchmarkBloomBitsReadCached(b *testing.B) {
+	benchmarkBloomBitsRead(b, NewBloomTrieReadCache(2*types.BloomBitLength))
+}
+
+func TestChtReverseIndex(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.revTriedb = trie.NewDatabase(ethdb.NewTable(db, ChtReverseTablePrefix))
+
+	if _, err := GetBlockNumberByChtHash(db, headers[0].Hash()); err != ErrNotInReverseIndex {
+		t.Fatalf("lookup before commit: have %v, want %v", err, ErrNotInReverseIndex)
+	}
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	processChtSection(t, backend, headers, 1, headers[CHTFrequencyServer-1].Hash())
+
+	for _, num := range []uint64{0, 1, CHTFrequencyServer - 1, CHTFrequencyServer, 2*CHTFrequencyServer - 1} {
+		have, err := GetBlockNumberByChtHash(db, headers[num].Hash())
+		if err != nil {
+			t.Fatalf("block %d: lookup failed: %v", num, err)
+		}
+		if have != num {
+			t.Errorf("block number mismatch: have %d, want %d", have, num)
+		}
+	}
+	if _, err := GetBlockNumberByChtHash(db, common.Hash{1}); err != ErrNotInReverseIndex {
+		t.Errorf("unknown hash lookup: have %v, want %v", err, ErrNotInReverseIndex)
+	}
+}
+
+func TestChtReverseIndexFlushPartial(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.revTriedb = trie.NewDatabase(ethdb.NewTable(db, ChtReverseTablePrefix))
+
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:CHTFrequencyServer/2] {
+		backend.Process(header)
+	}
+	if err := backend.FlushPartial(); err != nil {
+		t.Fatalf("failed to flush partial section: %v", err)
+	}
+	if n := backend.revTrie.DirtyNodeCount(); n != 0 {
+		t.Fatalf("dirty reverse index nodes after flush: have %d, want 0", n)
+	}
+	for _, header := range headers[CHTFrequencyServer/2:] {
+		backend.Process(header)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+	for _, num := range []uint64{0, CHTFrequencyServer/2 - 1, CHTFrequencyServer - 1} {
+		if have, err := GetBlockNumberByChtHash(db, headers[num].Hash()); err != nil || have != num {
+			t.Errorf("block %d: lookup mismatch: have %d, err %v", num, have, err)
+		}
+	}
+}
+
+func TestBloomTrieProcessBatch(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, BloomTrieFrequency+1)
+
+	single := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	single.Reset(0, common.Hash{})
+	for _, header := range headers[:BloomTrieFrequency] {
+		single.Process(header)
+	}
+	batch := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	batch.Reset(0, common.Hash{})
+	if err := batch.ProcessBatch(headers[:BloomTrieFrequency]); err != nil {
+		t.Fatalf("failed to process batch: %v", err)
+	}
+	for i := range single.sectionHeads {
+		if single.sectionHeads[i] != batch.sectionHeads[i] {
+			t.Errorf("section head %d mismatch: have %x, want %x", i, batch.sectionHeads[i], single.sectionHeads[i])
+		}
+	}
+	if err := batch.ProcessBatch(headers[BloomTrieFrequency:]); err == nil {
+		t.Errorf("header outside of section accepted")
+	}
+}
+
+func BenchmarkBloomTrieProcess(b *testing.B) {
+	headers := makeTestHeaderChain(ethdb.NewMemDatabase(), BloomTrieFrequency)
+	backend := newTestBloomTrieBackend(ethdb.NewMemDatabase(), ethBloomBitsSection)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, header := range headers {
+			backend.Process(header)
+		}
+	}
+}
+
+func BenchmarkBloomTrieProcessBatch(b *testing.B) {
+	headers := makeTestHeaderChain(ethdb.NewMemDatabase(), BloomTrieFrequency)
+	backend := newTestBloomTrieBackend(ethdb.NewMemDatabase(), ethBloomBitsSection)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := backend.ProcessBatch(headers); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBloomTrieRoundTrip(t *testing.T) {
+	var (
+		db      = ethdb.NewMemDatabase()
+		emitter = common.HexToAddress("0x1234567890123456789012345678901234567890")
+		events  = map[uint64]bool{100: true, 5000: true, 20000: true}
+		headers = make([]*types.Header, BloomTrieFrequency)
+		parent  common.Hash
+	)
+	// Create a chain logging events at known blocks and generate its bloom bits
+	var eventBloom types.Bloom
+	eventBloom.Add(new(big.Int).SetBytes(emitter[:]))
+
+	for i := range headers {
+		headers[i] = &types.Header{
+			ParentHash: parent,
+			Number:     big.NewInt(int64(i)),
+			Difficulty: big.NewInt(131072),
+		}
+		if events[uint64(i)] {
+			headers[i].Bloom = eventBloom
+		}
+		parent = headers[i].Hash()
+	}
+	for j := uint64(0); j < BloomTrieFrequency/ethBloomBitsSection; j++ {
+		gen, _ := bloombits.NewGenerator(ethBloomBitsSection)
+		for i := uint64(0); i < ethBloomBitsSection; i++ {
+			gen.AddBloom(uint(i), headers[j*ethBloomBitsSection+i].Bloom)
+		}
+		head := headers[(j+1)*ethBloomBitsSection-1].Hash()
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			bits, _ := gen.Bitset(bit)
+			rawdb.WriteBloomBits(db, bit, j, head, bitutil.CompressBytes(bits))
+		}
+	}
+	// Run the full indexer cycle over the section
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit bloom trie: %v", err)
+	}
+	root := GetBloomTrieRoot(db, 0, headers[len(headers)-1].Hash())
+	if root == (common.Hash{}) {
+		t.Fatalf("bloom trie root not stored")
+	}
+	// Prove every bloom bit of the event and check the proven vectors
+	tr, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		t.Fatalf("failed to open bloom trie: %v", err)
+	}
+	for bit := uint(0); bit < types.BloomBitLength; bit++ {
+		if eventBloom[types.BloomByteLength-1-bit/8]&(1<<(bit%8)) == 0 {
+			continue
+		}
+		key := ComputeHelperTrieKey(bit, 0)
+
+		var proof NodeList
+		if err := tr.Prove(key[:], 0, &proof); err != nil {
+			t.Fatalf("bit %d: failed to create proof: %v", bit, err)
+		}
+		comp, _, err := trie.VerifyProof(root, key[:], proof.NodeSet())
+		if err != nil {
+			t.Fatalf("bit %d: proof verification failed: %v", bit, err)
+		}
+		vector, err := bitutil.DecompressBytes(comp, BloomTrieFrequency/8)
+		if err != nil {
+			t.Fatalf("bit %d: failed to decompress bloom bits: %v", bit, err)
+		}
+		for i := uint64(0); i < BloomTrieFrequency; i++ {
+			if set := vector[i/8]&(1<<(7-i%8)) != 0; set != events[i] {
+				t.Fatalf("bit %d, block %d: event flag mismatch: have %v, want %v", bit, i, set, events[i])
+			}
+		}
+	}
+}
+
+func TestBloomTrieLookup(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+
+	sectionHead := heads[len(heads)-1].Hash()
+	for _, bit := range []uint{0, 1, 2047} {
+		var want []byte
+		for j := range heads {
+			want = append(want, testBloomBits(bit, uint64(j), ethBloomBitsSection)...)
+		}
+		have, err := BloomTrieLookup(db, bit, 0, sectionHead)
+		if err != nil {
+			t.Fatalf("bit %d: lookup failed: %v", bit, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("bit %d: bloom bits mismatch", bit)
+		}
+	}
+	if _, err := BloomTrieLookup(db, 0, 1, sectionHead); err != ErrNoTrustedBloomTrie {
+		t.Errorf("missing section: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
+
+func TestChtSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 3*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 3; section++ {
+		processChtSection(t, backend, headers, section, lastHead)
+		if have := backend.Section(); have != section {
+			t.Fatalf("section mismatch: have %d, want %d", have, section)
+		}
+		lastHead = headers[(section+1)*CHTFrequencyServer-1].Hash()
+	}
+	// Resetting to an earlier section must be reflected too
+	backend.Reset(1, headers[CHTFrequencyServer-1].Hash())
+	if have := backend.Section(); have != 1 {
+		t.Fatalf("section mismatch after rewind: have %d, want %d", have, 1)
+	}
+}
+
+func TestChtSectionHead(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	backend.Reset(0, common.Hash{})
+	if head := backend.SectionHead(); head != (common.Hash{}) {
+		t.Fatalf("head before processing: %x", head)
+	}
+	for _, header := range headers[:10] {
+		backend.Process(header)
+	}
+	if head, want := backend.SectionHead(), headers[9].Hash(); head != want {
+		t.Fatalf("head mismatch: have %x, want %x", head, want)
+	}
+	backend.Reset(0, common.Hash{})
+	if head := backend.SectionHead(); head != (common.Hash{}) {
+		t.Fatalf("head not cleared by reset: %x", head)
+	}
+}
+
+func TestChtSectionProgress(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	backend.Reset(0, common.Hash{})
+	for i, header := range headers {
+		if have, want := backend.CurrentSectionProgress(), float64(i)/CHTFrequencyServer; have != want {
+			t.Fatalf("progress mismatch after %d blocks: have %v, want %v", i, have, want)
+		}
+		backend.Process(header)
+	}
+	if progress := backend.CurrentSectionProgress(); progress != 1 {
+		t.Fatalf("progress mismatch: have %v, want 1", progress)
+	}
+	backend.Reset(0, common.Hash{})
+	if progress := backend.CurrentSectionProgress(); progress != 0 {
+		t.Fatalf("progress after reset: have %v, want 0", progress)
+	}
+}
+
+func TestChtProcessedRange(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	for _, section := range []uint64{0, 1} {
+		var lastHead common.Hash
+		if section > 0 {
+			lastHead = headers[CHTFrequencyServer-1].Hash()
+		}
+		backend.Reset(section, lastHead)
+		if _, _, ok := backend.ProcessedRange(); ok {
+			t.Fatalf("section %d: range reported before processing", section)
+		}
+		first := section * CHTFrequencyServer
+		for _, header := range headers[first : first+10] {
+			backend.Process(header)
+		}
+		if start, end, ok := backend.ProcessedRange(); !ok || start != first || end != first+9 {
+			t.Fatalf("section %d: partial range mismatch: have [%d, %d]/%v, want [%d, %d]/true", section, start, end, ok, first, first+9)
+		}
+	}
+}
+
+func TestSectionSizeConsistencyCheck(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if size, ok, err := SectionSizeConsistencyCheck(db, CHTFrequencyServer); err != nil || !ok || size != CHTFrequencyServer {
+		t.Fatalf("empty database: have %d/%v/%v, want %d/true/nil", size, ok, err, CHTFrequencyServer)
+	}
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	processChtSection(t, backend, headers, 1, headers[CHTFrequencyServer-1].Hash())
+
+	if size, ok, err := SectionSizeConsistencyCheck(db, CHTFrequencyServer); err != nil || !ok || size != CHTFrequencyServer {
+		t.Errorf("matching size: have %d/%v/%v, want %d/true/nil", size, ok, err, CHTFrequencyServer)
+	}
+	if size, ok, err := SectionSizeConsistencyCheck(db, CHTFrequencyClient); err != nil || ok || size != CHTFrequencyServer {
+		t.Errorf("mismatching size: have %d/%v/%v, want %d/false/nil", size, ok, err, CHTFrequencyServer)
+	}
+}
+
+func TestBloomTrieParentSectionSize(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if size := newBloomTrieIndexerBackend(db, true).ParentSectionSize(); size != BloomTrieFrequency {
+		t.Errorf("client mode size mismatch: have %d, want %d", size, BloomTrieFrequency)
+	}
+	if size := newBloomTrieIndexerBackend(db, false).ParentSectionSize(); size != ethBloomBitsSection {
+		t.Errorf("server mode size mismatch: have %d, want %d", size, ethBloomBitsSection)
+	}
+}
+
+func TestBloomTrieNumParentSections(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	if n := newBloomTrieIndexerBackend(db, true).NumParentSections(); n != 1 {
+		t.Errorf("client mode count mismatch: have %d, want 1", n)
+	}
+	if n := newBloomTrieIndexerBackend(db, false).NumParentSections(); n != BloomTrieFrequency/ethBloomBitsSection {
+		t.Errorf("server mode count mismatch: have %d, want %d", n, BloomTrieFrequency/ethBloomBitsSection)
+	}
+}
+
+func TestChtDirtyNodeCount(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	if n := backend.DirtyNodeCount(); n != 0 {
+		t.Fatalf("dirty nodes before reset: have %d, want 0", n)
+	}
+	if err := backend.FlushPartial(); err != errChtNoSection {
+		t.Fatalf("flush before reset: have %v, want %v", err, errChtNoSection)
+	}
+	backend.Reset(0, common.Hash{})
+	if n := backend.DirtyNodeCount(); n != 0 {
+		t.Fatalf("dirty nodes after reset: have %d, want 0", n)
+	}
+	last := 0
+	for _, header := range headers[:100] {
+		backend.Process(header)
+		if n := backend.DirtyNodeCount(); n < last {
+			t.Fatalf("dirty node count decreased: have %d, previous %d", n, last)
+		} else {
+			last = n
+		}
+	}
+	if last == 0 {
+		t.Fatalf("no dirty nodes after processing")
+	}
+	if err := backend.FlushPartial(); err != nil {
+		t.Fatalf("failed to flush partial section: %v", err)
+	}
+	if n := backend.DirtyNodeCount(); n != 0 {
+		t.Fatalf("dirty nodes after flush: have %d, want 0", n)
+	}
+	// Automatic flushing must keep the dirty set bounded. Each update dirties only
+	// a handful of nodes along its path, so between two checks the dirty set can
+	// only grow by a few nodes per block.
+	backend.flushLimit = 100
+	for _, header := range headers[100:] {
+		backend.Process(header)
+	}
+	if n := backend.DirtyNodeCount(); n > backend.flushLimit+8*chtFlushCheckInterval {
+		t.Fatalf("dirty node count not bounded: have %d", n)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+}
+
+func TestChtMemoryLimit(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+
+	reference := newTestChtBackend(db, CHTFrequencyServer)
+	processChtSection(t, reference, headers, 0, common.Hash{})
+	want := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	const limit = 4096
+	flushdb := ethdb.NewMemDatabase()
+	backend := newTestChtBackend(flushdb, CHTFrequencyServer)
+	backend.diskdb, backend.memoryLimit = db, limit
+	backend.Reset(0, common.Hash{})
+	for i, header := range headers {
+		backend.Process(header)
+		if backend.pendingSize > limit {
+			t.Fatalf("block %d: pending size above limit: have %d, limit %d", i, backend.pendingSize, limit)
+		}
+	}
+	if flushdb.Len() == 0 {
+		t.Fatalf("no trie nodes flushed")
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+	if have := GetChtRoot(db, 0, headers[len(headers)-1].Hash()); have != want {
+		t.Fatalf("root mismatch with memory limit: have %x, want %x", have, want)
+	}
+}
+
+func TestComputeHelperTrieKey(t *testing.T) {
+	tests := []struct {
+		bit     uint
+		section uint64
+		want    [10]byte
+	}{
+		{0, 0, [10]byte{}},
+		{255, math.MaxUint64, [10]byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{2047, 1, [10]byte{0x07, 0xff, 0, 0, 0, 0, 0, 0, 0, 0x01}},
+	}
+	for _, tt := range tests {
+		if have := ComputeHelperTrieKey(tt.bit, tt.section); have != tt.want {
+			t.Errorf("bit %d, section %d: have %x, want %x", tt.bit, tt.section, have, tt.want)
+		}
+	}
+}
+
+func TestChtIsFullyProcessed(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	if backend.IsFullyProcessed(0) {
+		t.Fatalf("section reported processed before commit")
+	}
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	if !backend.IsFullyProcessed(0) {
+		t.Errorf("committed section not reported processed")
+	}
+	if backend.IsFullyProcessed(1) || backend.IsFullyProcessed(2) {
+		t.Errorf("uncommitted section reported processed")
+	}
+}
+
+func TestBloomTrieResetToSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var sections [][]*types.Header
+	for i := uint64(0); i < 2; i++ {
+		heads := makeTestBloomSection(db, i, ethBloomBitsSection)
+		last := heads[len(heads)-1]
+		rawdb.WriteCanonicalHash(db, last.Hash(), last.Number.Uint64())
+		sections = append(sections, heads)
+	}
+	head0, head1 := sections[0][len(sections[0])-1].Hash(), sections[1][len(sections[1])-1].Hash()
+	processBloomTrieSection(t, backend, 0, common.Hash{}, sections[0])
+	nodes0 := db.Len()
+	processBloomTrieSection(t, backend, 1, head0, sections[1])
+	want := GetBloomTrieRoot(db, 1, head1)
+
+	if err := backend.ResetToSection(0); err != errBloomTrieNotLatest {
+		t.Fatalf("reset of older section: have %v, want %v", err, errBloomTrieNotLatest)
+	}
+	if err := backend.ResetToSection(1); err != nil {
+		t.Fatalf("failed to reset section: %v", err)
+	}
+	if root := GetBloomTrieRoot(db, 1, head1); root != (common.Hash{}) {
+		t.Fatalf("section root not removed: %x", root)
+	}
+	if n := db.Len(); n != nodes0 {
+		t.Fatalf("database entry count mismatch after reset: have %d, want %d", n, nodes0)
+	}
+	if _, err := BloomTrieLookup(db, 1, 0, head0); err != nil {
+		t.Fatalf("previous section damaged by reset: %v", err)
+	}
+	// Rebuild the removed section and compare with the original
+	for _, head := range sections[1] {
+		backend.Process(head)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to rebuild section: %v", err)
+	}
+	if have := GetBloomTrieRoot(db, 1, head1); have != want {
+		t.Fatalf("rebuilt root mismatch: have %x, want %x", have, want)
+	}
+}
+
+func TestDeleteChtSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	head0, head1 := headers[CHTFrequencyServer-1].Hash(), headers[2*CHTFrequencyServer-1].Hash()
+
+	processChtSection(t, backend, headers, 0, common.Hash{})
+	entries0 := db.Len()
+	processChtSection(t, backend, headers, 1, head0)
+
+	if err := DeleteChtSection(db, 0, head0); err != errChtNotLatest {
+		t.Fatalf("deletion of older section: have %v, want %v", err, errChtNotLatest)
+	}
+	if err := DeleteChtSection(db, 1, head1); err != nil {
+		t.Fatalf("failed to delete section: %v", err)
+	}
+	if root := GetChtRoot(db, 1, head1); root != (common.Hash{}) {
+		t.Fatalf("section root not removed: %x", root)
+	}
+	if n := db.Len(); n != entries0 {
+		t.Fatalf("database entry count mismatch after deletion: have %d, want %d", n, entries0)
+	}
+	if err := DeleteChtSection(db, 1, head1); err != ErrNoTrustedCht {
+		t.Fatalf("repeated deletion: have %v, want %v", err, ErrNoTrustedCht)
+	}
+	// The previous section must be intact and deletable in turn
+	if mismatches, err := backend.VerifyAgainstChain(dbHeaderReader{db}, 0, head0, 64); err != nil || mismatches != 0 {
+		t.Fatalf("previous section damaged by deletion: %d mismatches, err %v", mismatches, err)
+	}
+	if err := DeleteChtSection(db, 0, head0); err != nil {
+		t.Fatalf("failed to delete first section: %v", err)
+	}
+	if root := GetChtRoot(db, 0, head0); root != (common.Hash{}) {
+		t.Fatalf("first section root not removed: %x", root)
+	}
+}
+
+func TestDeleteBloomTrieSection(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var sections [][]*types.Header
+	for i := uint64(0); i < 2; i++ {
+		heads := makeTestBloomSection(db, i, ethBloomBitsSection)
+		last := heads[len(heads)-1]
+		rawdb.WriteCanonicalHash(db, last.Hash(), last.Number.Uint64())
+		sections = append(sections, heads)
+	}
+	head0, head1 := sections[0][len(sections[0])-1].Hash(), sections[1][len(sections[1])-1].Hash()
+	processBloomTrieSection(t, backend, 0, common.Hash{}, sections[0])
+	entries0 := db.Len()
+	processBloomTrieSection(t, backend, 1, head0, sections[1])
+
+	if err := DeleteBloomTrieSection(db, 0, head0); err != errBloomTrieNotLatest {
+		t.Fatalf("deletion of older section: have %v, want %v", err, errBloomTrieNotLatest)
+	}
+	if err := DeleteBloomTrieSection(db, 1, head1); err != nil {
+		t.Fatalf("failed to delete section: %v", err)
+	}
+	if root := GetBloomTrieRoot(db, 1, head1); root != (common.Hash{}) {
+		t.Fatalf("section root not removed: %x", root)
+	}
+	if n := db.Len(); n != entries0 {
+		t.Fatalf("database entry count mismatch after deletion: have %d, want %d", n, entries0)
+	}
+	if err := DeleteBloomTrieSection(db, 1, head1); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("repeated deletion: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+	if _, err := BloomTrieLookup(db, 1, 0, head0); err != nil {
+		t.Fatalf("previous section damaged by deletion: %v", err)
+	}
+}
+
+func TestChtSectionCount(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 3*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 3; section++ {
+		if n, err := ChtSectionCount(db); err != nil || n != section {
+			t.Fatalf("section count mismatch: have %d/%v, want %d/nil", n, err, section)
+		}
+		processChtSection(t, backend, headers, section, lastHead)
+		lastHead = headers[(section+1)*CHTFrequencyServer-1].Hash()
+	}
+	// Roots of a section stored under different heads are counted once
+	StoreChtRoot(db, 2, common.HexToHash("0x01"), common.HexToHash("0x02"))
+	if n, err := ChtSectionCount(db); err != nil || n != 3 {
+		t.Fatalf("section count mismatch: have %d/%v, want 3/nil", n, err)
+	}
+}
+
+func TestBloomTrieSectionCount(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < 2; section++ {
+		if n, err := BloomTrieSectionCount(db); err != nil || n != section {
+			t.Fatalf("section count mismatch: have %d/%v, want %d/nil", n, err, section)
+		}
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+	}
+	if n, err := BloomTrieSectionCount(db); err != nil || n != 2 {
+		t.Fatalf("section count mismatch: have %d/%v, want 2/nil", n, err)
+	}
+}
+
+func TestBloomTrieSectionProgress(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+
+	backend.Reset(0, common.Hash{})
+	if progress := backend.CurrentSectionProgress(); progress != 0 {
+		t.Fatalf("progress before processing: have %v, want 0", progress)
+	}
+	for _, head := range heads[:len(heads)/2] {
+		backend.Process(head)
+	}
+	if progress := backend.CurrentSectionProgress(); progress != 0.5 {
+		t.Fatalf("progress mismatch: have %v, want 0.5", progress)
+	}
+	for _, head := range heads[len(heads)/2:] {
+		backend.Process(head)
+	}
+	if progress := backend.CurrentSectionProgress(); progress != 1 {
+		t.Fatalf("progress mismatch: have %v, want 1", progress)
+	}
+	// Resetting must start the next section from scratch
+	backend.Reset(1, heads[len(heads)-1].Hash())
+	if progress := backend.CurrentSectionProgress(); progress != 0 {
+		t.Fatalf("progress after reset: have %v, want 0", progress)
+	}
+}
+
+func TestBloomTrieIncompleteSectionHeads(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+
+	backend.Reset(0, common.Hash{})
+	for _, head := range heads[1:] {
+		backend.Process(head)
+	}
+	if n, want := backend.NumParentSectionsProcessed(), uint64(len(heads)-1); n != want {
+		t.Fatalf("processed parent section count mismatch: have %d, want %d", n, want)
+	}
+	if err := backend.Commit(); err != ErrIncompleteSectionHeads {
+		t.Fatalf("incomplete section: have %v, want %v", err, ErrIncompleteSectionHeads)
+	}
+	backend.Process(heads[0])
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("complete section rejected: %v", err)
+	}
+}
+
+// Tests that GetChtV2Root finds the root of a LES/2 section among the roots of
+// LES/1 sized sections, and that it matches a CHT built with LES/2 sections.
+func TestChtRootConsistency(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyClient)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	var lastHead common.Hash
+	for section := uint64(0); section < CHTFrequencyClient/CHTFrequencyServer; section++ {
+		processChtSection(t, backend, headers, section, lastHead)
+		lastHead = headers[(section+1)*CHTFrequencyServer-1].Hash()
+	}
+	root := GetChtV2Root(db, 0, lastHead)
+	if root == (common.Hash{}) {
+		t.Fatalf("no LES/2 root found")
+	}
+	if want := GetChtRoot(db, CHTFrequencyClient/CHTFrequencyServer-1, lastHead); root != want {
+		t.Fatalf("root mismatch: have %x, want %x", root, want)
+	}
+	clientDb := ethdb.NewMemDatabase()
+	processChtSection(t, newTestChtBackend(clientDb, CHTFrequencyClient), makeTestHeaderChain(clientDb, CHTFrequencyClient), 0, common.Hash{})
+	if want := GetChtRoot(clientDb, 0, lastHead); root != want {
+		t.Fatalf("LES/2 sized CHT root mismatch: have %x, want %x", root, want)
+	}
+}
+
+func TestChtTrieRoot(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	if _, err := backend.TrieRoot(); err != errChtNoSection {
+		t.Fatalf("root before reset: have %v, want %v", err, errChtNoSection)
+	}
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	entries := db.Len()
+	root, err := backend.TrieRoot()
+	if err != nil {
+		t.Fatalf("failed to compute root: %v", err)
+	}
+	if n := db.Len(); n != entries {
+		t.Fatalf("root computation wrote to database: have %d entries, want %d", n, entries)
+	}
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+	if want := GetChtRoot(db, 0, headers[len(headers)-1].Hash()); root != want {
+		t.Fatalf("root mismatch: have %x, want %x", root, want)
+	}
+}
+
+func TestChtResetRetry(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+
+	// A single transient failure must be retried transparently
+	failures := 1
+	backend.newTrie = func(root common.Hash, db *trie.Database) (*trie.Trie, error) {
+		if failures > 0 {
+			failures--
+			return nil, errors.New("transient failure")
+		}
+		return trie.New(root, db)
+	}
+	if err := backend.Reset(1, headers[CHTFrequencyServer-1].Hash()); err != nil {
+		t.Fatalf("transient failure not retried: %v", err)
+	}
+	// Persistent failures must be reported after exhausting all attempts
+	failures = chtResetAttempts
+	if err := backend.Reset(1, headers[CHTFrequencyServer-1].Hash()); err == nil {
+		t.Fatalf("persistent failure not reported")
+	}
+	if failures != 0 {
+		t.Fatalf("attempt count mismatch: %d attempts left", failures)
+	}
+}
+
+func TestChtProcessAfterFailedReset(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.newTrie = func(root common.Hash, db *trie.Database) (*trie.Trie, error) {
+		return nil, errors.New("permanent failure")
+	}
+	if err := backend.Reset(0, common.Hash{}); err == nil {
+		t.Fatalf("failed reset not reported")
+	}
+	// Processing must not panic and the section must not be committed
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	if err := backend.LastError(); err != ErrTrieNotInitialized {
+		t.Fatalf("last error mismatch: have %v, want %v", err, ErrTrieNotInitialized)
+	}
+	if n := backend.NumErrors(); n != CHTFrequencyServer {
+		t.Fatalf("skipped block count mismatch: have %d, want %d", n, CHTFrequencyServer)
+	}
+	if err := backend.Commit(); err == nil {
+		t.Fatalf("section committed without trie")
+	}
+}
+
+func TestBloomTrieCommitAfterFailedReset(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	// Point the previous section to a missing root, failing the reset
+	prevHead := common.Hash{0x01}
+	StoreBloomTrieRoot(db, 0, prevHead, common.Hash{0x02})
+	if err := backend.Reset(1, prevHead); err == nil {
+		t.Fatalf("failed reset not reported")
+	}
+	for _, head := range makeTestBloomSection(db, 1, ethBloomBitsSection) {
+		backend.Process(head)
+	}
+	if err := backend.Commit(); err != ErrTrieNotInitialized {
+		t.Fatalf("commit error mismatch: have %v, want %v", err, ErrTrieNotInitialized)
+	}
+}
+
+// slowPutDatabase is a memory database whose Put blocks until release is closed.
+type slowPutDatabase struct {
+	*ethdb.MemDatabase
+	release chan struct{}
+}
+
+func (db *slowPutDatabase) Put(key []byte, value []byte) error {
+	<-db.release
+	return db.MemDatabase.Put(key, value)
+}
+
+func TestChtCommitWithTimeout(t *testing.T) {
+	memdb := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(memdb, 2*CHTFrequencyServer)
+
+	db := &slowPutDatabase{MemDatabase: memdb, release: make(chan struct{})}
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	// A commit stalled on the database must be given up on once the context expires
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:CHTFrequencyServer] {
+		backend.Process(header)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := backend.CommitWithTimeout(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("stalled commit error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+	// Once the database is responsive, commits must complete within the deadline
+	// A fresh backend is used, the given up commit may still be running on the old one
+	close(db.release)
+	backend = newTestChtBackend(db, CHTFrequencyServer)
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:CHTFrequencyServer] {
+		backend.Process(header)
+	}
+	if err := backend.CommitWithTimeout(context.Background()); err != nil {
+		t.Fatalf("failed to commit section: %v", err)
+	}
+	if GetChtRoot(db, 0, headers[CHTFrequencyServer-1].Hash()) == (common.Hash{}) {
+		t.Fatalf("CHT root not stored")
+	}
+}
+
+func TestChtRootVersion(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	head, root := common.Hash{1}, common.Hash{2}
+
+	StoreChtRoot(db, 3, head, root)
+	if have, version := GetChtRootVersion(db, 3, head); have != root || version != ChtVersion {
+		t.Errorf("versioned root mismatch: have %x/%d, want %x/%d", have, version, root, ChtVersion)
+	}
+	// Roots written before versioning must still be readable
+	var encNumber [8]byte
+	binary.BigEndian.PutUint64(encNumber[:], 4)
+	db.Put(append(append(append([]byte{}, chtPrefix...), encNumber[:]...), head.Bytes()...), root.Bytes())
+	if have, version := GetChtRootVersion(db, 4, head); have != root || version != 0 {
+		t.Errorf("legacy root mismatch: have %x/%d, want %x/0", have, version, root)
+	}
+	if have := GetChtRoot(db, 4, head); have != root {
+		t.Errorf("legacy root mismatch: have %x, want %x", have, root)
+	}
+}
+
+func TestDecodeChtNode(t *testing.T) {
+	want := ChtNode{Hash: common.Hash{1}, Td: big.NewInt(100)}
+	data, _ := rlp.EncodeToBytes(want)
+	for _, version := range []byte{0, ChtVersion} {
+		have, err := DecodeChtNode(version, data)
+		if err != nil || !have.Equal(want) {
+			t.Errorf("version %d: have %v/%v, want %v/nil", version, have, err, want)
+		}
+	}
+	if _, err := DecodeChtNode(ChtVersion+1, data); err != errUnknownChtVersion {
+		t.Errorf("unknown version: have %v, want %v", err, errUnknownChtVersion)
+	}
+}
+
+func TestBloomTrieSanityCheck(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	if err := backend.SanityCheck(); err == nil {
+		t.Fatalf("unopened trie accepted")
+	}
+	if err := backend.Reset(0, common.Hash{}); err != nil {
+		t.Fatalf("consistent state rejected: %v", err)
+	}
+	backend.sectionHeads = backend.sectionHeads[:1]
+	if err := backend.Reset(0, common.Hash{}); err == nil {
+		t.Errorf("section head count mismatch accepted")
+	}
+	backend = newTestBloomTrieBackend(db, ethBloomBitsSection)
+	backend.bloomTrieRatio = 1
+	if err := backend.Reset(0, common.Hash{}); err == nil {
+		t.Errorf("bloom trie ratio mismatch accepted")
+	}
+	backend = newTestBloomTrieBackend(db, ethBloomBitsSection)
+	backend.parentSectionSize = 3000
+	if err := backend.Reset(0, common.Hash{}); err == nil {
+		t.Errorf("invalid parent section size accepted")
+	}
+}
+
+func TestChtProcessMetrics(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	// Drop the total difficulty of a block, which must be counted and skipped
+	missing := headers[10]
+	rawdb.DeleteTd(db, missing.Hash(), missing.Number.Uint64())
+
+	for _, name := range []string{"light/cht/process/blocks", "light/cht/process/nilTd", "light/cht/process/encodingErrors"} {
+		if metrics.DefaultRegistry.Get(name) == nil {
+			t.Errorf("metric %s not registered", name)
+		}
+	}
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	metrics := backend.Metrics()
+	if metrics.BlocksProcessed != CHTFrequencyServer-1 || metrics.NilTdCount != 1 || metrics.EncodingErrors != 0 {
+		t.Fatalf("metrics mismatch: have %+v", metrics)
+	}
+	if err := backend.Commit(); err == nil {
+		t.Fatalf("section with skipped block committed")
+	}
+}
+
+func TestChtNumErrors(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 100)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	for i := 10; i < 100; i += 20 {
+		rawdb.DeleteTd(db, headers[i].Hash(), uint64(i))
+	}
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers {
+		backend.Process(header)
+	}
+	if n := backend.NumErrors(); n != 5 {
+		t.Fatalf("error count mismatch: have %d, want 5", n)
+	}
+	backend.Reset(0, common.Hash{})
+	if n := backend.NumErrors(); n != 0 {
+		t.Fatalf("error count not reset: have %d", n)
+	}
+}
+
+func TestChtLastError(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 100)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:50] {
+		backend.Process(header)
+	}
+	if err := backend.LastError(); err != nil {
+		t.Fatalf("error reported without skipped blocks: %v", err)
+	}
+	rawdb.DeleteTd(db, headers[50].Hash(), 50)
+	for _, header := range headers[50:] {
+		backend.Process(header)
+	}
+	if err := backend.LastError(); err == nil {
+		t.Fatalf("skipped block not reported")
+	}
+	backend.Reset(0, common.Hash{})
+	if err := backend.LastError(); err != nil {
+		t.Fatalf("error not reset: %v", err)
+	}
+}
+
+func TestKeyspaceDuplication(t *testing.T) {
+	prefixes := map[string][]byte{
+		"chtPrefix":                  chtPrefix,
+		"chtReversePrefix":           chtReversePrefix,
+		"chtReverseHeadKey":          chtReverseHeadKey,
+		"chtPatchPrefix":             chtPatchPrefix,
+		"bloomTriePrefix":            bloomTriePrefix,
+		"bloomTriePatchPrefix":       bloomTriePatchPrefix,
+		"signedCheckpointPrefix":     signedCheckpointPrefix,
+		"checkpointPrefix":           checkpointPrefix,
+		"chtRootHistoryPrefix":       chtRootHistoryPrefix,
+		"bloomTrieRootHistoryPrefix": bloomTrieRootHistoryPrefix,
+		"chtSizePrefix":              chtSizePrefix,
+		"bloomTrieSizePrefix":        bloomTrieSizePrefix,
+		"ChtTablePrefix":             []byte(ChtTablePrefix),
+		"ChtReverseTablePrefix":      []byte(ChtReverseTablePrefix),
+		"BloomTrieTablePrefix":       []byte(BloomTrieTablePrefix),
+		"chtIndexTablePrefix":        []byte(chtIndexTablePrefix),
+		"bloomTrieIndexTablePrefix":  []byte(bloomTrieIndexTablePrefix),
+	}
+	for name1, prefix1 := range prefixes {
+		for name2, prefix2 := range prefixes {
+			if name1 != name2 && bytes.HasPrefix(prefix2, prefix1) {
+				t.Errorf("%s (%q) is a prefix of %s (%q)", name1, prefix1, name2, prefix2)
+			}
+		}
+	}
+}
+
+func TestChtKeyEncoderRoundtrip(t *testing.T) {
+	tests := []struct {
+		section uint64
+		head    common.Hash
+	}{
+		{0, common.Hash{}},
+		{1, common.HexToHash("0x01")},
+		{12345, common.HexToHash("0xdeadbeef")},
+		{math.MaxUint64, common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")},
+	}
+	for i, tt := range tests {
+		key := DefaultChtKeyEncoder.Encode(tt.section, tt.head)
+		if !bytes.HasPrefix(key, chtPrefix) {
+			t.Errorf("test %d: key %x missing CHT prefix", i, key)
+		}
+		section, head, err := DefaultChtKeyEncoder.Decode(key)
+		if err != nil {
+			t.Errorf("test %d: failed to decode key %x: %v", i, key, err)
+			continue
+		}
+		if section != tt.section || head != tt.head {
+			t.Errorf("test %d: roundtrip mismatch: have %d/%x, want %d/%x", i, section, head, tt.section, tt.head)
+		}
+	}
+	if _, _, err := DefaultChtKeyEncoder.Decode(bloomTrieKeyEncoder.Encode(1, common.Hash{})); err != errInvalidSectionKey {
+		t.Errorf("foreign prefix: have %v, want %v", err, errInvalidSectionKey)
+	}
+	if _, _, err := DefaultChtKeyEncoder.Decode(chtPrefix); err != errInvalidSectionKey {
+		t.Errorf("short key: have %v, want %v", err, errInvalidSectionKey)
+	}
+	if key := ComputeChtKey(0x0102030405060708); !bytes.Equal(key[:], []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+		t.Errorf("CHT entry key mismatch: have %x, want 0102030405060708", key)
+	}
+}
+
+func TestChtSectionSizeBytes(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	if size := backend.SectionSizeBytes(); size != CHTFrequencyServer*chtBytesPerBlock {
+		t.Fatalf("default estimate mismatch: have %d, want %d", size, CHTFrequencyServer*chtBytesPerBlock)
+	}
+	processChtSection(t, backend, headers, 0, common.Hash{})
+
+	stored, err := DatabaseInspector{}.InspectChtTableSize(db)
+	if err != nil {
+		t.Fatalf("failed to inspect CHT table: %v", err)
+	}
+	if size := backend.SectionSizeBytes(); size < stored/2 || size > 2*stored {
+		t.Fatalf("estimate off: have %d, stored %d", size, stored)
+	}
+}
+
+func TestVerifyBloomTrieChain(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	var heads []common.Hash
+	for section := uint64(0); section < 3; section++ {
+		var last common.Hash
+		if section > 0 {
+			last = heads[section-1]
+		}
+		sectionHeads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, last, sectionHeads)
+		heads = append(heads, sectionHeads[len(sectionHeads)-1].Hash())
+	}
+	if err := VerifyBloomTrieChain(db, 0, 2, heads); err != nil {
+		t.Fatalf("valid chain rejected: %v", err)
+	}
+	if err := VerifyBloomTrieChain(db, 1, 2, heads[1:]); err != nil {
+		t.Fatalf("valid partial chain rejected: %v", err)
+	}
+	// Store a last section which changed a bit vector of its predecessor
+	triedb := trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix))
+	tr, err := trie.New(GetBloomTrieRoot(db, 2, heads[2]), triedb)
+	if err != nil {
+		t.Fatalf("failed to open bloom trie: %v", err)
+	}
+	key := ComputeHelperTrieKey(5, 1)
+	original := tr.Get(key[:])
+	tampered := []byte{0x01, 0x02, 0x03}
+	tr.Update(key[:], tampered)
+	root, _ := tr.Commit(nil)
+	triedb.Commit(root, false)
+
+	fork := common.Hash{0xff}
+	StoreBloomTrieRoot(db, 2, fork, root)
+	err = VerifyBloomTrieChain(db, 0, 2, []common.Hash{heads[0], heads[1], fork})
+	cerr, ok := err.(*BloomTrieContinuityError)
+	if !ok || cerr.Section != 2 || cerr.BitIdx != 5 {
+		t.Fatalf("broken chain: have %v, want continuity error at section 2, bit 5", err)
+	}
+	if !bytes.Equal(cerr.Expected, original) || !bytes.Equal(cerr.Actual, tampered) {
+		t.Fatalf("bloom bits mismatch: have expected %x, actual %x, want %x, %x", cerr.Expected, cerr.Actual, original, tampered)
+	}
+	// A missing root must be reported too
+	if err := VerifyBloomTrieChain(db, 3, 3, []common.Hash{{0x01}}); err == nil {
+		t.Fatalf("missing section accepted")
+	}
+}
+
+func TestChtShrinkTrie(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, 2*CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	if err := backend.ShrinkTrie(); err != errChtNoSection {
+		t.Fatalf("shrink without section: have %v, want %v", err, errChtNoSection)
+	}
+	// A large section is shrunk automatically by Commit
+	backend.Reset(0, common.Hash{})
+	for _, header := range headers[:CHTFrequencyServer] {
+		backend.Process(header)
+	}
+	if dirty := backend.DirtyNodeCount(); dirty <= chtShrinkThreshold {
+		t.Fatalf("section too small to trigger shrinking: %d dirty nodes", dirty)
+	}
+	old := backend.trie
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if backend.trie == old {
+		t.Fatalf("trie not shrunk after commit")
+	}
+	head := headers[CHTFrequencyServer-1].Hash()
+	if have, want := backend.trie.Hash(), GetChtRoot(db, 0, head); have != want {
+		t.Fatalf("shrunk trie root mismatch: have %x, want %x", have, want)
+	}
+	if n := backend.ProcessedBlocks(); n != CHTFrequencyServer {
+		t.Fatalf("processed blocks changed by shrinking: have %d, want %d", n, CHTFrequencyServer)
+	}
+	// Uncommitted changes must not be dropped
+	backend.Reset(1, head)
+	backend.Process(headers[CHTFrequencyServer])
+	if err := backend.ShrinkTrie(); err != errTrieDirty {
+		t.Fatalf("shrink with dirty trie: have %v, want %v", err, errTrieDirty)
+	}
+}
+
+func BenchmarkChtShrinkTrie(b *testing.B) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+
+	var released int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Commit the section by hand to get at the trie before shrinking
+		b.StopTimer()
+		backend.Reset(0, common.Hash{})
+		for _, header := range headers {
+			backend.Process(header)
+		}
+		root, err := backend.trie.Commit(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		backend.triedb.Commit(root, false)
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+
+		if err := backend.ShrinkTrie(); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		released += int64(before.HeapAlloc) - int64(after.HeapAlloc)
+		b.StartTimer()
+	}
+	b.Logf("released %d heap bytes per shrink", released/int64(b.N))
+}
+
+func TestBloomTrieShrinkTrie(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+
+	if err := backend.ShrinkTrie(); err != ErrTrieNotInitialized {
+		t.Fatalf("shrink without section: have %v, want %v", err, ErrTrieNotInitialized)
+	}
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	backend.Reset(0, common.Hash{})
+	for _, head := range heads {
+		backend.Process(head)
+	}
+	old := backend.trie
+	if err := backend.Commit(); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if backend.trie == old {
+		t.Fatalf("trie not shrunk after commit")
+	}
+	head := heads[len(heads)-1].Hash()
+	if have, want := backend.trie.Hash(), GetBloomTrieRoot(db, 0, head); have != want {
+		t.Fatalf("shrunk trie root mismatch: have %x, want %x", have, want)
+	}
+	// Uncommitted changes must not be dropped
+	key := ComputeHelperTrieKey(0, 1)
+	backend.trie.Update(key[:], []byte{1})
+	if err := backend.ShrinkTrie(); err != errTrieDirty {
+		t.Fatalf("shrink with dirty trie: have %v, want %v", err, errTrieDirty)
+	}
+}
+
+func BenchmarkBloomTrieShrinkTrie(b *testing.B) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	hashes := make([]common.Hash, len(heads))
+	for i, head := range heads {
+		hashes[i] = head.Hash()
+	}
+	var released int64
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Commit the section by hand to get at the trie before shrinking
+		b.StopTimer()
+		backend.Reset(0, common.Hash{})
+		if _, _, err := updateBloomTrie(db, backend.trie, 0, ethBloomBitsSection, backend.bloomTrieRatio, hashes); err != nil {
+			b.Fatal(err)
+		}
+		root, err := backend.trie.Commit(nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		backend.triedb.Commit(root, false)
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		b.StartTimer()
+
+		if err := backend.ShrinkTrie(); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		released += int64(before.HeapAlloc) - int64(after.HeapAlloc)
+		b.StartTimer()
+	}
+	b.Logf("released %d heap bytes per shrink", released/int64(b.N))
+}
+
+func TestChtLookupNode(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.nodeCache = NewChtNodeCache(16)
+	processChtSection(t, backend, headers, 0, common.Hash{})
+
+	head := headers[CHTFrequencyServer-1].Hash()
+	for _, num := range []uint64{0, 100, 100, CHTFrequencyServer - 1} {
+		node, err := backend.LookupNode(0, head, num)
+		if err != nil {
+			t.Fatalf("block %d: lookup failed: %v", num, err)
+		}
+		if node.Hash != headers[num].Hash() {
+			t.Fatalf("block %d: hash mismatch: have %x, want %x", num, node.Hash, headers[num].Hash())
+		}
+	}
+	if n := backend.nodeCache.Len(); n != 3 {
+		t.Fatalf("cached entry count mismatch: have %d, want %d", n, 3)
+	}
+	// Entries are not served for a different section head
+	if _, ok := backend.nodeCache.Get(0, 100, common.Hash{1}); ok {
+		t.Fatalf("cached entry served for wrong section head")
+	}
+	if _, err := backend.LookupNode(0, common.Hash{1}, 100); err != ErrNoTrustedCht {
+		t.Fatalf("unknown section head: have %v, want %v", err, ErrNoTrustedCht)
+	}
+}
+
+// benchmarkChtLookupNode measures repeated lookups of the same CHT entry.
+func benchmarkChtLookupNode(b *testing.B, cache *ChtNodeCache) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	backend := newTestChtBackend(db, CHTFrequencyServer)
+	backend.nodeCache = cache
+	processChtSection(b, backend, headers, 0, common.Hash{})
+	head := headers[CHTFrequencyServer-1].Hash()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := backend.LookupNode(0, head, 1234); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkChtLookupNodeUncached(b *testing.B) { benchmarkChtLookupNode(b, nil) }
+func BenchmarkChtLookupNodeCached(b *testing.B)   { benchmarkChtLookupNode(b, NewChtNodeCache(16)) }
+
+func TestBloomTrieLookupBloomBits(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	WithBloomTrieReadCache(types.BloomBitLength)(backend)
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(t, backend, 0, common.Hash{}, heads)
+
+	head := heads[len(heads)-1].Hash()
+	for i := 0; i < 2; i++ {
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			have, err := backend.LookupBloomBits(bit, 0, head)
+			if err != nil {
+				t.Fatalf("bit %d: lookup failed: %v", bit, err)
+			}
+			want, _ := BloomTrieLookup(db, bit, 0, head)
+			if !bytes.Equal(have, want) {
+				t.Fatalf("bit %d: bloom bits mismatch", bit)
+			}
+		}
+	}
+	if n := backend.readCache.Len(); n != types.BloomBitLength {
+		t.Fatalf("cached vector count mismatch: have %d, want %d", n, types.BloomBitLength)
+	}
+	if _, err := backend.LookupBloomBits(0, 0, common.Hash{1}); err != ErrNoTrustedBloomTrie {
+		t.Fatalf("unknown section head: have %v, want %v", err, ErrNoTrustedBloomTrie)
+	}
+}
+
+// benchmarkBloomTrieLookupBloomBits measures a log filter like retrieval of every
+// bloom bit of a committed section, repeated for each iteration.
+func benchmarkBloomTrieLookupBloomBits(b *testing.B, opts ...BloomTrieIndexerOption) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	for _, opt := range opts {
+		opt(backend)
+	}
+	heads := makeTestBloomSection(db, 0, ethBloomBitsSection)
+	processBloomTrieSection(b, backend, 0, common.Hash{}, heads)
+	head := heads[len(heads)-1].Hash()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for bit := uint(0); bit < types.BloomBitLength; bit++ {
+			if _, err := backend.LookupBloomBits(bit, 0, head); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkBloomTrieLookupBloomBitsUncached(b *testing.B) { benchmarkBloomTrieLookupBloomBits(b) }
+func BenchmarkBloomTrieLookupBloomBitsCached(b *testing.B) {
+	benchmarkBloomTrieLookupBloomBits(b, WithBloomTrieReadCache(types.BloomBitLength))
+}
+
+// TestChtIndexerConcurrentResetProcess runs sections through a single backend
+// from several goroutines. Like the chain indexer, the goroutines take turns in
+// driving whole sections through Reset, Process and Commit, while the progress
+// accessors, which are safe for concurrent use, are polled without locking. Run
+// with -race to catch unsynchronized state.
+func TestChtIndexerConcurrentResetProcess(t *testing.T) {
+	const (
+		sectionSize = 64
+		sections    = 16
+		workers     = 4
+	)
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, sectionSize*sections)
+	backend := newTestChtBackend(db, sectionSize)
+
+	var (
+		lock     sync.Mutex
+		next     uint64
+		lastHead common.Hash
+		wg       sync.WaitGroup
+		errc     = make(chan error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				backend.ProcessedBlocks()
+				backend.NumErrors()
+				backend.Metrics()
+				backend.CurrentSectionProgress()
+				backend.SectionSizeBytes()
+
+				lock.Lock()
+				section := next
+				if section == sections {
+					lock.Unlock()
+					return
+				}
+				err := backend.Reset(section, lastHead)
+				for _, header := range headers[section*sectionSize : (section+1)*sectionSize] {
+					if err != nil {
+						break
+					}
+					backend.Process(header)
+				}
+				if err == nil {
+					err = backend.Commit()
+				}
+				next, lastHead = section+1, headers[(section+1)*sectionSize-1].Hash()
+				lock.Unlock()
+
+				if err != nil {
+					errc <- fmt.Errorf("section %d: %v", section, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Fatal(err)
+	}
+	// The result has to match processing the sections sequentially
+	refdb := ethdb.NewMemDatabase()
+	refHeaders := makeTestHeaderChain(refdb, sectionSize*sections)
+	ref := newTestChtBackend(refdb, sectionSize)
+	var refHead common.Hash
+	for section := uint64(0); section < sections; section++ {
+		processChtSection(t, ref, refHeaders, section, refHead)
+		refHead = refHeaders[(section+1)*sectionSize-1].Hash()
+
+		head := headers[(section+1)*sectionSize-1].Hash()
+		if have, want := GetChtRoot(db, section, head), GetChtRoot(refdb, section, refHead); have != want {
+			t.Fatalf("section %d: root mismatch: have %x, want %x", section, have, want)
+		}
+	}
+}
+
+// TestBloomTrieIndexerConcurrentResetProcess is the BloomTrie counterpart of
+// TestChtIndexerConcurrentResetProcess: the goroutines take turns in driving
+// whole sections through the backend while polling the statistics accessors,
+// which are safe for concurrent use, without locking.
+func TestBloomTrieIndexerConcurrentResetProcess(t *testing.T) {
+	const (
+		sections = 4
+		workers  = 4
+	)
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	heads := make([][]*types.Header, sections)
+	for section := range heads {
+		heads[section] = makeTestBloomSection(db, uint64(section), ethBloomBitsSection)
+	}
+	var (
+		lock     sync.Mutex
+		next     uint64
+		lastHead common.Hash
+		wg       sync.WaitGroup
+		errc     = make(chan error, workers)
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				backend.Stats()
+				backend.AllStats()
+				backend.ProjectedDiskUsage()
+				backend.StorageReport()
+
+				lock.Lock()
+				section := next
+				if section == sections {
+					lock.Unlock()
+					return
+				}
+				err := backend.Reset(section, lastHead)
+				if err == nil {
+					for _, head := range heads[section] {
+						backend.Process(head)
+					}
+					err = backend.Commit()
+				}
+				next, lastHead = section+1, heads[section][len(heads[section])-1].Hash()
+				lock.Unlock()
+
+				if err != nil {
+					errc <- fmt.Errorf("section %d: %v", section, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		t.Fatal(err)
+	}
+	if n := len(backend.AllStats()); n != sections {
+		t.Fatalf("committed section count mismatch: have %d, want %d", n, sections)
+	}
+	// The result has to match processing the sections sequentially
+	refdb := ethdb.NewMemDatabase()
+	ref := newTestBloomTrieBackend(refdb, ethBloomBitsSection)
+	var refHead common.Hash
+	for section := uint64(0); section < sections; section++ {
+		refHeads := makeTestBloomSection(refdb, section, ethBloomBitsSection)
+		processBloomTrieSection(t, ref, section, refHead, refHeads)
+		refHead = refHeads[len(refHeads)-1].Hash()
+
+		head := heads[section][len(heads[section])-1].Hash()
+		if have, want := GetBloomTrieRoot(db, section, head), GetBloomTrieRoot(refdb, section, refHead); have != want {
+			t.Fatalf("section %d: root mismatch: have %x, want %x", section, have, want)
+		}
+	}
+}
+
+func TestChtNodePool(t *testing.T) {
+	pool := NewChtNodePool()
+	node := pool.Get()
+	if node.Td == nil {
+		t.Fatalf("pooled node without total difficulty")
+	}
+	node.Hash = common.Hash{1}
+	node.Td.SetUint64(12345)
+	have, err := rlp.EncodeToBytes(node)
+	if err != nil {
+		t.Fatalf("failed to encode pooled node: %v", err)
+	}
+	want, _ := rlp.EncodeToBytes(ChtNode{common.Hash{1}, big.NewInt(12345)})
+	if !bytes.Equal(have, want) {
+		t.Fatalf("encoding mismatch: have %x, want %x", have, want)
+	}
+	pool.Put(node)
+}
+
+// BenchmarkChtProcess measures adding 10000 blocks to a CHT section.
+func BenchmarkChtProcess(b *testing.B) {
+	const blocks = 10000
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, blocks)
+	backend := newTestChtBackend(db, blocks)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		backend.Reset(0, common.Hash{})
+		for _, header := range headers {
+			backend.Process(header)
+		}
+	}
+}
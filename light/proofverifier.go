@@ -0,0 +1,164 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var (
+	ErrNotImplemented  = errors.New("not implemented")
+	ErrChtEntryMissing = errors.New("block not present in CHT proof")
+
+	errChtHashMismatch   = errors.New("CHT hash mismatch")
+	errChtNumberMismatch = errors.New("CHT number mismatch")
+)
+
+// ProofVerifier checks proofs of CHT entries against the root of a CHT section.
+type ProofVerifier interface {
+	// Verify checks that proof proves the CHT entry of the given block under
+	// the given section root.
+	Verify(sectionRoot common.Hash, blockNum uint64, proof []byte) error
+}
+
+// MerkleProofVerifier is a ProofVerifier for Merkle proofs, given as the RLP
+// encoding of the list of trie nodes on the path to the CHT entry.
+type MerkleProofVerifier struct{}
+
+// Verify implements ProofVerifier.
+func (MerkleProofVerifier) Verify(sectionRoot common.Hash, blockNum uint64, proof []byte) error {
+	var nodes NodeList
+	if err := rlp.DecodeBytes(proof, &nodes); err != nil {
+		return fmt.Errorf("invalid CHT proof encoding: %v", err)
+	}
+	encNumber := ComputeChtKey(blockNum)
+	value, _, err := trie.VerifyProof(sectionRoot, encNumber[:], nodes.NodeSet())
+	if err != nil {
+		return fmt.Errorf("CHT proof verification failed: %v", err)
+	}
+	if len(value) == 0 {
+		return ErrChtEntryMissing
+	}
+	_, err = DecodeChtNode(ChtVersion, value)
+	return err
+}
+
+// SNARKProofVerifier is a placeholder for verifying aggregated SNARK proofs of
+// CHT entries. It rejects all proofs until such a proof format is defined.
+type SNARKProofVerifier struct{}
+
+// Verify implements ProofVerifier.
+func (SNARKProofVerifier) Verify(sectionRoot common.Hash, blockNum uint64, proof []byte) error {
+	return ErrNotImplemented
+}
+
+// ErrInvalidChtResponse is returned by ChtResponseValidator for CHT responses that
+// are inconsistent with the local CHT root.
+type ErrInvalidChtResponse struct {
+	Reason error
+}
+
+func (e *ErrInvalidChtResponse) Error() string {
+	return fmt.Sprintf("invalid CHT response: %v", e.Reason)
+}
+
+// ChtResponse is a CHT entry of a block returned by a peer, along with its proof.
+type ChtResponse struct {
+	BlockNum uint64              // Number of the requested block
+	Header   *types.Header       // Header returned for the block
+	Proof    trie.DatabaseReader // Trie nodes proving the CHT entry of the block
+	Td       *big.Int            // Total difficulty proven for the block, set by Validate
+}
+
+// ChtResponseValidator checks CHT responses against the locally stored CHT root.
+type ChtResponseValidator struct{}
+
+// Validate checks that the response proves the CHT entry of the requested block
+// under localRoot and that the entry matches the returned header. On success the
+// proven total difficulty is stored in the response.
+func (ChtResponseValidator) Validate(response *ChtResponse, localRoot common.Hash) error {
+	if response.Header == nil {
+		return &ErrInvalidChtResponse{ErrNoHeader}
+	}
+	encNumber := ComputeChtKey(response.BlockNum)
+	value, _, err := trie.VerifyProof(localRoot, encNumber[:], response.Proof)
+	if err != nil {
+		return &ErrInvalidChtResponse{fmt.Errorf("merkle proof verification failed: %v", err)}
+	}
+	if len(value) == 0 {
+		return &ErrInvalidChtResponse{ErrChtEntryMissing}
+	}
+	node, err := DecodeChtNode(ChtVersion, value)
+	if err != nil {
+		return &ErrInvalidChtResponse{err}
+	}
+	if node.Hash != response.Header.Hash() {
+		return &ErrInvalidChtResponse{errChtHashMismatch}
+	}
+	if response.Header.Number.Uint64() != response.BlockNum {
+		return &ErrInvalidChtResponse{errChtNumberMismatch}
+	}
+	response.Td = node.Td
+	return nil
+}
+
+// ErrInvalidBloomTrieResponse is returned by BloomTrieResponseValidator for bloom
+// bits responses that are inconsistent with the local BloomTrie root.
+type ErrInvalidBloomTrieResponse struct {
+	Reason error
+}
+
+func (e *ErrInvalidBloomTrieResponse) Error() string {
+	return fmt.Sprintf("invalid BloomTrie response: %v", e.Reason)
+}
+
+// BloomResponse is a set of compressed bloom bit vectors returned by a peer, along
+// with their proof.
+type BloomResponse struct {
+	BitIdx         uint                // Index of the requested bloom bit
+	SectionIdxList []uint64            // Sections the bit vectors were requested for
+	Proof          trie.DatabaseReader // Trie nodes proving the bit vectors
+	BloomBits      [][]byte            // Proven bit vectors, one per section, set by Validate
+}
+
+// BloomTrieResponseValidator checks bloom bits responses against the locally
+// stored BloomTrie root.
+type BloomTrieResponseValidator struct{}
+
+// Validate checks that the response proves the bit vectors of all requested
+// sections under localRoot. On success the proven bit vectors are stored in the
+// response.
+func (BloomTrieResponseValidator) Validate(response *BloomResponse, localRoot common.Hash) error {
+	bits := make([][]byte, len(response.SectionIdxList))
+	for i, section := range response.SectionIdxList {
+		key := ComputeHelperTrieKey(response.BitIdx, section)
+		value, _, err := trie.VerifyProof(localRoot, key[:], response.Proof)
+		if err != nil {
+			return &ErrInvalidBloomTrieResponse{fmt.Errorf("merkle proof verification failed for section %d: %v", section, err)}
+		}
+		bits[i] = value
+	}
+	response.BloomBits = bits
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/rawdb"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+func TestMerkleProofVerifier(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+	root := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	nodes, err := proveChtEntry(db, root, 42)
+	if err != nil {
+		t.Fatalf("failed to create proof: %v", err)
+	}
+	var list NodeList
+	for _, node := range nodes {
+		list = append(list, node)
+	}
+	proof, _ := rlp.EncodeToBytes(list)
+
+	var verifier ProofVerifier = MerkleProofVerifier{}
+	if err := verifier.Verify(root, 42, proof); err != nil {
+		t.Errorf("valid proof rejected: %v", err)
+	}
+	if err := verifier.Verify(root, 43, proof); err == nil {
+		t.Errorf("proof accepted for wrong block")
+	}
+	if err := verifier.Verify(common.Hash{1}, 42, proof); err == nil {
+		t.Errorf("proof accepted for wrong root")
+	}
+	if err := (SNARKProofVerifier{}).Verify(root, 42, proof); err != ErrNotImplemented {
+		t.Errorf("SNARK verifier: have %v, want %v", err, ErrNotImplemented)
+	}
+}
+
+func TestChtResponseValidator(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	headers := makeTestHeaderChain(db, CHTFrequencyServer)
+	processChtSection(t, newTestChtBackend(db, CHTFrequencyServer), headers, 0, common.Hash{})
+	root := GetChtRoot(db, 0, headers[len(headers)-1].Hash())
+
+	nodes, err := proveChtEntry(db, root, 42)
+	if err != nil {
+		t.Fatalf("failed to create proof: %v", err)
+	}
+	response := func(header uint64, nodes [][]byte) *ChtResponse {
+		var list NodeList
+		for _, node := range nodes {
+			list = append(list, node)
+		}
+		return &ChtResponse{BlockNum: 42, Header: headers[header], Proof: list.NodeSet()}
+	}
+	validator := ChtResponseValidator{}
+
+	valid := response(42, nodes)
+	if err := validator.Validate(valid, root); err != nil {
+		t.Fatalf("valid response rejected: %v", err)
+	}
+	if td := rawdb.ReadTd(db, headers[42].Hash(), 42); valid.Td == nil || valid.Td.Cmp(td) != 0 {
+		t.Errorf("proven TD mismatch: have %v, want %v", valid.Td, td)
+	}
+	// Flip a byte in the last proof node, which no longer hashes to its reference
+	corrupt := make([][]byte, len(nodes))
+	copy(corrupt, nodes)
+	last := common.CopyBytes(nodes[len(nodes)-1])
+	last[len(last)-1] ^= 0xff
+	corrupt[len(corrupt)-1] = last
+
+	invalid := []struct {
+		name     string
+		response *ChtResponse
+		root     common.Hash
+	}{
+		{"corrupted proof", response(42, corrupt), root},
+		{"wrong header", response(43, nodes), root},
+		{"wrong root", response(42, nodes), common.Hash{1}},
+		{"missing header", &ChtResponse{BlockNum: 42, Proof: valid.Proof}, root},
+	}
+	for _, tt := range invalid {
+		err := validator.Validate(tt.response, tt.root)
+		if _, ok := err.(*ErrInvalidChtResponse); !ok {
+			t.Errorf("%s: have %v, want *ErrInvalidChtResponse", tt.name, err)
+		}
+	}
+}
+
+func TestBloomTrieResponseValidator(t *testing.T) {
+	db := ethdb.NewMemDatabase()
+	backend := newTestBloomTrieBackend(db, ethBloomBitsSection)
+	var lastHead common.Hash
+	for section := uint64(0); section < 2; section++ {
+		heads := makeTestBloomSection(db, section, ethBloomBitsSection)
+		processBloomTrieSection(t, backend, section, lastHead, heads)
+		lastHead = heads[len(heads)-1].Hash()
+	}
+	root := GetBloomTrieRoot(db, 1, lastHead)
+	tr, err := trie.New(root, trie.NewDatabase(ethdb.NewTable(db, BloomTrieTablePrefix)))
+	if err != nil {
+		t.Fatalf("failed to open bloom trie: %v", err)
+	}
+	// Prove bit 3 of both sections within a single node list
+	var (
+		sections = []uint64{0, 1}
+		proof    NodeList
+		want     [][]byte
+	)
+	for _, section := range sections {
+		key := ComputeHelperTrieKey(3, section)
+		if err := tr.Prove(key[:], 0, &proof); err != nil {
+			t.Fatalf("section %d: failed to create proof: %v", section, err)
+		}
+		want = append(want, tr.Get(key[:]))
+	}
+	validator := BloomTrieResponseValidator{}
+
+	valid := &BloomResponse{BitIdx: 3, SectionIdxList: sections, Proof: proof.NodeSet()}
+	if err := validator.Validate(valid, root); err != nil {
+		t.Fatalf("valid response rejected: %v", err)
+	}
+	for i := range sections {
+		if !bytes.Equal(valid.BloomBits[i], want[i]) {
+			t.Errorf("section %d: bloom bits mismatch: have %x, want %x", sections[i], valid.BloomBits[i], want[i])
+		}
+	}
+	// Flip a byte in the root node, which no longer hashes to the BloomTrie root.
+	// Both proofs start with the root node, so corrupt all its copies.
+	first := common.CopyBytes(proof[0])
+	first[len(first)-1] ^= 0xff
+	corrupt := make(NodeList, len(proof))
+	for i, node := range proof {
+		if bytes.Equal(node, proof[0]) {
+			node = first
+		}
+		corrupt[i] = node
+	}
+
+	invalid := []struct {
+		name     string
+		response *BloomResponse
+		root     common.Hash
+	}{
+		{"corrupted proof", &BloomResponse{BitIdx: 3, SectionIdxList: sections, Proof: corrupt.NodeSet()}, root},
+		{"wrong bit", &BloomResponse{BitIdx: 4, SectionIdxList: sections, Proof: proof.NodeSet()}, root},
+		{"wrong root", &BloomResponse{BitIdx: 3, SectionIdxList: sections, Proof: proof.NodeSet()}, common.Hash{1}},
+	}
+	for _, tt := range invalid {
+		err := validator.Validate(tt.response, tt.root)
+		if _, ok := err.(*ErrInvalidBloomTrieResponse); !ok {
+			t.Errorf("%s: have %v, want *ErrInvalidBloomTrieResponse", tt.name, err)
+		}
+		if tt.response.BloomBits != nil {
+			t.Errorf("%s: bloom bits set on invalid response", tt.name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core"
+	"github.com/akroma-project/akroma/core/state"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/params"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var (
+	ErrAccountNotProven   = errors.New("sender account not present in state proof")
+	ErrStatelessNonce     = errors.New("transaction nonce does not match proven account nonce")
+	ErrStatelessFunds     = errors.New("proven account balance too low for transaction cost")
+	ErrStatelessGasLimit  = errors.New("transaction gas exceeds header gas limit")
+	ErrStatelessIntrinsic = errors.New("transaction gas below intrinsic gas")
+	errNoHeaderForTxCheck = errors.New("no header to validate against")
+)
+
+// StatelessValidator checks transactions against the state root of a header
+// (typically one obtained through a CHT proof) using a Merkle proof of the
+// accessed accounts instead of a locally available state database.
+type StatelessValidator struct {
+	config *params.ChainConfig
+}
+
+// NewStatelessValidator creates a validator for the given chain configuration.
+func NewStatelessValidator(config *params.ChainConfig) *StatelessValidator {
+	return &StatelessValidator{config: config}
+}
+
+// Validate verifies that tx can be applied on top of the state committed to by
+// header. The stateProof is the list of trie nodes proving the sender account
+// in the state trie of the header.
+func (v *StatelessValidator) Validate(tx *types.Transaction, stateProof [][]byte, header *types.Header) error {
+	_, err := v.ValidateWithStorage(tx, stateProof, header, nil)
+	return err
+}
+
+// ValidateWithStorage verifies tx like Validate and additionally proves the given
+// storage slots of the recipient, which are accessed by its execution. Besides the
+// sender account, stateProof has to contain the trie nodes proving the recipient
+// account and the slots in its storage trie. The proven slot values are returned,
+// slots not present in the storage are reported as zero.
+func (v *StatelessValidator) ValidateWithStorage(tx *types.Transaction, stateProof [][]byte, header *types.Header, slots []common.Hash) (map[common.Hash]common.Hash, error) {
+	if header == nil {
+		return nil, errNoHeaderForTxCheck
+	}
+	if tx.Gas() > header.GasLimit {
+		return nil, ErrStatelessGasLimit
+	}
+	intrinsic, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, v.config.IsHomestead(header.Number))
+	if err != nil {
+		return nil, err
+	}
+	if tx.Gas() < intrinsic {
+		return nil, ErrStatelessIntrinsic
+	}
+	from, err := types.Sender(types.MakeSigner(v.config, header.Number), tx)
+	if err != nil {
+		return nil, err
+	}
+	nodes := proofNodeSet(stateProof)
+
+	account, err := proveAccount(header.Root, from, nodes)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		return nil, ErrAccountNotProven
+	}
+	if account.Nonce != tx.Nonce() {
+		return nil, ErrStatelessNonce
+	}
+	if account.Balance.Cmp(tx.Cost()) < 0 {
+		return nil, ErrStatelessFunds
+	}
+	values := make(map[common.Hash]common.Hash, len(slots))
+	if len(slots) == 0 || tx.To() == nil {
+		// Contracts being created start with empty storage
+		for _, slot := range slots {
+			values[slot] = common.Hash{}
+		}
+		return values, nil
+	}
+	recipient, err := proveAccount(header.Root, *tx.To(), nodes)
+	if err != nil {
+		return nil, err
+	}
+	for _, slot := range slots {
+		values[slot] = common.Hash{}
+		if recipient == nil {
+			continue
+		}
+		enc, _, err := trie.VerifyProof(recipient.Root, crypto.Keccak256(slot[:]), nodes)
+		if err != nil {
+			return nil, fmt.Errorf("storage proof verification failed for slot %x: %v", slot, err)
+		}
+		if len(enc) > 0 {
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				return nil, err
+			}
+			values[slot] = common.BytesToHash(content)
+		}
+	}
+	return values, nil
+}
+
+// proveAccount reads the account of the given address from a state trie proof.
+// A nil account is returned if the proof shows the account does not exist.
+func proveAccount(root common.Hash, addr common.Address, nodes *NodeSet) (*state.Account, error) {
+	value, _, err := trie.VerifyProof(root, crypto.Keccak256(addr[:]), nodes)
+	if err != nil {
+		return nil, fmt.Errorf("state proof verification failed for account %x: %v", addr, err)
+	}
+	if len(value) == 0 {
+		return nil, nil
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(value, account); err != nil {
+		return nil, err
+	}
+	return account, nil
+}
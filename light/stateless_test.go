@@ -0,0 +1,139 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/state"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/crypto"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/params"
+)
+
+func TestStatelessValidator(t *testing.T) {
+	db := state.NewDatabase(ethdb.NewMemDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.SetBalance(testBankAddress, testBankFunds)
+	statedb.SetNonce(testBankAddress, 3)
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	db.TrieDB().Commit(root, false)
+
+	tr, _ := db.OpenTrie(root)
+	var proof NodeList
+	if err := tr.Prove(crypto.Keccak256(testBankAddress[:]), 0, &proof); err != nil {
+		t.Fatalf("failed to prove account: %v", err)
+	}
+	stateProof := make([][]byte, len(proof))
+	for i, node := range proof {
+		stateProof[i] = node
+	}
+	header := &types.Header{Number: big.NewInt(1), Root: root, GasLimit: 1000000}
+	signer := types.MakeSigner(params.TestChainConfig, header.Number)
+	validator := NewStatelessValidator(params.TestChainConfig)
+
+	tests := []struct {
+		nonce uint64
+		value *big.Int
+		gas   uint64
+		err   error
+	}{
+		{3, big.NewInt(1000), 21000, nil},
+		{2, big.NewInt(1000), 21000, ErrStatelessNonce},
+		{3, testBankFunds, 21000, ErrStatelessFunds},
+		{3, big.NewInt(1000), 2000000, ErrStatelessGasLimit},
+		{3, big.NewInt(1000), 20000, ErrStatelessIntrinsic},
+	}
+	for i, tt := range tests {
+		tx, _ := types.SignTx(types.NewTransaction(tt.nonce, common.Address{1}, tt.value, tt.gas, big.NewInt(1), nil), signer, testBankKey)
+		if err := validator.Validate(tx, stateProof, header); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// A proof for a different root must be rejected
+	tx, _ := types.SignTx(types.NewTransaction(3, common.Address{1}, big.NewInt(1000), 21000, big.NewInt(1), nil), signer, testBankKey)
+	if err := validator.Validate(tx, stateProof, &types.Header{Number: big.NewInt(1), Root: common.Hash{1}, GasLimit: 1000000}); err == nil {
+		t.Errorf("proof verified against wrong state root")
+	}
+}
+
+func TestStatelessValidatorStorage(t *testing.T) {
+	var (
+		contract = common.Address{0xcc}
+		slotSet  = common.Hash{1}
+		slotNone = common.Hash{2}
+		value    = common.HexToHash("0x2a")
+	)
+	db := state.NewDatabase(ethdb.NewMemDatabase())
+	statedb, _ := state.New(common.Hash{}, db)
+	statedb.SetBalance(testBankAddress, testBankFunds)
+	statedb.SetCode(contract, []byte{0x00})
+	statedb.SetState(contract, slotSet, value)
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	db.TrieDB().Commit(root, false)
+
+	// Collect the proofs of both accounts and both slots into a single set
+	proof := NewNodeSet()
+	tr, _ := db.OpenTrie(root)
+	for _, addr := range []common.Address{testBankAddress, contract} {
+		if err := tr.Prove(crypto.Keccak256(addr[:]), 0, proof); err != nil {
+			t.Fatalf("failed to prove account %x: %v", addr, err)
+		}
+	}
+	accountProof := proof.NodeList()
+
+	statedb, _ = state.New(root, db)
+	storage := statedb.StorageTrie(contract)
+	for _, slot := range []common.Hash{slotSet, slotNone} {
+		if err := storage.Prove(crypto.Keccak256(slot[:]), 0, proof); err != nil {
+			t.Fatalf("failed to prove slot %x: %v", slot, err)
+		}
+	}
+	stateProof := make([][]byte, proof.KeyCount())
+	for i, node := range proof.NodeList() {
+		stateProof[i] = node
+	}
+	header := &types.Header{Number: big.NewInt(1), Root: root, GasLimit: 1000000}
+	signer := types.MakeSigner(params.TestChainConfig, header.Number)
+	validator := NewStatelessValidator(params.TestChainConfig)
+	tx, _ := types.SignTx(types.NewTransaction(0, contract, big.NewInt(0), 100000, big.NewInt(1), nil), signer, testBankKey)
+
+	values, err := validator.ValidateWithStorage(tx, stateProof, header, []common.Hash{slotSet, slotNone})
+	if err != nil {
+		t.Fatalf("failed to validate transaction: %v", err)
+	}
+	if values[slotSet] != value || values[slotNone] != (common.Hash{}) {
+		t.Errorf("slot values mismatch: have %x", values)
+	}
+	// Slots without proof nodes must be rejected
+	stateProof = make([][]byte, len(accountProof))
+	for i, node := range accountProof {
+		stateProof[i] = node
+	}
+	if _, err := validator.ValidateWithStorage(tx, stateProof, header, []common.Hash{slotSet}); err == nil {
+		t.Errorf("unproven slot accepted")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+var (
+	ErrTxTrieMismatch = errors.New("transaction trie root does not match header")
+	ErrTxNotProven    = errors.New("transaction not present in transaction proof")
+)
+
+// TransactionProver creates and checks Merkle proofs of transactions in the
+// transaction trie of a block. Together with a CHT proof of the header, this
+// proves the contents of a transaction given only a block number.
+type TransactionProver struct{}
+
+// txTrieKey returns the transaction trie key of the transaction at the given index.
+func txTrieKey(txIndex int) []byte {
+	key, _ := rlp.EncodeToBytes(uint(txIndex))
+	return key
+}
+
+// Prove creates a Merkle proof of the transaction at txIndex in the transaction
+// trie of header. The trie must be the one the header commits to.
+func (p *TransactionProver) Prove(header *types.Header, txIndex int, txTrie *trie.Trie) ([][]byte, error) {
+	if txTrie.Hash() != header.TxHash {
+		return nil, ErrTxTrieMismatch
+	}
+	nodes := NewNodeSet()
+	if err := txTrie.Prove(txTrieKey(txIndex), 0, nodes); err != nil {
+		return nil, err
+	}
+	list := nodes.NodeList()
+	proof := make([][]byte, len(list))
+	for i, node := range list {
+		proof[i] = node
+	}
+	return proof, nil
+}
+
+// Verify checks the Merkle proof of the transaction at txIndex against the
+// transaction root of header and returns the proven transaction.
+func (p *TransactionProver) Verify(header *types.Header, txIndex int, proof [][]byte) (*types.Transaction, error) {
+	nodes := make(NodeList, len(proof))
+	for i, node := range proof {
+		nodes[i] = node
+	}
+	value, _, err := trie.VerifyProof(header.TxHash, txTrieKey(txIndex), nodes.NodeSet())
+	if err != nil {
+		return nil, fmt.Errorf("transaction proof verification failed: %v", err)
+	}
+	if len(value) == 0 {
+		return nil, ErrTxNotProven
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(value, tx); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
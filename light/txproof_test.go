@@ -0,0 +1,63 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/core/types"
+	"github.com/akroma-project/akroma/rlp"
+	"github.com/akroma-project/akroma/trie"
+)
+
+func TestTransactionProver(t *testing.T) {
+	var (
+		txs    types.Transactions
+		txTrie = new(trie.Trie)
+	)
+	for i := 0; i < 20; i++ {
+		tx := types.NewTransaction(uint64(i), common.Address{byte(i)}, big.NewInt(int64(i)), 21000, big.NewInt(1), nil)
+		txs = append(txs, tx)
+		key, _ := rlp.EncodeToBytes(uint(i))
+		txTrie.Update(key, txs.GetRlp(i))
+	}
+	header := &types.Header{Number: big.NewInt(1), TxHash: types.DeriveSha(txs)}
+	prover := new(TransactionProver)
+
+	for i, want := range txs {
+		proof, err := prover.Prove(header, i, txTrie)
+		if err != nil {
+			t.Fatalf("tx %d: failed to prove: %v", i, err)
+		}
+		have, err := prover.Verify(header, i, proof)
+		if err != nil {
+			t.Fatalf("tx %d: failed to verify: %v", i, err)
+		}
+		if have.Hash() != want.Hash() {
+			t.Errorf("tx %d: hash mismatch: have %x, want %x", i, have.Hash(), want.Hash())
+		}
+	}
+	proof, _ := prover.Prove(header, 3, txTrie)
+	if _, err := prover.Verify(header, len(txs), proof); err == nil {
+		t.Errorf("proof of missing transaction accepted")
+	}
+	if _, err := prover.Prove(&types.Header{TxHash: common.Hash{1}}, 0, txTrie); err != ErrTxTrieMismatch {
+		t.Errorf("root mismatch: have %v, want %v", err, ErrTxTrieMismatch)
+	}
+}
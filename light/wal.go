@@ -0,0 +1,230 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package light
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/akroma-project/akroma/common"
+	"github.com/akroma-project/akroma/ethdb"
+	"github.com/akroma-project/akroma/log"
+	"github.com/akroma-project/akroma/rlp"
+)
+
+// walEntry is a single key-value pair recorded in the write-ahead log. RLP list
+// encoding already carries the length of the entry, so the log is a simple
+// sequence of encoded entries.
+type walEntry struct {
+	Key, Value []byte
+}
+
+// writeAheadLog is an append-only file of database writes. Entries are synced
+// to disk before the corresponding database batch is written, and the log is
+// truncated once the batch made it into the database. Any entries left over
+// after a crash are replayed into the database on the next startup.
+type writeAheadLog struct {
+	path string
+	lock sync.Mutex
+}
+
+// newWriteAheadLog creates a write-ahead log stored at the given path.
+func newWriteAheadLog(path string) *writeAheadLog {
+	return &writeAheadLog{path: path}
+}
+
+// append writes the given entries to the end of the log and syncs the file.
+func (w *writeAheadLog) append(entries []walEntry) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	for _, entry := range entries {
+		if err := rlp.Encode(buf, entry); err != nil {
+			return err
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// truncate drops all entries from the log.
+func (w *writeAheadLog) truncate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if err := os.Truncate(w.path, 0); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// replay writes all entries found in the log into db and truncates the log. A
+// partially written entry at the end of the log (interrupted append) is dropped.
+func (w *writeAheadLog) replay(db ethdb.Putter) (int, error) {
+	w.lock.Lock()
+	input, err := os.Open(w.path)
+	if os.IsNotExist(err) {
+		w.lock.Unlock()
+		return 0, nil
+	}
+	if err != nil {
+		w.lock.Unlock()
+		return 0, err
+	}
+	replayed, err := replayEntries(input, db)
+	input.Close()
+	w.lock.Unlock()
+
+	if err != nil {
+		return replayed, err
+	}
+	return replayed, w.truncate()
+}
+
+// replayEntries writes all log entries read from r into db. A partially written
+// entry at the end of the input is dropped.
+func replayEntries(r io.Reader, db ethdb.Putter) (int, error) {
+	var (
+		stream   = rlp.NewStream(bufio.NewReader(r), 0)
+		replayed int
+	)
+	for {
+		var entry walEntry
+		if err := stream.Decode(&entry); err != nil {
+			if err != io.EOF {
+				log.Warn("Dropping incomplete trie node log entry", "err", err)
+			}
+			return replayed, nil
+		}
+		if err := db.Put(entry.Key, entry.Value); err != nil {
+			return replayed, err
+		}
+		replayed++
+	}
+}
+
+// walDatabase wraps a database so that all batches written through it are
+// recorded in a write-ahead log first.
+type walDatabase struct {
+	ethdb.Database
+	wal *writeAheadLog
+}
+
+// NewBatch implements ethdb.Database, returning a batch backed by the log.
+func (db *walDatabase) NewBatch() ethdb.Batch {
+	return &walBatch{Batch: db.Database.NewBatch(), wal: db.wal}
+}
+
+// walBatch is a database batch which appends its contents to the write-ahead
+// log before writing them into the database.
+type walBatch struct {
+	ethdb.Batch
+	wal     *writeAheadLog
+	entries []walEntry
+}
+
+// Put implements ethdb.Putter.
+func (b *walBatch) Put(key, value []byte) error {
+	b.entries = append(b.entries, walEntry{common.CopyBytes(key), common.CopyBytes(value)})
+	return b.Batch.Put(key, value)
+}
+
+// Write implements ethdb.Batch, logging the batch before writing it.
+func (b *walBatch) Write() error {
+	if err := b.wal.append(b.entries); err != nil {
+		return err
+	}
+	if err := b.Batch.Write(); err != nil {
+		return err
+	}
+	return b.wal.truncate()
+}
+
+// Reset implements ethdb.Batch.
+func (b *walBatch) Reset() {
+	b.entries = b.entries[:0]
+	b.Batch.Reset()
+}
+
+// auditDatabase wraps a database so that all batches written through it are also
+// recorded in an append-only audit sink, in the write-ahead log format.
+type auditDatabase struct {
+	ethdb.Database
+	sink io.Writer
+}
+
+// NewBatch implements ethdb.Database, returning a batch recorded in the sink.
+func (db *auditDatabase) NewBatch() ethdb.Batch {
+	return &auditBatch{Batch: db.Database.NewBatch(), sink: db.sink}
+}
+
+// auditBatch is a database batch which writes its contents to an audit sink
+// before writing them into the database.
+type auditBatch struct {
+	ethdb.Batch
+	sink    io.Writer
+	entries []walEntry
+}
+
+// Put implements ethdb.Putter.
+func (b *auditBatch) Put(key, value []byte) error {
+	b.entries = append(b.entries, walEntry{common.CopyBytes(key), common.CopyBytes(value)})
+	return b.Batch.Put(key, value)
+}
+
+// Write implements ethdb.Batch. The batch is recorded with a single Write call on
+// the sink, so that batches written concurrently don't interleave in an append
+// mode file.
+func (b *auditBatch) Write() error {
+	var buf bytes.Buffer
+	for _, entry := range b.entries {
+		if err := rlp.Encode(&buf, entry); err != nil {
+			return err
+		}
+	}
+	if _, err := b.sink.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return b.Batch.Write()
+}
+
+// Reset implements ethdb.Batch.
+func (b *auditBatch) Reset() {
+	b.entries = b.entries[:0]
+	b.Batch.Reset()
+}
+
+// ReplayChtAuditLog writes the CHT trie nodes recorded in an audit log (see
+// ChtIndexerConfig.AuditSink) into db and returns the number of nodes written. A
+// partially written entry at the end of the log is dropped. The CHT roots are
+// not part of the log; a replayed section can be reopened with
+// ImportCheckpointFromChain or by committing its root with StoreChtRoot.
+func ReplayChtAuditLog(db ethdb.Database, r io.Reader) (int, error) {
+	return replayEntries(r, ethdb.NewTable(db, ChtTablePrefix))
+}
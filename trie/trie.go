@@ -453,6 +453,33 @@ func (t *Trie) Hash() common.Hash {
 	return common.BytesToHash(hash.(hashNode))
 }
 
+// DirtyNodeCount returns the number of nodes modified since the trie was opened
+// or last committed.
+func (t *Trie) DirtyNodeCount() int {
+	return countDirty(t.root)
+}
+
+func countDirty(n node) int {
+	switch n := n.(type) {
+	case *shortNode:
+		if !n.flags.dirty {
+			return 0
+		}
+		return 1 + countDirty(n.Val)
+	case *fullNode:
+		if !n.flags.dirty {
+			return 0
+		}
+		count := 1
+		for _, child := range &n.Children {
+			count += countDirty(child)
+		}
+		return count
+	default:
+		return 0
+	}
+}
+
 // Commit writes all nodes to the trie's memory database, tracking the internal
 // and external (for account tries) references.
 func (t *Trie) Commit(onleaf LeafCallback) (root common.Hash, err error) {
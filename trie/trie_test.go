@@ -613,3 +613,20 @@ func updateString(trie *Trie, k, v string) {
 func deleteString(trie *Trie, k string) {
 	trie.Delete([]byte(k))
 }
+
+func TestDirtyNodeCount(t *testing.T) {
+	trie := newEmpty()
+	if n := trie.DirtyNodeCount(); n != 0 {
+		t.Fatalf("empty trie dirty count: have %d, want 0", n)
+	}
+	for i := byte(0); i < 16; i++ {
+		trie.Update([]byte{i << 4, 0x01}, []byte{i})
+	}
+	if n := trie.DirtyNodeCount(); n != 17 {
+		t.Fatalf("dirty count mismatch: have %d, want 17", n)
+	}
+	trie.Commit(nil)
+	if n := trie.DirtyNodeCount(); n != 0 {
+		t.Fatalf("dirty count after commit: have %d, want 0", n)
+	}
+}